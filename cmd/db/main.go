@@ -1,42 +1,78 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/frieeze/tezos-delegation/internal/tzkt"
+	"github.com/frieeze/tezos-delegation/internal/version"
 	"github.com/frieeze/tezos-delegation/internal/xtz"
 	"github.com/rs/zerolog"
 )
 
 type config struct {
-	debug  bool
-	dbPath string
-	api    string
-	empty  bool
+	debug      bool
+	dbPath     string
+	api        string
+	empty      bool
+	verify     bool
+	dryRun     bool
+	reverse    bool
+	batchSize  int
+	shard      bool
+	vacuum     bool
+	deleteIDs  string
+	checkpoint string
 }
 
 func loadConfig() (config, error) {
+	flag.Bool("version", false, "print version and exit")
 	debug := flag.Bool("debug", false, "enable debug logging")
 	dbPath := flag.String("db", "delegations.db", "path to the database file")
-	api := flag.String("api", "https://api.tzkt.io/v1/operations/delegations", "tzkt api delegation endpoint")
+	api := flag.String("api", tzkt.DefaultURL, "tzkt api delegation endpoint")
 	empty := flag.Bool("empty", false, "empty the database")
+	verify := flag.Bool("verify", false, "compare the database against the api, exits with an error if they differ")
+	dryRun := flag.Bool("dry-run", false, "fetch the history without writing to the database")
+	reverse := flag.Bool("reverse", false, "fetch the most recent delegations first, back to the oldest")
+	batchSize := flag.Int("batch-size", tzkt.MaxLimit, "number of delegations fetched and inserted at once, between 100 and the default")
+	shard := flag.Bool("shard", false, "move the delegations to one table per year")
+	vacuum := flag.Bool("vacuum", false, "reclaim the disk space freed by deletions")
+	checkpoint := flag.String("checkpoint", "", "mark the timestamp of the last stored delegation with this label")
+	deleteIDs := flag.String("delete-ids", "", "delete the delegations whose ids are listed in the file, one per line")
 
 	flag.Parse()
 
 	return config{
-		debug:  *debug,
-		dbPath: *dbPath,
-		api:    *api,
-		empty:  *empty,
+		debug:      *debug,
+		dbPath:     *dbPath,
+		api:        *api,
+		empty:      *empty,
+		verify:     *verify,
+		dryRun:     *dryRun,
+		reverse:    *reverse,
+		batchSize:  *batchSize,
+		shard:      *shard,
+		vacuum:     *vacuum,
+		deleteIDs:  *deleteIDs,
+		checkpoint: *checkpoint,
 	}, nil
 }
 
 func main() {
+	if version.Requested(os.Args[1:]) {
+		fmt.Println(version.String())
+		return
+	}
+
 	log := zerolog.New(os.Stderr).With().Timestamp().Logger()
 	log = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 	cfg, err := loadConfig()
@@ -52,6 +88,22 @@ func main() {
 	}
 	ctx := log.WithContext(context.Background())
 
+	log.Info().
+		Str("version", version.Version).
+		Str("commit", version.Commit).
+		Str("build_date", version.BuildDate).
+		Msg("build info")
+
+	if cfg.shard {
+		log.Info().Msg("shard store")
+		moved, err := store.MigrateToShards(ctx, cfg.dbPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to shard store")
+		}
+		log.Info().Int64("delegations", moved).Msg("done!")
+		return
+	}
+
 	log.Info().Msg("create store")
 	store, err := store.NewSqLite(ctx, cfg.dbPath)
 	if err != nil {
@@ -73,10 +125,65 @@ func main() {
 		return
 	}
 
+	if cfg.vacuum {
+		log.Info().Msg("vacuum store")
+		err = store.Vacuum(ctx)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to vacuum store")
+		}
+		log.Info().Msg("done!")
+		return
+	}
+
+	if cfg.deleteIDs != "" {
+		log.Info().Str("file", cfg.deleteIDs).Msg("delete delegations")
+		deleted, err := deleteIDs(ctx, store, cfg.deleteIDs)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to delete delegations")
+		}
+		log.Info().Int64("deleted", deleted).Msg("done!")
+		return
+	}
+
+	if cfg.checkpoint != "" {
+		log.Info().Str("label", cfg.checkpoint).Msg("create checkpoint")
+		timestamp, err := createCheckpoint(ctx, store, cfg.checkpoint)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to create checkpoint")
+		}
+		log.Info().Str("timestamp", timestamp).Msg("done!")
+		return
+	}
+
+	if cfg.verify {
+		log.Info().Msg("verify store")
+		result, err := xtz.NewVerifier(cfg.api, store).Verify(ctx, "", "")
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to verify store")
+		}
+		if result.Missing != 0 {
+			log.Fatal().
+				Int64("api", result.APICount).
+				Int64("store", result.StoreCount).
+				Int64("missing", result.Missing).
+				Msg("store and api counts differ")
+		}
+		log.Info().Int64("count", result.StoreCount).Msg("store is complete")
+		return
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	log.Info().Msg("start history sync")
-	history := xtz.NewHistory(cfg.api, store)
+	opts := []xtz.Option{xtz.WithAPI(cfg.api), xtz.WithBatchSize(cfg.batchSize)}
+	if cfg.dryRun {
+		log.Info().Msg("dry run, nothing will be written")
+		opts = append(opts, xtz.WithDryRun())
+	}
+	if cfg.reverse {
+		opts = append(opts, xtz.WithReverseOrder())
+	}
+	history := xtz.NewHistory(store, opts...)
 	defer history.Stop()
 	go func() {
 		err = history.Sync(ctx, "", "")
@@ -84,6 +191,9 @@ func main() {
 			log.Fatal().Err(err).Msg("failed to sync history")
 		}
 		log.Info().Msg("history sync done")
+		if cfg.dryRun {
+			log.Info().Int64("delegations", history.DryRunCount()).Msg("delegations that would have been inserted")
+		}
 		stop <- syscall.SIGINT
 	}()
 
@@ -100,3 +210,40 @@ func main() {
 
 	log.Info().Msg("stopping app")
 }
+
+// deleteIDs deletes the delegations whose ids are listed in the file at path,
+// one per line, blank lines are skipped.
+// Returns the number of deleted delegations.
+func deleteIDs(ctx context.Context, s store.Store, path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, fmt.Errorf("read %s: %w", path, err)
+	}
+	return s.BulkDelete(ctx, ids)
+}
+
+// createCheckpoint marks the timestamp of the last stored delegation
+// with the given label and returns that timestamp.
+func createCheckpoint(ctx context.Context, s store.Store, label string) (string, error) {
+	last, err := s.LastDelegation(ctx)
+	if err != nil {
+		return "", err
+	}
+	if last == nil {
+		return "", errors.New("no delegation stored")
+	}
+	return last.Timestamp, s.CreateCheckpoint(ctx, label, last.Timestamp)
+}
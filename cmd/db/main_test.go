@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_deleteIDs(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+		{ID: "2", Timestamp: "2024-01-02T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "2"},
+		{ID: "3", Timestamp: "2024-01-03T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "3"},
+	}))
+
+	path := filepath.Join(t.TempDir(), "ids.txt")
+	require.NoError(t, os.WriteFile(path, []byte("1\n\n 3 \n4\n"), 0644))
+	deleted, err := deleteIDs(context.Background(), s, path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	count, err := s.CountByYear(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func Test_deleteIDs_empty(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+
+	path := filepath.Join(t.TempDir(), "ids.txt")
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+	deleted, err := deleteIDs(context.Background(), s, path)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	_, err = deleteIDs(context.Background(), s, filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func Test_createCheckpoint(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = createCheckpoint(context.Background(), s, "backfill")
+	assert.Error(t, err)
+
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+		{ID: "2", Timestamp: "2024-01-02T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "2"},
+	}))
+	timestamp, err := createCheckpoint(context.Background(), s, "backfill")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-02T00:00:00Z", timestamp)
+
+	checkpoints, err := s.GetCheckpoints(context.Background())
+	require.NoError(t, err)
+	require.Len(t, checkpoints, 1)
+	assert.Equal(t, "backfill", checkpoints[0].Label)
+	assert.Equal(t, timestamp, checkpoints[0].Timestamp)
+}
@@ -2,38 +2,187 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/frieeze/tezos-delegation/internal/handlers"
+	"github.com/frieeze/tezos-delegation/internal/app"
 	"github.com/frieeze/tezos-delegation/internal/middleware"
 	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/frieeze/tezos-delegation/internal/tzkt"
+	"github.com/frieeze/tezos-delegation/internal/version"
 	"github.com/frieeze/tezos-delegation/internal/xtz"
+	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 type config struct {
+	dev          bool
 	debug        bool
-	dbPath       string
+	databaseURL  string
+	sqlite       store.SQLiteOpts
 	history      bool
 	api          string
 	syncInterval time.Duration
 	port         int
+	httpsPort    int
+	apiKeys      []string
+	disableAdmin bool
+	strictYears  bool
+	rateLimit    float64
+	rateBurst    int
+	maxBodySize  int64
+	retention    time.Duration
+	baker        string
+	tlsCert      string
+	tlsKey       string
+	tlsAuto      bool
+	domain       string
+	acmeCache    string
+	backupDir    string
+	backupCron   string
+	configFile   string
 }
 
+// fromEnvironment returns the default configuration
+// overridden by the TDS_* environment variables that are set
+func fromEnvironment() (config, error) {
+	return fromLookup(os.LookupEnv)
+}
+
+// fromLookup returns the default configuration
+// overridden by the TDS_* variables found by lookup
+func fromLookup(lookup func(key string) (string, bool)) (config, error) {
+	cfg := config{
+		databaseURL:  "delegations.db",
+		sqlite:       store.DefaultSQLiteOpts(),
+		history:      true,
+		api:          tzkt.DefaultURL,
+		syncInterval: time.Minute,
+		port:         8080,
+	}
+	var errs []error
+	if v, ok := lookup("TDS_PORT"); ok {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TDS_PORT %q: must be an integer", v))
+		}
+		cfg.port = port
+	}
+	if v, ok := lookup("TDS_DB_PATH"); ok {
+		cfg.databaseURL = v
+	}
+	if v, ok := lookup("TDS_DB_JOURNAL_MODE"); ok {
+		cfg.sqlite.JournalMode = v
+	}
+	if v, ok := lookup("TDS_DB_CACHE_KB"); ok {
+		kb, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TDS_DB_CACHE_KB %q: must be an integer", v))
+		}
+		cfg.sqlite.CacheSize = -kb
+	}
+	if v, ok := lookup("TDS_DB_BUSY_TIMEOUT"); ok {
+		bt, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TDS_DB_BUSY_TIMEOUT %q: must be a duration string", v))
+		}
+		cfg.sqlite.BusyTimeout = bt
+	}
+	if v, ok := lookup("TDS_API_URL"); ok {
+		cfg.api = v
+	}
+	if v, ok := lookup("TDS_SYNC_INTERVAL"); ok {
+		si, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TDS_SYNC_INTERVAL %q: must be a duration string", v))
+		}
+		cfg.syncInterval = si
+	}
+	if v, ok := lookup("TDS_DEV"); ok {
+		dev, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TDS_DEV %q: must be a boolean", v))
+		}
+		cfg.dev = dev
+	}
+	if v, ok := lookup("TDS_DEBUG"); ok {
+		debug, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TDS_DEBUG %q: must be a boolean", v))
+		}
+		cfg.debug = debug
+	}
+	if v, ok := lookup("TDS_NO_HISTORY"); ok {
+		noHistory, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TDS_NO_HISTORY %q: must be a boolean", v))
+		}
+		cfg.history = !noHistory
+	}
+	if v, ok := lookup("TDS_TLS_CERT"); ok {
+		cfg.tlsCert = v
+	}
+	if v, ok := lookup("TDS_TLS_KEY"); ok {
+		cfg.tlsKey = v
+	}
+	if v, ok := lookup("TDS_API_KEYS"); ok {
+		cfg.apiKeys = splitList(v)
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// loadConfig parses the flags on top of the environment,
+// a flag given on the command line takes precedence over its variable
 func loadConfig() (config, error) {
-	debug := flag.Bool("debug", false, "enable debug logging")
-	dbPath := flag.String("db", "delegations.db", "path to the database file")
-	noHistory := flag.Bool("nohistory", false, "disable history sync")
-	api := flag.String("api", "https://api.tzkt.io/v1/operations/delegations", "tzkt api delegation endpoint")
-	syncInterval := flag.String("sync", "1m", "sync interval, should be a duration string")
-	port := flag.Int("port", 8080, "http server port")
+	env, err := fromEnvironment()
+	if err != nil {
+		return config{}, err
+	}
+
+	flag.Bool("version", false, "print version and exit")
+	dev := flag.Bool("dev", env.dev, "development mode, human readable debug logs (TDS_DEV)")
+	debug := flag.Bool("debug", env.debug, "enable debug logging (TDS_DEBUG)")
+	databaseURL := flag.String("db", env.databaseURL, "sqlite database file, or postgres:// url (TDS_DB_PATH)")
+	dbJournalMode := flag.String("db-journal-mode", env.sqlite.JournalMode, "sqlite journal mode: DELETE, TRUNCATE, PERSIST, MEMORY, WAL or OFF (TDS_DB_JOURNAL_MODE)")
+	dbCacheKB := flag.Int("db-cache-kb", -env.sqlite.CacheSize, "sqlite page cache size of each connection, in KiB (TDS_DB_CACHE_KB)")
+	dbBusyTimeout := flag.Duration("db-busy-timeout", env.sqlite.BusyTimeout, "how long sqlite waits for a lock, should be a duration string (TDS_DB_BUSY_TIMEOUT)")
+	noHistory := flag.Bool("nohistory", !env.history, "disable history sync (TDS_NO_HISTORY)")
+	api := flag.String("api", env.api, "tzkt api delegation endpoint (TDS_API_URL)")
+	syncInterval := flag.String("sync", env.syncInterval.String(), "sync interval, should be a duration string (TDS_SYNC_INTERVAL)")
+	port := flag.Int("port", env.port, "http server port (TDS_PORT)")
+	httpsPort := flag.Int("https-port", 0, "https server port, serves plain HTTP on -port alongside, requires TLS, 0 serves a single server on -port")
+	// the keys of the environment are not used as default, -h would print them
+	apiKeys := flag.String("api-keys", "", "comma separated list of API keys allowed on admin routes (TDS_API_KEYS)")
+	disableAdmin := flag.Bool("disable-admin", false, "disable admin routes")
+	strictYears := flag.Bool("strict-years", false, "only accept the years having stored delegations on /xtz/delegations, instead of any year since 2018")
+	rateLimit := flag.Float64("rate-limit", 10, "requests per second allowed per client IP, 0 disables rate limiting")
+	rateBurst := flag.Int("rate-burst", 20, "requests burst allowed per client IP")
+	maxBodySize := flag.Int64("max-body-size", middleware.DefaultMaxRequestBytes, "maximum request body size in bytes")
+	baker := flag.String("baker", "", "only track the delegations to this baker address")
+	tlsCert := flag.String("tls-cert", env.tlsCert, "TLS certificate file, serves HTTPS along with -tls-key (TDS_TLS_CERT)")
+	tlsKey := flag.String("tls-key", env.tlsKey, "TLS private key file, serves HTTPS along with -tls-cert (TDS_TLS_KEY)")
+	tlsAuto := flag.Bool("tls-auto", false, "serve HTTPS with a Let's Encrypt certificate for -domain, cached in -acme-cache")
+	domain := flag.String("domain", "", "domain of the Let's Encrypt certificate")
+	acmeCache := flag.String("acme-cache", "", "directory caching the Let's Encrypt certificates")
+	backupDir := flag.String("backup-dir", "", "directory receiving the database backups, enables the backup admin route")
+	backupCron := flag.String("backup-schedule", "", "cron schedule of the automatic backups, e.g. \"0 2 * * *\", requires -backup-dir")
+	retention := flag.String("retention", "", "delete delegations older than this duration every day, should be a duration string, empty disables pruning")
+	configFile := flag.String("config", "", "file of TDS_* variables, one KEY=value per line, overriding the environment and re-read on SIGHUP")
 
 	flag.Parse()
 
@@ -42,45 +191,468 @@ func loadConfig() (config, error) {
 		return config{}, err
 	}
 
-	return config{
+	var ret time.Duration
+	if *retention != "" {
+		ret, err = time.ParseDuration(*retention)
+		if err != nil {
+			return config{}, err
+		}
+	}
+
+	sqliteOpts := store.SQLiteOpts{
+		JournalMode: *dbJournalMode,
+		CacheSize:   -*dbCacheKB,
+		BusyTimeout: *dbBusyTimeout,
+	}
+
+	keys := env.apiKeys
+	if *apiKeys != "" {
+		keys = splitList(*apiKeys)
+	}
+
+	cfg := config{
+		dev:          *dev,
 		debug:        *debug,
-		dbPath:       *dbPath,
+		databaseURL:  *databaseURL,
+		sqlite:       sqliteOpts,
 		history:      !*noHistory,
 		api:          *api,
 		syncInterval: si,
 		port:         *port,
-	}, nil
+		httpsPort:    *httpsPort,
+		apiKeys:      keys,
+		disableAdmin: *disableAdmin,
+		strictYears:  *strictYears,
+		rateLimit:    *rateLimit,
+		rateBurst:    *rateBurst,
+		maxBodySize:  *maxBodySize,
+		retention:    ret,
+		baker:        *baker,
+		tlsCert:      *tlsCert,
+		tlsKey:       *tlsKey,
+		tlsAuto:      *tlsAuto,
+		domain:       *domain,
+		acmeCache:    *acmeCache,
+		backupDir:    *backupDir,
+		backupCron:   *backupCron,
+		configFile:   *configFile,
+	}
+	if cfg.configFile == "" {
+		return cfg, nil
+	}
+	return reloadConfig(cfg)
+}
+
+// readConfigFile reads the KEY=value lines of a config file,
+// blank lines and lines starting with # are skipped
+func readConfigFile(path string) (map[string]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	vars := map[string]string{}
+	for i, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", path, i+1)
+		}
+		vars[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return vars, nil
+}
+
+// minSyncInterval keeps the live sync from hammering the tzkt api
+const minSyncInterval = xtz.MinInterval
+
+// journalModes are the journal modes supported by sqlite
+var journalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+
+// Validate checks the configuration,
+// returns every validation failure at once
+func (c config) Validate() error {
+	var errs []error
+	if c.port < 1 || c.port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d: must be between 1 and 65535", c.port))
+	}
+	if c.httpsPort != 0 {
+		if c.httpsPort < 1 || c.httpsPort > 65535 {
+			errs = append(errs, fmt.Errorf("https port %d: must be between 1 and 65535", c.httpsPort))
+		}
+		if c.httpsPort == c.port {
+			errs = append(errs, fmt.Errorf("https port %d: must differ from port", c.httpsPort))
+		}
+		if c.tlsCert == "" && !c.tlsAuto {
+			errs = append(errs, errors.New("https port requires a tls cert or tls auto"))
+		}
+	}
+	if c.syncInterval < minSyncInterval {
+		errs = append(errs, fmt.Errorf("sync interval %s: must be at least %s", c.syncInterval, minSyncInterval))
+	}
+	if store.IsPostgresURL(c.databaseURL) {
+		errs = append(errs, fmt.Errorf("db: %w: postgres", store.ErrUnsupportedDatabase))
+	} else if err := writableDir(filepath.Dir(c.databaseURL)); err != nil {
+		errs = append(errs, fmt.Errorf("db path %q: %w", c.databaseURL, err))
+	}
+	if !slices.Contains(journalModes, strings.ToUpper(c.sqlite.JournalMode)) {
+		errs = append(errs, fmt.Errorf("db journal mode %q: must be one of %s", c.sqlite.JournalMode, strings.Join(journalModes, ", ")))
+	}
+	if c.sqlite.CacheSize >= 0 {
+		errs = append(errs, fmt.Errorf("db cache %d KiB: must be positive", -c.sqlite.CacheSize))
+	}
+	if c.sqlite.BusyTimeout < 0 {
+		errs = append(errs, fmt.Errorf("db busy timeout %s: must be positive", c.sqlite.BusyTimeout))
+	}
+	if u, err := url.Parse(c.api); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("api %q: must be a valid http or https url", c.api))
+	}
+	if (c.tlsCert == "") != (c.tlsKey == "") {
+		errs = append(errs, errors.New("tls cert and tls key must be provided together"))
+	}
+	if c.tlsAuto {
+		if c.tlsCert != "" {
+			errs = append(errs, errors.New("tls auto can't be used with a tls cert"))
+		}
+		if c.domain == "" {
+			errs = append(errs, errors.New("tls auto requires a domain"))
+		}
+		if c.acmeCache == "" {
+			errs = append(errs, errors.New("tls auto requires an acme cache directory"))
+		}
+	}
+	if c.backupDir != "" {
+		if err := writableDir(c.backupDir); err != nil {
+			errs = append(errs, fmt.Errorf("backup dir %q: %w", c.backupDir, err))
+		}
+	}
+	if c.backupCron != "" {
+		if c.backupDir == "" {
+			errs = append(errs, errors.New("backup schedule requires a backup dir"))
+		}
+		if _, err := cron.ParseStandard(c.backupCron); err != nil {
+			errs = append(errs, fmt.Errorf("backup schedule %q: %w", c.backupCron, err))
+		}
+	}
+	if c.maxBodySize < 1 {
+		errs = append(errs, fmt.Errorf("max body size %d: must be positive", c.maxBodySize))
+	}
+	if c.retention < 0 {
+		errs = append(errs, fmt.Errorf("retention %s: must be positive", c.retention))
+	}
+	return errors.Join(errs...)
+}
+
+// writableDir checks that dir is an existing writable directory
+func writableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, ".tds-write-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// newServers returns a single server on -port, HTTPS when TLS is configured,
+// or a plain HTTP server on -port and an HTTPS one on -https-port
+func newServers(handler http.Handler, cfg config) []*http.Server {
+	var tlsConfig *tls.Config
+	plain := handler
+	switch {
+	case cfg.tlsAuto:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.domain),
+			Cache:      autocert.DirCache(cfg.acmeCache),
+		}
+		tlsConfig = m.TLSConfig()
+		// answer the HTTP-01 challenges on the plain server
+		plain = m.HTTPHandler(handler)
+	case cfg.tlsCert != "":
+		tlsConfig = &tls.Config{}
+	}
+
+	if cfg.httpsPort == 0 {
+		return []*http.Server{{
+			Addr:      fmt.Sprintf(":%d", cfg.port),
+			Handler:   handler,
+			TLSConfig: tlsConfig,
+		}}
+	}
+	return []*http.Server{
+		{Addr: fmt.Sprintf(":%d", cfg.port), Handler: plain},
+		{Addr: fmt.Sprintf(":%d", cfg.httpsPort), Handler: handler, TLSConfig: tlsConfig},
+	}
+}
+
+// middlewares returns the middleware chain of the http server
+func middlewares(cfg config, log zerolog.Logger) middleware.Middleware {
+	// middlewares are listed from the outermost to the innermost
+	var mws []middleware.Middleware
+	// security headers only make sense over HTTPS,
+	// they are set on the responses rejected by the middlewares below too
+	if cfg.tlsCert != "" || cfg.tlsAuto {
+		mws = append(mws, middleware.SecureHeaders())
+	}
+	mws = append(mws,
+		hlog.NewHandler(log),
+		middleware.Logger(),
+		hlog.RequestIDHandler("req_id", "Request-Id"),
+	)
+	if cfg.rateLimit > 0 {
+		mws = append(mws, middleware.RateLimit(cfg.rateLimit, cfg.rateBurst))
+	}
+	mws = append(mws, middleware.RequestSizeLimit(cfg.maxBodySize))
+	return middleware.Use(mws...)
+}
+
+// dumpStatus logs the live sync status every time a signal is received
+func dumpStatus(ctx context.Context, signals <-chan os.Signal, syncer *xtz.Live) {
+	for range signals {
+		status, err := json.Marshal(syncer.Status())
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("failed to marshal sync status")
+			continue
+		}
+		zerolog.Ctx(ctx).Info().RawJSON("status", status).Msg("sync status")
+	}
+}
+
+// reloadConfig re-reads the config file, its variables override the environment
+// and the flags given on the command line keep precedence over both.
+// The environment of a running process can't change,
+// without a config file there is nothing to reload.
+func reloadConfig(cfg config) (config, error) {
+	if cfg.configFile == "" {
+		return cfg, errNoConfigFile
+	}
+	vars, err := readConfigFile(cfg.configFile)
+	if err != nil {
+		return cfg, err
+	}
+	env, err := fromLookup(func(key string) (string, bool) {
+		if v, ok := vars[key]; ok {
+			return v, true
+		}
+		return os.LookupEnv(key)
+	})
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", cfg.configFile, err)
+	}
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	next := cfg
+	for name, apply := range map[string]func(){
+		"dev":             func() { next.dev = env.dev },
+		"debug":           func() { next.debug = env.debug },
+		"sync":            func() { next.syncInterval = env.syncInterval },
+		"db":              func() { next.databaseURL = env.databaseURL },
+		"db-journal-mode": func() { next.sqlite.JournalMode = env.sqlite.JournalMode },
+		"db-cache-kb":     func() { next.sqlite.CacheSize = env.sqlite.CacheSize },
+		"db-busy-timeout": func() { next.sqlite.BusyTimeout = env.sqlite.BusyTimeout },
+		"port":            func() { next.port = env.port },
+		"api":             func() { next.api = env.api },
+		"nohistory":       func() { next.history = env.history },
+		"tls-cert":        func() { next.tlsCert = env.tlsCert },
+		"tls-key":         func() { next.tlsKey = env.tlsKey },
+		"api-keys":        func() { next.apiKeys = env.apiKeys },
+	} {
+		if !set[name] {
+			apply()
+		}
+	}
+	return next, nil
+}
+
+// errNoConfigFile is returned by a reload without -config
+var errNoConfigFile = errors.New("no config file to reload, start with -config")
+
+// intervalSetter changes the interval of the live sync
+type intervalSetter interface {
+	SetInterval(d time.Duration) error
+}
+
+// reload applies the log level and the sync interval of next,
+// the changes of the other fields are logged as requiring a restart.
+// Returns the configuration in effect.
+func reload(ctx context.Context, cfg, next config, syncer intervalSetter) config {
+	logger := zerolog.Ctx(ctx)
+	if next.debug != cfg.debug {
+		level := zerolog.InfoLevel
+		if next.debug || cfg.dev {
+			level = zerolog.DebugLevel
+		}
+		zerolog.SetGlobalLevel(level)
+		logger.Info().Str("level", level.String()).Msg("log level reloaded")
+		cfg.debug = next.debug
+	}
+	if next.syncInterval != cfg.syncInterval {
+		if err := syncer.SetInterval(next.syncInterval); err != nil {
+			logger.Error().Err(err).Msg("failed to reload sync interval")
+		} else {
+			logger.Info().Str("interval", next.syncInterval.String()).Msg("sync interval reloaded")
+			cfg.syncInterval = next.syncInterval
+		}
+	}
+
+	for _, field := range []struct {
+		name    string
+		changed bool
+	}{
+		{"dev", next.dev != cfg.dev},
+		{"db", next.databaseURL != cfg.databaseURL},
+		{"db-journal-mode", next.sqlite.JournalMode != cfg.sqlite.JournalMode},
+		{"db-cache-kb", next.sqlite.CacheSize != cfg.sqlite.CacheSize},
+		{"db-busy-timeout", next.sqlite.BusyTimeout != cfg.sqlite.BusyTimeout},
+		{"port", next.port != cfg.port},
+		{"api", next.api != cfg.api},
+		{"nohistory", next.history != cfg.history},
+		{"tls-cert", next.tlsCert != cfg.tlsCert},
+		{"tls-key", next.tlsKey != cfg.tlsKey},
+		{"api-keys", !slices.Equal(next.apiKeys, cfg.apiKeys)},
+	} {
+		if field.changed {
+			logger.Warn().Str("field", field.name).Msg("config change ignored, a restart is required")
+		}
+	}
+	return cfg
+}
+
+// reloadOnSignal reloads the configuration every time a signal is received
+func reloadOnSignal(ctx context.Context, signals <-chan os.Signal, cfg config, syncer intervalSetter) {
+	for range signals {
+		next, err := reloadConfig(cfg)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("failed to reload config")
+			continue
+		}
+		cfg = reload(ctx, cfg, next, syncer)
+	}
+}
+
+// listen serves HTTPS when the server has a TLS config, HTTP otherwise
+func listen(server *http.Server, cfg config) error {
+	if server.TLSConfig == nil {
+		return server.ListenAndServe()
+	}
+	// empty with -tls-auto, the certificates come from the TLS config
+	return server.ListenAndServeTLS(cfg.tlsCert, cfg.tlsKey)
+}
+
+// pruneInterval is the time between two retention prunings
+const pruneInterval = 24 * time.Hour
+
+// prune deletes the delegations older than retention
+// right away and then every pruneInterval until ctx is done
+func prune(ctx context.Context, s store.Store, retention time.Duration) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		before := time.Now().Add(-retention).UTC().Format(time.RFC3339)
+		deleted, err := s.DeleteBeforeDate(ctx, before)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("failed to prune delegations")
+		} else {
+			zerolog.Ctx(ctx).Info().Int64("deleted", deleted).Str("before", before).Msg("pruned delegations")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backup copies the store to a new file of dir
+func backup(ctx context.Context, s store.Store, dir string) {
+	path := store.BackupPath(dir, time.Now())
+	err := s.Backup(ctx, path)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("scheduled backup failed")
+		return
+	}
+	zerolog.Ctx(ctx).Info().Str("path", path).Msg("store backed up")
+}
+
+// splitList splits a comma separated list, ignoring empty values
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
 }
 
 func main() {
+	if version.Requested(os.Args[1:]) {
+		fmt.Println(version.String())
+		return
+	}
+
 	log := zerolog.New(os.Stderr).With().Timestamp().Logger()
 	cfg, err := loadConfig()
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to load config")
 	}
+	err = cfg.Validate()
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid config")
+	}
 
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	if cfg.debug {
+	if cfg.dev {
 		log = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	}
+	if cfg.debug || cfg.dev {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	} else {
 		zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	}
 	ctx := log.WithContext(context.Background())
 
+	log.Info().
+		Str("version", version.Version).
+		Str("commit", version.Commit).
+		Str("build_date", version.BuildDate).
+		Msg("build info")
+
 	// ****************APP****************
 	log.Info().Msg("create store")
-	store, err := store.NewSqLite(ctx, cfg.dbPath)
+	a, err := app.NewApp(ctx, app.Config{
+		DatabaseURL:  cfg.databaseURL,
+		SQLite:       &cfg.sqlite,
+		API:          cfg.api,
+		SyncInterval: cfg.syncInterval,
+		History:      cfg.history,
+		Baker:        cfg.baker,
+		APIKeys:      cfg.apiKeys,
+		DisableAdmin: cfg.disableAdmin,
+		BackupDir:    cfg.backupDir,
+		StrictYears:  cfg.strictYears,
+	})
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to create store")
 	}
+	defer a.Close()
 
-	if cfg.history {
+	if a.History != nil {
 		log.Info().Msg("start history sync")
-		history := xtz.NewHistory(cfg.api, store)
-		defer history.Stop()
 		go func() {
-			err = history.Sync(ctx, "", "")
+			err = a.History.Sync(ctx, "", "")
 			if err != nil {
 				log.Fatal().Err(err).Msg("failed to sync history")
 			}
@@ -89,42 +661,50 @@ func main() {
 	}
 
 	log.Info().Msg("start live sync")
-	syncer := xtz.NewLive(cfg.api, cfg.syncInterval, store)
-	defer syncer.Stop()
-
-	err = syncer.Sync(ctx, "")
+	err = a.Live.Sync(ctx, "")
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to sync live")
 	}
 
-	// ****************HTTP SERVER****************
-	log.Info().Int("port", cfg.port).Msg("start http server")
-	h := handlers.Handlers{Store: store}
-	router := http.NewServeMux()
-	router.Handle("/xtz/", http.StripPrefix("/xtz", h.AddXTZRoutes()))
-
-	use := middleware.Use(
-		hlog.RequestIDHandler("req_id", "Request-Id"),
-		middleware.Logger(),
-		hlog.NewHandler(log),
-	)
+	if cfg.retention > 0 {
+		log.Info().Str("retention", cfg.retention.String()).Msg("start retention pruning")
+		go prune(ctx, a.Store, cfg.retention)
+	}
 
-	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.port),
-		Handler: use(router),
+	if cfg.backupCron != "" {
+		log.Info().Str("schedule", cfg.backupCron).Str("dir", cfg.backupDir).Msg("start scheduled backups")
+		backups := cron.New()
+		backups.AddFunc(cfg.backupCron, func() { backup(ctx, a.Store, cfg.backupDir) })
+		backups.Start()
+		defer backups.Stop()
 	}
 
-	go func() {
-		err = server.ListenAndServe()
-		if err != nil && err != http.ErrServerClosed {
-			log.Fatal().Err(err).Msg("http server failed")
-		}
-	}()
+	// ****************HTTP SERVER****************
+	servers := newServers(middlewares(cfg, log)(a.Handler), cfg)
+	for _, server := range servers {
+		log.Info().Str("addr", server.Addr).Bool("tls", server.TLSConfig != nil).Msg("start http server")
+		go func() {
+			err := listen(server, cfg)
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatal().Err(err).Str("addr", server.Addr).Msg("http server failed")
+			}
+		}()
+	}
 
 	// ****************GRACEFUL SHUTDOWN****************
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
+	// dump the sync state on SIGUSR1, even if the http server is down
+	dump := make(chan os.Signal, 1)
+	signal.Notify(dump, syscall.SIGUSR1)
+	go dumpStatus(ctx, dump, a.Live)
+
+	// reload the log level and the sync interval of the config file on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go reloadOnSignal(ctx, hup, cfg, a.Live)
+
 	<-stop
 
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
@@ -137,4 +717,9 @@ func main() {
 	}()
 
 	log.Info().Msg("stopping app")
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Str("addr", server.Addr).Msg("failed to shutdown http server")
+		}
+	}
 }
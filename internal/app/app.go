@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/frieeze/tezos-delegation/internal/broadcast"
+	"github.com/frieeze/tezos-delegation/internal/handlers"
+	"github.com/frieeze/tezos-delegation/internal/metrics"
+	"github.com/frieeze/tezos-delegation/internal/middleware"
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/frieeze/tezos-delegation/internal/tzkt"
+	"github.com/frieeze/tezos-delegation/internal/xtz"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+// Config is the part of the service configuration needed to build an App
+type Config struct {
+	// DatabaseURL is the sqlite database file or a postgres url, see store.Open
+	DatabaseURL string
+	// SQLite tunes the sqlite connections, store.DefaultSQLiteOpts if nil
+	SQLite *store.SQLiteOpts
+	// API is the tzkt delegation endpoint
+	API string
+	// SyncInterval is the interval between two live syncs
+	SyncInterval time.Duration
+	// History enables the history syncer
+	History bool
+	// Baker only syncs the delegations to this baker
+	Baker string
+	// APIKeys are the keys of the admin routes
+	APIKeys []string
+	// DisableAdmin removes the admin routes
+	DisableAdmin bool
+	// BackupDir is the directory receiving the store backups
+	BackupDir string
+	// StrictYears rejects the years without stored delegations
+	StrictYears bool
+	// Registry records the sync metrics, prometheus.DefaultRegisterer if nil
+	Registry metrics.Registry
+}
+
+// App holds the store, the syncers and the routes of the service
+type App struct {
+	Store store.Store
+	Hub   *broadcast.Hub
+	// History is nil if the history sync is disabled
+	History *xtz.History
+	Live    *xtz.Live
+	// Handler serves every route, without the middlewares
+	Handler http.Handler
+}
+
+// NewApp creates the store and wires the syncers and the routes on it,
+// the syncers are not started
+func NewApp(ctx context.Context, cfg Config) (*App, error) {
+	hub := broadcast.NewHub()
+	storeOpts := []store.Option{store.WithHub(hub)}
+	if cfg.SQLite != nil {
+		storeOpts = append(storeOpts, store.WithSQLiteOpts(*cfg.SQLite))
+	}
+	s, err := store.Open(ctx, cfg.DatabaseURL, storeOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	reg := cfg.Registry
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	client := tzkt.NewClient(cfg.API, tzkt.WithRateLimitCallback(func(i tzkt.RateLimitInfo) {
+		log.Ctx(ctx).Debug().Int("remaining", i.Remaining).Time("reset", i.Reset).Msg("tzkt rate limit")
+	}))
+	opts := []xtz.Option{
+		xtz.WithClient(client),
+		xtz.WithBaker(cfg.Baker),
+		xtz.WithRegistry(reg),
+	}
+
+	a := &App{
+		Store: s,
+		Hub:   hub,
+		Live:  xtz.NewLive(s, append(opts, xtz.WithInterval(cfg.SyncInterval))...),
+	}
+	if cfg.History {
+		a.History = xtz.NewHistory(s, opts...)
+	}
+
+	h := handlers.Handlers{
+		Store:       s,
+		Hub:         hub,
+		Syncer:      a.Live,
+		BackupDir:   cfg.BackupDir,
+		StrictYears: cfg.StrictYears,
+	}
+	router := http.NewServeMux()
+	xtzRoutes := h.AddXTZRoutes()
+	if !cfg.DisableAdmin {
+		h.AddAdminRoutes(xtzRoutes, middleware.APIKey(cfg.APIKeys))
+	} else {
+		log.Ctx(ctx).Info().Msg("admin routes disabled")
+	}
+	router.Handle("/xtz/", http.StripPrefix("/xtz", xtzRoutes))
+	router.HandleFunc("GET /version", handlers.Version)
+	router.Handle("GET /metrics", promhttp.Handler())
+	router.Handle("/", handlers.NotFound())
+	a.Handler = router
+
+	return a, nil
+}
+
+// Close stops the syncers and closes the store
+func (a *App) Close() error {
+	if a.History != nil {
+		a.History.Stop()
+	}
+	a.Live.Stop()
+	return a.Store.Close()
+}
@@ -0,0 +1,90 @@
+package broadcast
+
+import (
+	"sync"
+
+	tds "github.com/frieeze/tezos-delegation"
+)
+
+// bufferSize is the number of delegations a subscriber can lag behind
+// before new ones are dropped
+const bufferSize = 64
+
+// Hub broadcasts delegations to its subscribers
+type Hub struct {
+	mu          sync.Mutex
+	subscribers []chan<- tds.Delegation
+}
+
+// NewHub creates a new hub
+func NewHub() *Hub {
+	return &Hub{}
+}
+
+// Subscribe returns a channel receiving every delegation published
+// and a function to call to unsubscribe, which closes the channel
+func (h *Hub) Subscribe() (<-chan tds.Delegation, func()) {
+	ch := make(chan tds.Delegation, bufferSize)
+
+	h.mu.Lock()
+	h.subscribers = append(h.subscribers, ch)
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			for i, sub := range h.subscribers {
+				if sub == ch {
+					h.subscribers = append(h.subscribers[:i], h.subscribers[i+1:]...)
+					break
+				}
+			}
+			close(ch)
+		})
+	}
+}
+
+// Add subscribes a channel owned by the caller,
+// it is never closed by the hub
+func (h *Hub) Add(ch chan<- tds.Delegation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers = append(h.subscribers, ch)
+}
+
+// Remove unsubscribes a channel given to Add
+func (h *Hub) Remove(ch chan<- tds.Delegation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, sub := range h.subscribers {
+		if sub == ch {
+			h.subscribers = append(h.subscribers[:i], h.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Publish sends the delegations to every subscriber
+// Delegations are dropped for subscribers whose buffer is full
+// so a slow subscriber never blocks the publisher
+func (h *Hub) Publish(ds []tds.Delegation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, sub := range h.subscribers {
+		for _, d := range ds {
+			select {
+			case sub <- d:
+			default:
+			}
+		}
+	}
+}
+
+// Len returns the number of subscribers
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
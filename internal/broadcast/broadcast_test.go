@@ -0,0 +1,60 @@
+package broadcast
+
+import (
+	"testing"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Hub(t *testing.T) {
+	h := NewHub()
+	first, unsubFirst := h.Subscribe()
+	second, unsubSecond := h.Subscribe()
+	defer unsubSecond()
+	assert.Equal(t, 2, h.Len())
+
+	ds := []tds.Delegation{{ID: "1"}, {ID: "2"}}
+	h.Publish(ds)
+	for _, ch := range []<-chan tds.Delegation{first, second} {
+		assert.Equal(t, ds[0], <-ch)
+		assert.Equal(t, ds[1], <-ch)
+	}
+
+	unsubFirst()
+	unsubFirst()
+	assert.Equal(t, 1, h.Len())
+	_, open := <-first
+	assert.False(t, open)
+
+	h.Publish(ds)
+	assert.Equal(t, ds[0], <-second)
+}
+
+func Test_Hub_slowSubscriber(t *testing.T) {
+	h := NewHub()
+	ch, unsub := h.Subscribe()
+	defer unsub()
+
+	ds := make([]tds.Delegation, bufferSize+10)
+	h.Publish(ds)
+	assert.Len(t, ch, bufferSize)
+}
+
+func Test_Hub_Add(t *testing.T) {
+	h := NewHub()
+	ch := make(chan tds.Delegation, 1)
+	h.Add(ch)
+	assert.Equal(t, 1, h.Len())
+
+	ds := []tds.Delegation{{ID: "1"}, {ID: "2"}}
+	h.Publish(ds)
+	assert.Equal(t, ds[0], <-ch)
+	assert.Empty(t, ch)
+
+	h.Remove(ch)
+	h.Remove(ch)
+	assert.Zero(t, h.Len())
+	h.Publish(ds)
+	assert.Empty(t, ch)
+}
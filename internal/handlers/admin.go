@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/middleware"
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/frieeze/tezos-delegation/internal/xtz"
+	"github.com/rs/zerolog/log"
+)
+
+// AddAdminRoutes adds the admin routes to the given router.
+// Every admin route is wrapped with the given auth middleware.
+func (h *Handlers) AddAdminRoutes(r *http.ServeMux, auth middleware.Middleware) {
+	r.Handle("DELETE /delegations", auth(http.HandlerFunc(h.EmptyDelegations)))
+	r.Handle("POST /sync/trigger", auth(http.HandlerFunc(h.ManualSync)))
+	r.Handle("PUT /sync/interval", auth(http.HandlerFunc(h.SyncInterval)))
+	r.Handle("POST /admin/backup", auth(http.HandlerFunc(h.Backup)))
+	r.Handle("POST /admin/vacuum", auth(http.HandlerFunc(h.Vacuum)))
+	r.Handle("POST /admin/delegations/import", auth(http.HandlerFunc(h.ImportDelegations)))
+	r.Handle("DELETE /admin/delegations", auth(http.HandlerFunc(h.DeleteDelegations)))
+	r.Handle("GET /admin/checkpoints", auth(http.HandlerFunc(h.Checkpoints)))
+	r.Handle("GET /admin/db/stats", auth(http.HandlerFunc(h.DBStats)))
+}
+
+// EmptyDelegations deletes all delegations from the store.
+func (h *Handlers) EmptyDelegations(w http.ResponseWriter, r *http.Request) {
+	err := h.Store.Empty(r.Context())
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	// request id is already part of the request logger
+	log.Ctx(r.Context()).Warn().
+		Str("key", middleware.KeyPrefix(r.Context())).
+		Msg("store emptied")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type deleteResponse struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// DeleteDelegations deletes the delegations whose ids are listed
+// in the JSON array of the body, e.g. ["1", "2"],
+// and returns the number of deleted delegations.
+func (h *Handlers) DeleteDelegations(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+	err := json.NewDecoder(r.Body).Decode(&ids)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		writeError(w, r, err, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge)
+		return
+	}
+	if err != nil {
+		writeError(w, r, fmt.Errorf("invalid body: %w", err), http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+
+	deleted, err := h.Store.BulkDelete(r.Context(), ids)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	log.Ctx(r.Context()).Warn().
+		Str("key", middleware.KeyPrefix(r.Context())).
+		Int("requested", len(ids)).
+		Int64("deleted", deleted).
+		Msg("delegations deleted")
+
+	err = writeJSON(w, deleteResponse{Deleted: deleted})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// ManualSync triggers an immediate live sync without waiting for it.
+// Triggering while a sync is in progress does nothing.
+func (h *Handlers) ManualSync(w http.ResponseWriter, r *http.Request) {
+	if h.Syncer == nil {
+		writeError(w, r, errors.New("live sync unavailable"), http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+
+	triggered := h.Syncer.SyncNow()
+	log.Ctx(r.Context()).Info().
+		Str("key", middleware.KeyPrefix(r.Context())).
+		Bool("triggered", triggered).
+		Msg("manual sync requested")
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type syncInterval struct {
+	Interval string `json:"interval"`
+}
+
+// SyncInterval changes the live sync interval to the duration of the body,
+// e.g. {"interval":"30s"}
+func (h *Handlers) SyncInterval(w http.ResponseWriter, r *http.Request) {
+	if h.Syncer == nil {
+		writeError(w, r, errors.New("live sync unavailable"), http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+
+	var body syncInterval
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, fmt.Errorf("invalid body: %w", err), http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+	interval, err := time.ParseDuration(body.Interval)
+	if err != nil {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+
+	err = h.Syncer.SetInterval(interval)
+	if errors.Is(err, xtz.ErrInvalidInterval) {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+	log.Ctx(r.Context()).Info().
+		Str("key", middleware.KeyPrefix(r.Context())).
+		Str("interval", interval.String()).
+		Msg("sync interval changed")
+
+	err = writeJSON(w, syncInterval{Interval: interval.String()})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+type backupResponse struct {
+	Path string `json:"path"`
+}
+
+// Backup copies the store to a new file of the backup directory
+// and returns the path of that file.
+func (h *Handlers) Backup(w http.ResponseWriter, r *http.Request) {
+	if h.BackupDir == "" {
+		writeError(w, r, errors.New("backup directory not configured"), http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+
+	path := store.BackupPath(h.BackupDir, time.Now())
+	err := h.Store.Backup(r.Context(), path)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	log.Ctx(r.Context()).Info().
+		Str("key", middleware.KeyPrefix(r.Context())).
+		Str("path", path).
+		Msg("store backed up")
+
+	err = writeJSON(w, backupResponse{Path: path})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// Vacuum reclaims the disk space freed by deletions,
+// writes are blocked while it runs.
+func (h *Handlers) Vacuum(w http.ResponseWriter, r *http.Request) {
+	err := h.Store.Vacuum(r.Context())
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	log.Ctx(r.Context()).Info().
+		Str("key", middleware.KeyPrefix(r.Context())).
+		Msg("store vacuumed")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type checkpointsResponse struct {
+	Data []store.Checkpoint `json:"data"`
+}
+
+// Checkpoints returns every checkpoint, by creation order.
+func (h *Handlers) Checkpoints(w http.ResponseWriter, r *http.Request) {
+	checkpoints, err := h.Store.GetCheckpoints(r.Context())
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	err = writeJSON(w, checkpointsResponse{Data: checkpoints})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// DBStats returns the indexes, the row count of each table
+// and the file size of the database.
+func (h *Handlers) DBStats(w http.ResponseWriter, r *http.Request) {
+	statser, ok := h.Store.(store.DBStatser)
+	if !ok {
+		writeError(w, r, errors.New("database stats unavailable"), http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+	stats, err := statser.DBStats(r.Context())
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	err = writeJSON(w, stats)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// importBatchSize is the number of delegations inserted at once by ImportDelegations
+const importBatchSize = 500
+
+// importDelegation exposes the delegation id, required to import it
+type importDelegation struct {
+	tds.Delegation
+	ID string `json:"id"`
+}
+
+type importResponse struct {
+	Imported          int64 `json:"imported"`
+	SkippedDuplicates int64 `json:"skipped_duplicates"`
+	ValidationErrors  int64 `json:"validation_errors"`
+}
+
+// ImportDelegations inserts the delegations of an application/x-ndjson body,
+// one delegation object with its id per line, in batches of importBatchSize.
+// Invalid delegations are skipped and counted, duplicates are ignored.
+// The batches inserted before an error are kept.
+func (h *Handlers) ImportDelegations(w http.ResponseWriter, r *http.Request) {
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/x-ndjson" {
+		writeError(w, r, errors.New("content type must be application/x-ndjson"), http.StatusUnsupportedMediaType, ErrCodeInvalidParameter)
+		return
+	}
+
+	var res importResponse
+	batch := make([]tds.Delegation, 0, importBatchSize)
+	insert := func() error {
+		// canceled by the client closing the connection
+		n, err := h.Store.InsertCount(r.Context(), batch)
+		if err != nil {
+			return err
+		}
+		res.Imported += n
+		res.SkippedDuplicates += int64(len(batch)) - n
+		batch = batch[:0]
+		return nil
+	}
+
+	dec := json.NewDecoder(r.Body)
+	for line := 1; ; line++ {
+		var d importDelegation
+		err := dec.Decode(&d)
+		if err == io.EOF {
+			break
+		}
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			// the decoder moves past the whole object
+			res.ValidationErrors++
+			continue
+		}
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeError(w, r, err, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge)
+			return
+		}
+		if err != nil {
+			writeError(w, r, fmt.Errorf("invalid delegation %d: %w", line, err), http.StatusBadRequest, ErrCodeInvalidParameter)
+			return
+		}
+
+		d.Delegation.ID = d.ID
+		if err = d.Delegation.Validate(); err != nil {
+			res.ValidationErrors++
+			continue
+		}
+		batch = append(batch, d.Delegation)
+		if len(batch) < importBatchSize {
+			continue
+		}
+		if err = insert(); err != nil {
+			writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+			return
+		}
+	}
+	if err := insert(); err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	log.Ctx(r.Context()).Info().
+		Str("key", middleware.KeyPrefix(r.Context())).
+		Int64("imported", res.Imported).
+		Int64("skipped_duplicates", res.SkippedDuplicates).
+		Int64("validation_errors", res.ValidationErrors).
+		Msg("delegations imported")
+
+	err := writeJSON(w, res)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
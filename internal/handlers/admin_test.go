@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/middleware"
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/frieeze/tezos-delegation/internal/xtz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSyncer struct {
+	calls    int
+	interval time.Duration
+}
+
+func (s *fakeSyncer) SyncNow() bool {
+	s.calls++
+	return true
+}
+
+func (s *fakeSyncer) SetInterval(d time.Duration) error {
+	if d < xtz.MinInterval {
+		return xtz.ErrInvalidInterval
+	}
+	s.interval = d
+	return nil
+}
+
+func Test_ManualSync(t *testing.T) {
+	syncer := &fakeSyncer{}
+	h := Handlers{Syncer: syncer}
+
+	req := httptest.NewRequest("POST", "/sync/trigger", nil)
+	rec := httptest.NewRecorder()
+	h.ManualSync(rec, req)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, 1, syncer.calls)
+}
+
+func Test_ManualSync_noSyncer(t *testing.T) {
+	h := Handlers{}
+	req := httptest.NewRequest("POST", "/sync/trigger", nil)
+	rec := httptest.NewRecorder()
+	h.ManualSync(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, ErrCodeInternalError, errorCode(t, rec))
+}
+
+func Test_SyncInterval(t *testing.T) {
+	syncer := &fakeSyncer{}
+	h := Handlers{Syncer: syncer}
+
+	req := httptest.NewRequest("PUT", "/sync/interval", strings.NewReader(`{"interval":"30s"}`))
+	rec := httptest.NewRecorder()
+	h.SyncInterval(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"interval":"30s"}`, rec.Body.String())
+	assert.Equal(t, 30*time.Second, syncer.interval)
+
+	for _, body := range []string{`{"interval":"5s"}`, `{"interval":"soon"}`, `{"interval":30}`, `not json`} {
+		req = httptest.NewRequest("PUT", "/sync/interval", strings.NewReader(body))
+		rec = httptest.NewRecorder()
+		h.SyncInterval(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec), body)
+	}
+	assert.Equal(t, 30*time.Second, syncer.interval)
+}
+
+func Test_DeleteDelegations(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	h := Handlers{Store: s}
+
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+		{ID: "2", Timestamp: "2024-01-02T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "2"},
+	}))
+
+	rec := httptest.NewRecorder()
+	h.DeleteDelegations(rec, httptest.NewRequest("DELETE", "/admin/delegations", strings.NewReader(`[]`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"deleted":0}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	h.DeleteDelegations(rec, httptest.NewRequest("DELETE", "/admin/delegations", strings.NewReader(`["1","3"]`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"deleted":1}`, rec.Body.String())
+
+	count, err := s.CountByYear(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	for _, body := range []string{`not json`, `[1,2]`, `{"ids":["2"]}`} {
+		rec = httptest.NewRecorder()
+		h.DeleteDelegations(rec, httptest.NewRequest("DELETE", "/admin/delegations", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec), body)
+	}
+}
+
+func Test_Backup(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+
+	h := Handlers{Store: s, BackupDir: t.TempDir()}
+	req := httptest.NewRequest("POST", "/admin/backup", nil)
+	rec := httptest.NewRecorder()
+	h.Backup(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp backupResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.FileExists(t, resp.Path)
+	assert.Equal(t, h.BackupDir, filepath.Dir(resp.Path))
+}
+
+func Test_Backup_noDir(t *testing.T) {
+	h := Handlers{}
+	req := httptest.NewRequest("POST", "/admin/backup", nil)
+	rec := httptest.NewRecorder()
+	h.Backup(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, ErrCodeInternalError, errorCode(t, rec))
+}
+
+func Test_Vacuum(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), filepath.Join(t.TempDir(), "delegations.db"))
+	require.NoError(t, err)
+	defer s.Close()
+	h := Handlers{Store: s}
+
+	rec := httptest.NewRecorder()
+	h.Vacuum(rec, httptest.NewRequest("POST", "/admin/vacuum", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	require.NoError(t, s.Close())
+	rec = httptest.NewRecorder()
+	h.Vacuum(rec, httptest.NewRequest("POST", "/admin/vacuum", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, ErrCodeStoreUnavailable, errorCode(t, rec))
+}
+
+func Test_Checkpoints(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	h := Handlers{Store: s}
+
+	rec := httptest.NewRecorder()
+	h.Checkpoints(rec, httptest.NewRequest("GET", "/admin/checkpoints", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[]}`, rec.Body.String())
+
+	require.NoError(t, s.CreateCheckpoint(context.Background(), "backfill", "2024-01-01T00:00:00Z"))
+	rec = httptest.NewRecorder()
+	h.Checkpoints(rec, httptest.NewRequest("GET", "/admin/checkpoints", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var resp checkpointsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 1)
+	assert.Equal(t, "backfill", resp.Data[0].Label)
+	assert.Equal(t, "2024-01-01T00:00:00Z", resp.Data[0].Timestamp)
+
+	require.NoError(t, s.Close())
+	rec = httptest.NewRecorder()
+	h.Checkpoints(rec, httptest.NewRequest("GET", "/admin/checkpoints", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, ErrCodeStoreUnavailable, errorCode(t, rec))
+}
+
+func Test_DBStats(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+	}))
+
+	rec := httptest.NewRecorder()
+	(&Handlers{Store: s}).DBStats(rec, httptest.NewRequest("GET", "/admin/db/stats", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var stats store.DBStats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	assert.Equal(t, int64(1), stats.RowCounts["delegations"])
+	assert.NotEmpty(t, stats.Indexes)
+
+	// stores without database stats
+	rec = httptest.NewRecorder()
+	(&Handlers{Store: struct{ store.Store }{s}}).DBStats(rec, httptest.NewRequest("GET", "/admin/db/stats", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, ErrCodeInternalError, errorCode(t, rec))
+}
+
+// ndjson returns n valid delegation lines with ids starting at first
+func ndjson(first, n int) string {
+	var b strings.Builder
+	for i := first; i < first+n; i++ {
+		fmt.Fprintf(&b, `{"id":"%d","timestamp":"2024-01-01T00:00:00Z","delegator":"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","amount":"1","level":"%d"}`+"\n", i, i)
+	}
+	return b.String()
+}
+
+func importRequest(body string) *http.Request {
+	req := httptest.NewRequest("POST", "/admin/delegations/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	return req
+}
+
+func Test_ImportDelegations(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	h := Handlers{Store: s}
+
+	// the first imported delegation is a duplicate
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+	}))
+	// more than two batches, and two invalid delegations
+	body := ndjson(1, 2*importBatchSize+100) +
+		`{"id":"invalid","timestamp":"yesterday","delegator":"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","amount":"1","level":"1"}` + "\n" +
+		`{"id":"number","timestamp":"2024-01-01T00:00:00Z","delegator":"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","amount":1,"level":"1"}` + "\n"
+
+	rec := httptest.NewRecorder()
+	h.ImportDelegations(rec, importRequest(body))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"imported":1099,"skipped_duplicates":1,"validation_errors":2}`, rec.Body.String())
+
+	count, err := s.CountByYear(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2*importBatchSize+100), count)
+}
+
+func Test_ImportDelegations_errors(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	h := Handlers{Store: s}
+
+	req := importRequest(ndjson(1, 1))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ImportDelegations(rec, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ImportDelegations(rec, importRequest(ndjson(1, 1)+"not json\n"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec))
+
+	// capped by the request size limit
+	req = importRequest(ndjson(1, 10))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	middleware.RequestSizeLimit(100)(http.HandlerFunc(h.ImportDelegations)).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, ErrCodePayloadTooLarge, errorCode(t, rec))
+
+	// canceled by the client
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec = httptest.NewRecorder()
+	h.ImportDelegations(rec, importRequest(ndjson(1, 1)).WithContext(ctx))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -1,44 +1,602 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/frieeze/tezos-delegation/internal/tezos"
+	"github.com/rs/zerolog/log"
 )
 
 // AddXTZRoutes adds all the routes for the XTZ API
 func (h *Handlers) AddXTZRoutes() *http.ServeMux {
 	r := http.NewServeMux()
-	r.HandleFunc("GET /delegations", h.Delegations)
+	for _, route := range []struct {
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"/delegations", h.Delegations},
+		{"/delegations/events", h.DelegationsStream},
+		{"/delegations/export.csv", h.DelegationsCSV},
+		{"/delegations/first", h.FirstDelegation},
+		{"/delegations/frequency", h.DelegationFrequency},
+		{"/delegations/activity", h.DelegationActivity},
+		{"/delegations/histogram", h.DelegationHistogram},
+		{"/delegations/delta", h.DelegationsDelta},
+		{"/delegations/years", h.DelegationYears},
+		{"/delegations/year/{year}", h.YearPage},
+		{"/delegations/year/{year}/stats", h.YearStats},
+		{"/delegators/{address}/stats", h.DelegatorStats},
+		{"/delegators/{address}/history", h.DelegatorHistory},
+		{"/delegators/top", h.TopDelegators},
+	} {
+		r.HandleFunc("GET "+route.path, route.handler)
+		// the pattern without a method catches the other methods of the route
+		r.Handle(route.path, methodNotAllowed(r))
+	}
+	// a GET pattern would conflict with the catch-all patterns above,
+	// DelegationByID rejects the other methods itself
+	r.HandleFunc("/delegations/{id}", h.DelegationByID)
+	r.Handle("/", NotFound())
 
 	return r
 }
 
+// maxYears caps the number of years, queried concurrently, of a single request
+const maxYears = 5
+
 // Delegations returns all delegations for a given year
 // or the current year if no year is provided.
+// year also accepts a comma separated list of up to maxYears years.
+// month restricts them to a month of those years.
+// sort orders them by ascending ("asc") or descending ("desc", default) timestamps.
+// baker only keeps the delegations to this baker.
+// min_level and max_level return the delegations of a level range instead.
+// ts returns the delegations of an exact second instead.
+// since returns the delegations of the last duration instead.
+// after and limit return a single year page by page.
+// Responses carry an ETag, a matching If-None-Match gets a 304.
+// With StrictYears the years must have stored delegations.
 func (h *Handlers) Delegations(w http.ResponseWriter, r *http.Request) {
-	// get year from query
-	year := r.URL.Query().Get("year")
-	if year == "" {
-		year = time.Now().Format("2006")
+	q := r.URL.Query()
+	if q.Has("min_level") || q.Has("max_level") {
+		h.delegationsByLevel(w, r)
+		return
+	}
+	if q.Has("ts") {
+		h.delegationsByTimestamp(w, r)
+		return
+	}
+	// since replaces the years
+	if q.Has("since") {
+		h.delegationsSince(w, r)
+		return
+	}
+
+	// get years from query
+	years := splitYears(q.Get("year"))
+	if len(years) == 0 {
+		years = []string{time.Now().Format("2006")}
+	}
+	if len(years) > maxYears {
+		writeError(w, r, fmt.Errorf("%d years: at most %d years can be requested", len(years), maxYears), http.StatusBadRequest, ErrCodeInvalidYear)
+		return
+	}
+	if status, code, err := h.checkYears(r.Context(), years); err != nil {
+		writeError(w, r, err, status, code)
+		return
+	}
+
+	// conditional GET
+	cacheTags := make([]string, len(years))
+	for i, year := range years {
+		cacheTag, err := h.Store.CacheTag(r.Context(), year)
+		if err != nil {
+			writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+			return
+		}
+		cacheTags[i] = cacheTag
+	}
+	tag := etag(r, strings.Join(cacheTags, ","))
+	if notModified(r, tag) {
+		w.Header().Set("ETag", tag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	f := store.DelegationFilter{
+		SortOrder: q.Get("sort"),
+	}
+	if q.Has("month") {
+		month := q.Get("month")
+		f.Month = &month
+	}
+	if q.Has("baker") {
+		baker := q.Get("baker")
+		if err := tezos.ValidateAddress(baker); err != nil {
+			writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+			return
+		}
+		f.Baker = &baker
+	}
+
+	if q.Has("after") || q.Has("limit") {
+		h.delegationsPage(w, r, years, f, tag)
+		return
+	}
+
+	// a single year is streamed from the store cursor
+	if len(years) == 1 {
+		f.Year = &years[0]
+		it, err := h.Store.QueryIter(r.Context(), f)
+		if errors.Is(err, store.ErrInvalidSort) || errors.Is(err, store.ErrInvalidMonth) {
+			writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+			return
+		}
+		if err != nil {
+			writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+			return
+		}
+		defer it.Close()
+
+		w.Header().Set("ETag", tag)
+		// the status is sent with the first bytes, errors can only be logged from there
+		if err := writeJSONStream(w, it); err != nil {
+			log.Ctx(r.Context()).Error().Err(err).Str("path", r.URL.Path).Msg("delegations stream interrupted")
+		}
+		return
 	}
 
 	// get delegations
-	delegations, err := h.Store.GetByYear(r.Context(), year)
+	delegations, err := h.queryYears(r.Context(), years, f)
+	if errors.Is(err, store.ErrInvalidSort) || errors.Is(err, store.ErrInvalidMonth) {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
 	if err != nil {
-		writeError(w, r, err, http.StatusInternalServerError)
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
 		return
 	}
 
 	// render delegations
+	w.Header().Set("ETag", tag)
+	err = writeJSON(w, delegationResponse{Data: delegations})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 1000
+	// maxPageNumber keeps the offset of a numbered page in range
+	maxPageNumber = 1_000_000
+)
+
+type pageResponse struct {
+	Data       tds.DelegationSlice `json:"data"`
+	NextCursor string              `json:"next_cursor"`
+	HasMore    bool                `json:"has_more"`
+}
+
+// delegationsPage returns the page of the delegations of the year
+// after the after cursor, an empty cursor starts from the first page.
+// limit (default 50, up to 1000) caps the number of delegations
+// next_cursor is the after value of the next page
+func (h *Handlers) delegationsPage(w http.ResponseWriter, r *http.Request, years []string, f store.DelegationFilter, tag string) {
+	q := r.URL.Query()
+	if len(years) > 1 {
+		writeError(w, r, errors.New("pages cover a single year"), http.StatusBadRequest, ErrCodeInvalidYear)
+		return
+	}
+	f.Year = &years[0]
+	f.After = q.Get("after")
+	f.Limit = defaultPageLimit
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			writeError(w, r, fmt.Errorf("limit must be between 1 and %d", maxPageLimit), http.StatusBadRequest, ErrCodeInvalidParameter)
+			return
+		}
+		f.Limit = limit
+	}
+
+	page, err := h.Store.GetPage(r.Context(), f)
+	if errors.Is(err, store.ErrInvalidSort) || errors.Is(err, store.ErrInvalidMonth) || errors.Is(err, store.ErrInvalidCursor) {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	w.Header().Set("ETag", tag)
+	err = writeJSON(w, pageResponse{Data: page.Items, NextCursor: page.NextCursor, HasMore: page.HasMore})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+type yearPageResponse struct {
+	Data  tds.DelegationSlice `json:"data"`
+	Page  int                 `json:"page"`
+	Limit int                 `json:"limit"`
+	// Total is the number of delegations of the year
+	Total int64 `json:"total"`
+}
+
+// YearPage returns a numbered page of the delegations of the year given in the path,
+// most recent first, along with the number of delegations of the year
+// page starts at 1 (default), limit (default 50, up to 1000) caps the page size
+// With StrictYears the year must have stored delegations.
+func (h *Handlers) YearPage(w http.ResponseWriter, r *http.Request) {
+	year := r.PathValue("year")
+	if status, code, err := h.checkYears(r.Context(), []string{year}); err != nil {
+		writeError(w, r, err, status, code)
+		return
+	}
+
+	q := r.URL.Query()
+	page := 1
+	if v := q.Get("page"); v != "" {
+		var err error
+		page, err = strconv.Atoi(v)
+		if err != nil || page < 1 || page > maxPageNumber {
+			writeError(w, r, fmt.Errorf("page must be between 1 and %d", maxPageNumber), http.StatusBadRequest, ErrCodeInvalidParameter)
+			return
+		}
+	}
+	limit := defaultPageLimit
+	if v := q.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			writeError(w, r, fmt.Errorf("limit must be between 1 and %d", maxPageLimit), http.StatusBadRequest, ErrCodeInvalidParameter)
+			return
+		}
+	}
+
+	delegations, total, err := h.Store.GetByYearWithCount(r.Context(), year, limit, (page-1)*limit)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	err = writeJSON(w, yearPageResponse{Data: delegations, Page: page, Limit: limit, Total: total})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// splitYears splits a comma separated list of years,
+// ignoring empty and repeated values
+func splitYears(list string) []string {
+	var years []string
+	for _, year := range strings.Split(list, ",") {
+		year = strings.TrimSpace(year)
+		if year != "" && !slices.Contains(years, year) {
+			years = append(years, year)
+		}
+	}
+	return years
+}
+
+// queryYears runs the filter for each year concurrently
+// and merges the results in the order of the filter
+func (h *Handlers) queryYears(ctx context.Context, years []string, f store.DelegationFilter) (tds.DelegationSlice, error) {
+	results := make([]tds.DelegationSlice, len(years))
+	errs := make([]error, len(years))
+	var wg sync.WaitGroup
+	for i := range years {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			yf := f
+			yf.Year = &years[i]
+			results[i], errs[i] = h.Store.Query(ctx, yf)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	merged := tds.DelegationSlice(slices.Concat(results...)).SortByTimestamp()
+	if f.SortOrder != store.SortAsc {
+		slices.Reverse(merged)
+	}
+	return merged, nil
+}
+
+type firstDelegationResponse struct {
+	Data *tds.Delegation `json:"data"`
+}
+
+// FirstDelegation returns the earliest stored delegation
+func (h *Handlers) FirstDelegation(w http.ResponseWriter, r *http.Request) {
+	first, err := h.Store.GetFirst(r.Context())
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+	if first == nil {
+		writeError(w, r, errors.New("no delegation stored"), http.StatusNotFound, ErrCodeNotFound)
+		return
+	}
+
+	err = writeJSON(w, firstDelegationResponse{Data: first})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// DelegationByID returns the delegation with the id of the path
+func (h *Handlers) DelegationByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		MethodNotAllowed().ServeHTTP(w, r)
+		return
+	}
+	d, err := h.Store.GetByID(r.Context(), r.PathValue("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, r, err, http.StatusNotFound, ErrCodeNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	err = writeJSON(w, firstDelegationResponse{Data: d})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// delegationsByLevel returns the delegations between min_level and max_level,
+// a missing bound leaves the range open.
+func (h *Handlers) delegationsByLevel(w http.ResponseWriter, r *http.Request) {
+	minLevel, maxLevel := r.URL.Query().Get("min_level"), r.URL.Query().Get("max_level")
+	if minLevel == "" {
+		minLevel = "0"
+	}
+	if maxLevel == "" {
+		maxLevel = strconv.FormatInt(math.MaxInt64, 10)
+	}
+
+	delegations, err := h.Store.GetByLevelRange(r.Context(), minLevel, maxLevel)
+	if errors.Is(err, store.ErrInvalidLevel) {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
 	err = writeJSON(w, delegationResponse{Data: delegations})
 	if err != nil {
-		writeError(w, r, err, http.StatusInternalServerError)
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
 		return
 	}
 }
 
+// delegationsByTimestamp returns the delegations made at the RFC3339 ts second,
+// usually the delegations of a single block
+func (h *Handlers) delegationsByTimestamp(w http.ResponseWriter, r *http.Request) {
+	ts, err := time.Parse(time.RFC3339, r.URL.Query().Get("ts"))
+	if err != nil {
+		writeError(w, r, fmt.Errorf("ts must be an RFC3339 timestamp: %w", err), http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+
+	// timestamps are stored in UTC, to the second
+	delegations, err := h.Store.GetByTimestamp(r.Context(), ts.UTC().Format("2006-01-02T15:04:05Z"))
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	err = writeJSON(w, delegationResponse{Data: delegations})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// parseSince parses a positive Go duration, or a number of days such as "7d"
+func parseSince(since string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(since, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("since %q: invalid number of days", since)
+		}
+		since = strconv.Itoa(n*24) + "h"
+	}
+	d, err := time.ParseDuration(since)
+	if err != nil {
+		return 0, fmt.Errorf("since must be a duration such as 30m, 24h or 7d: %w", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("since %q: must be positive", since)
+	}
+	return d, nil
+}
+
+// delegationsSince returns the delegations made during the last since duration
+func (h *Handlers) delegationsSince(w http.ResponseWriter, r *http.Request) {
+	d, err := parseSince(r.URL.Query().Get("since"))
+	if err != nil {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+
+	from := time.Now().Add(-d)
+	delegations, err := h.Store.Query(r.Context(), store.DelegationFilter{
+		From:      &from,
+		SortOrder: r.URL.Query().Get("sort"),
+	})
+	if errors.Is(err, store.ErrInvalidSort) {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	err = writeJSON(w, delegationResponse{Data: delegations})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+type yearsResponse struct {
+	Data []string `json:"data"`
+}
+
+// DelegationYears returns the years having stored delegations, most recent first
+func (h *Handlers) DelegationYears(w http.ResponseWriter, r *http.Request) {
+	years, err := h.Store.GetDistinctYears(r.Context())
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	err = writeJSON(w, yearsResponse{Data: years})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// firstYear is the year of the Tezos genesis, tzkt has no older data
+const firstYear = 2018
+
+var yearFormat = regexp.MustCompile(`^[0-9]{4}$`)
+
+// validateYear checks that year is a four digit year
+// between the Tezos genesis and the current year
+func validateYear(year string) error {
+	if !yearFormat.MatchString(year) {
+		return fmt.Errorf("year %q: must be in the format YYYY", year)
+	}
+	y, _ := strconv.Atoi(year)
+	if current := time.Now().Year(); y < firstYear || y > current {
+		return fmt.Errorf("year %d: must be between %d and %d", y, firstYear, current)
+	}
+	return nil
+}
+
+// checkYears validates the requested years, with StrictYears
+// they must have stored delegations instead of being valid years
+// Returns the status and code of the error response on failure
+func (h *Handlers) checkYears(ctx context.Context, years []string) (int, ErrorCode, error) {
+	for _, year := range years {
+		if !h.StrictYears {
+			if err := validateYear(year); err != nil {
+				return http.StatusBadRequest, ErrCodeInvalidYear, err
+			}
+			continue
+		}
+		stored, err := h.storedYear(ctx, year)
+		if err != nil {
+			return http.StatusInternalServerError, ErrCodeStoreUnavailable, err
+		}
+		if !stored {
+			return http.StatusBadRequest, ErrCodeInvalidYear, fmt.Errorf("year %q: no stored delegation", year)
+		}
+	}
+	return http.StatusOK, "", nil
+}
+
+// storedYear reports whether year has stored delegations
+func (h *Handlers) storedYear(ctx context.Context, year string) (bool, error) {
+	years, err := h.Store.GetDistinctYears(ctx)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(years, year), nil
+}
+
 type delegationResponse struct {
-	Data []tds.Delegation `json:"data"`
+	Data tds.DelegationSlice `json:"data"`
+}
+
+const (
+	defaultDeltaLimit = 1000
+	maxDeltaLimit     = 10000
+)
+
+type deltaResponse struct {
+	Data       tds.DelegationSlice `json:"data"`
+	NextCursor string              `json:"next_cursor"`
+}
+
+// DelegationsDelta returns the delegations of the year given in the query,
+// or the current year, with an id greater than the since cursor, by ascending ids.
+// limit (default 1000, up to 10000) caps the number of delegations
+// next_cursor is the since value of the next request
+func (h *Handlers) DelegationsDelta(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	year := q.Get("year")
+	if year == "" {
+		year = time.Now().Format("2006")
+	}
+	if err := validateYear(year); err != nil {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidYear)
+		return
+	}
+
+	limit := defaultDeltaLimit
+	if v := q.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxDeltaLimit {
+			writeError(w, r, fmt.Errorf("limit must be between 1 and %d", maxDeltaLimit), http.StatusBadRequest, ErrCodeInvalidParameter)
+			return
+		}
+	}
+
+	since := q.Get("since")
+	delegations, err := h.Store.GetDelta(r.Context(), year, since, limit)
+	if errors.Is(err, store.ErrInvalidCursor) {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	// without new delegations the cursor stays the same
+	next := since
+	if len(delegations) > 0 {
+		next = delegations[len(delegations)-1].ID
+	}
+	err = writeJSON(w, deltaResponse{Data: delegations, NextCursor: next})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
 }
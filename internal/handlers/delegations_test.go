@@ -0,0 +1,658 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errorCode decodes the error code of an error response
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) ErrorCode {
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, rec.Code, resp.Code)
+	assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+	return resp.ErrorCode
+}
+
+func Test_Delegations_store_unavailable(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	rec := httptest.NewRecorder()
+	(&Handlers{Store: s}).AddXTZRoutes().ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year=2024", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, ErrCodeStoreUnavailable, errorCode(t, rec))
+}
+
+func Test_Delegations_year(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	current := time.Now().Year()
+	tests := []struct {
+		year string
+		want int
+	}{
+		{year: "2018", want: http.StatusOK},
+		{year: strconv.Itoa(current), want: http.StatusOK},
+		{year: "", want: http.StatusOK},
+		{year: "abcd", want: http.StatusBadRequest},
+		{year: "202", want: http.StatusBadRequest},
+		{year: "20245", want: http.StatusBadRequest},
+		{year: "2017", want: http.StatusBadRequest},
+		{year: strconv.Itoa(current + 1), want: http.StatusBadRequest},
+		{year: "2024'; DROP TABLE delegations", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year="+url.QueryEscape(tt.year), nil))
+		assert.Equal(t, tt.want, rec.Code, tt.year)
+		if tt.want == http.StatusBadRequest {
+			assert.Equal(t, ErrCodeInvalidYear, errorCode(t, rec), tt.year)
+		}
+	}
+}
+
+func Test_Delegations_strictYears(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2019-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "100", Level: "10"},
+	})
+	require.NoError(t, err)
+	routes := (&Handlers{Store: s, StrictYears: true}).AddXTZRoutes()
+
+	for year, want := range map[string]int{
+		"2019": http.StatusOK,
+		"2018": http.StatusBadRequest,
+		"":     http.StatusBadRequest,
+		"abcd": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year="+year, nil))
+		assert.Equal(t, want, rec.Code, year)
+		if want == http.StatusBadRequest {
+			assert.Equal(t, ErrCodeInvalidYear, errorCode(t, rec), year)
+		}
+	}
+}
+
+func Test_Delegations_multipleYears(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2022-06-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "10"},
+		{ID: "2", Timestamp: "2023-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "2", Level: "20"},
+		{ID: "3", Timestamp: "2024-06-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "3", Level: "30"},
+		{ID: "4", Timestamp: "2023-12-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "4", Level: "40"},
+	})
+	require.NoError(t, err)
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	levels := func(rec *httptest.ResponseRecorder) []string {
+		var resp delegationResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		var levels []string
+		for _, d := range resp.Data {
+			levels = append(levels, d.Level)
+		}
+		return levels
+	}
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year=2023,2024", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"30", "40", "20"}, levels(rec))
+	tag := rec.Header().Get("ETag")
+	assert.NotEmpty(t, tag)
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year=2024,2022,2023&sort=asc", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"10", "20", "40", "30"}, levels(rec))
+
+	// a change in any of the years changes the tag
+	req := httptest.NewRequest("GET", "/delegations?year=2023,2024", nil)
+	req.Header.Set("If-None-Match", tag)
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	_, err = s.BulkDelete(context.Background(), []string{"2"})
+	require.NoError(t, err)
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	for _, query := range []string{"year=2023,2017", "year=2018,2019,2020,2021,2022,2023"} {
+		rec = httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		assert.Equal(t, ErrCodeInvalidYear, errorCode(t, rec), query)
+	}
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year=2023,2024&sort=up", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec))
+}
+
+func Test_Delegations_page(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2023-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "10"},
+		{ID: "2", Timestamp: "2023-02-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "2", Level: "20"},
+		{ID: "3", Timestamp: "2023-03-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "3", Level: "30"},
+	})
+	require.NoError(t, err)
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	get := func(query string) pageResponse {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?"+query, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp pageResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+
+	page := get("year=2023&limit=2")
+	if assert.Len(t, page.Data, 2) {
+		assert.Equal(t, "30", page.Data[0].Level)
+		assert.Equal(t, "20", page.Data[1].Level)
+	}
+	assert.True(t, page.HasMore)
+	assert.Equal(t, "2", page.NextCursor)
+
+	page = get("year=2023&limit=2&after=" + page.NextCursor)
+	if assert.Len(t, page.Data, 1) {
+		assert.Equal(t, "10", page.Data[0].Level)
+	}
+	assert.False(t, page.HasMore)
+	assert.Empty(t, page.NextCursor)
+
+	// an empty cursor starts from the beginning, with the default limit
+	page = get("year=2023&after=")
+	assert.Len(t, page.Data, 3)
+	assert.False(t, page.HasMore)
+
+	for query, code := range map[string]ErrorCode{
+		"year=2023&limit=0":         ErrCodeInvalidParameter,
+		"year=2023&limit=1001":      ErrCodeInvalidParameter,
+		"year=2023&limit=2&sort=up": ErrCodeInvalidParameter,
+		"year=2023,2024&limit=2":    ErrCodeInvalidYear,
+		"year=2023&after=42":        ErrCodeInvalidParameter,
+	} {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		assert.Equal(t, code, errorCode(t, rec), query)
+	}
+}
+
+func Test_DelegationYears(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/years", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[]}`, rec.Body.String())
+
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2022-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "100", Level: "10"},
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "20"},
+		{ID: "3", Timestamp: "2023-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "30"},
+	})
+	require.NoError(t, err)
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/years", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":["2024","2023","2022"]}`, rec.Body.String())
+
+	require.NoError(t, s.Close())
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/years", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, ErrCodeStoreUnavailable, errorCode(t, rec))
+}
+
+func Test_Delegations_sort(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "100", Level: "10"},
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "20"},
+	})
+	require.NoError(t, err)
+
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year=2024&sort=asc", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[
+		{"timestamp":"2024-01-01T00:00:00Z","delegator":"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","amount":"100","level":"10"},
+		{"timestamp":"2024-02-01T00:00:00Z","delegator":"tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb","amount":"10","level":"20"}
+	]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year=2024", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[
+		{"timestamp":"2024-02-01T00:00:00Z","delegator":"tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb","amount":"10","level":"20"},
+		{"timestamp":"2024-01-01T00:00:00Z","delegator":"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","amount":"100","level":"10"}
+	]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year=2024&month=02", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[
+		{"timestamp":"2024-02-01T00:00:00Z","delegator":"tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb","amount":"10","level":"20"}
+	]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year=2024&month=13", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec))
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year=2024&sort=random", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec))
+}
+
+func Test_Delegations_levelRange(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "100", Level: "10"},
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "20"},
+		{ID: "3", Timestamp: "2024-03-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "20", Level: "30"},
+	})
+	require.NoError(t, err)
+
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?min_level=20", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[
+		{"timestamp":"2024-03-01T00:00:00Z","delegator":"tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb","amount":"20","level":"30"},
+		{"timestamp":"2024-02-01T00:00:00Z","delegator":"tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb","amount":"10","level":"20"}
+	]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?min_level=10&max_level=15", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[
+		{"timestamp":"2024-01-01T00:00:00Z","delegator":"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","amount":"100","level":"10"}
+	]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?max_level=abc", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec))
+}
+
+func Test_Delegations_baker(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	const baker = "tz1KhjVyh7yc6197M5iZqnpn7u7aDSoqWB4R"
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2023-06-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "100", Level: "10", Baker: baker},
+		{ID: "2", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "100", Level: "20", Baker: baker},
+		{ID: "3", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "30", Baker: "tz1otherTTTTTTTTTTTTTTTTTTTTTTTTTTTT"},
+	})
+	require.NoError(t, err)
+
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year=2024&baker="+baker, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[
+		{"timestamp":"2024-01-01T00:00:00Z","delegator":"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","amount":"100","level":"20","baker":"`+baker+`"}
+	]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year=2023,2024&baker="+baker, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var resp delegationResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Len(t, resp.Data, 2)
+
+	for _, query := range []string{"year=2024&baker=", "year=2024&baker=tz1other"} {
+		rec = httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec), query)
+	}
+}
+
+func Test_Delegations_timestamp(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-10-29T10:22:25Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "100", Level: "10"},
+		{ID: "2", Timestamp: "2024-10-29T10:22:25Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "10"},
+		{ID: "3", Timestamp: "2024-10-29T10:22:26Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "20", Level: "11"},
+	})
+	require.NoError(t, err)
+
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	for _, ts := range []string{"2024-10-29T10:22:25Z", "2024-10-29T12:22:25%2B02:00"} {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?ts="+ts, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, ts)
+		assert.JSONEq(t, `{"data":[
+			{"timestamp":"2024-10-29T10:22:25Z","delegator":"tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb","amount":"10","level":"10"},
+			{"timestamp":"2024-10-29T10:22:25Z","delegator":"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","amount":"100","level":"10"}
+		]}`, rec.Body.String(), ts)
+	}
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?ts=2024-10-29T10:22:27Z", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[]}`, rec.Body.String())
+
+	for _, ts := range []string{"", "2024-10-29", "yesterday"} {
+		rec = httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?ts="+ts, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, ts)
+		assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec), ts)
+	}
+}
+
+func Test_Delegations_since(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	ago := func(d time.Duration) string {
+		return time.Now().Add(-d).UTC().Format(time.RFC3339)
+	}
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: ago(48 * time.Hour), Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+		{ID: "2", Timestamp: ago(2 * time.Hour), Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "2", Level: "2"},
+		{ID: "3", Timestamp: ago(30 * time.Minute), Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "3", Level: "3"},
+		{ID: "4", Timestamp: ago(time.Minute), Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "4", Level: "4"},
+	})
+	require.NoError(t, err)
+
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	for query, levels := range map[string][]string{
+		"since=1h":           {"4", "3"},
+		"since=3h&sort=asc":  {"2", "3", "4"},
+		"since=7d":           {"4", "3", "2", "1"},
+		"since=1h&year=2018": {"4", "3"},
+		"since=30s":          {},
+		"since=1d":           {"4", "3", "2"},
+	} {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?"+query, nil))
+		require.Equal(t, http.StatusOK, rec.Code, query)
+		var resp delegationResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), query)
+		got := []string{}
+		for _, d := range resp.Data {
+			got = append(got, d.Level)
+		}
+		assert.Equal(t, levels, got, query)
+	}
+
+	for _, since := range []string{"", "yesterday", "-1h", "0s", "xd"} {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?since="+since, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, since)
+		assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec), since)
+	}
+}
+
+func Test_FirstDelegation(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/first", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, ErrCodeNotFound, errorCode(t, rec))
+
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "20"},
+		{ID: "1", Timestamp: "2018-07-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "5", Level: "10"},
+	}))
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/first", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":
+		{"timestamp":"2018-07-01T00:00:00Z","delegator":"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","amount":"5","level":"10"}
+	}`, rec.Body.String())
+}
+
+func Test_DelegationByID(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{
+		{ID: "42", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "20"},
+	}))
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/42", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":
+		{"timestamp":"2024-02-01T00:00:00Z","delegator":"tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb","amount":"10","level":"20"}
+	}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/43", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, ErrCodeNotFound, errorCode(t, rec))
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("POST", "/delegations/42", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	// named routes take precedence over the id
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/first", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("POST", "/delegations/first", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func Test_Delegations_etag(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "5", Level: "10"},
+	}))
+
+	get := func(query, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/delegations?"+query, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("year=2024", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	tag := rec.Header().Get("ETag")
+	require.NotEmpty(t, tag)
+
+	rec = get("year=2024", tag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, tag, rec.Header().Get("ETag"))
+
+	rec = get("year=2024", `"other", W/`+tag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	// other parameters select other data
+	rec = get("year=2024&sort=asc", tag)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, tag, rec.Header().Get("ETag"))
+
+	// a new delegation changes the tag
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "20"},
+	}))
+	rec = get("year=2024", tag)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, tag, rec.Header().Get("ETag"))
+}
+
+func Test_DelegationsDelta(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "5", Level: "10"},
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "20"},
+	}))
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/delta?year=2024&limit=1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[
+		{"timestamp":"2024-01-01T00:00:00Z","delegator":"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","amount":"5","level":"10"}
+	],"next_cursor":"1"}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/delta?year=2024&since=1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[
+		{"timestamp":"2024-02-01T00:00:00Z","delegator":"tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb","amount":"10","level":"20"}
+	],"next_cursor":"2"}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/delta?year=2024&since=2", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[],"next_cursor":"2"}`, rec.Body.String())
+
+	for _, query := range []string{"since=abc", "limit=0", "limit=10001", "year=2017"} {
+		rec = httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/delta?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func Test_Delegations_stream(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year=2022", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "{\"data\":[]}\n", rec.Body.String())
+
+	delegations := make([]tds.Delegation, 2*jsonFlushRows+1)
+	for i := range delegations {
+		delegations[i] = tds.Delegation{
+			ID:        strconv.Itoa(i + 1),
+			Timestamp: "2022-05-01T00:00:00Z",
+			Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			Amount:    "1",
+			Level:     strconv.Itoa(i + 1),
+		}
+	}
+	require.NoError(t, s.Insert(context.Background(), delegations))
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations?year=2022", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.NotEmpty(t, rec.Header().Get("ETag"))
+	assert.True(t, rec.Flushed)
+
+	var resp delegationResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Len(t, resp.Data, len(delegations))
+	assert.Equal(t, "201", resp.Data[0].Level)
+}
+
+func Test_YearPage(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "2", Level: "2"},
+		{ID: "3", Timestamp: "2024-03-01T00:00:00Z", Delegator: "tz1ccccccccccccccccccccccccccccccccc", Amount: "3", Level: "3"},
+		{ID: "4", Timestamp: "2023-03-01T00:00:00Z", Delegator: "tz1ddddddddddddddddddddddddddddddddd", Amount: "4", Level: "4"},
+	})
+	require.NoError(t, err)
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/year/2024?page=2&limit=2", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"data": [{"timestamp":"2024-01-01T00:00:00Z","delegator":"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","amount":"1","level":"1"}],
+		"page": 2,
+		"limit": 2,
+		"total": 3
+	}`, rec.Body.String())
+
+	// past the last page the total is still returned
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/year/2024?page=5", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[],"page":5,"limit":50,"total":3}`, rec.Body.String())
+
+	for _, path := range []string{
+		"/delegations/year/2024?page=0",
+		"/delegations/year/2024?limit=1001",
+		"/delegations/year/2024?page=first",
+	} {
+		rec = httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, path)
+		assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec), path)
+	}
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/year/24", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ErrCodeInvalidYear, errorCode(t, rec))
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// etag builds a strong ETag from the query parameters of r
+// and the store cache tag of the data they select
+func etag(r *http.Request, tag string) string {
+	sum := sha256.Sum256([]byte(r.URL.Query().Encode() + "|" + tag))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified reports whether the If-None-Match header of r matches tag
+func notModified(r *http.Request, tag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// DelegationsStream pushes every delegation inserted after the connection
+// was opened as a Server-Sent Event, until the client disconnects.
+func (h *Handlers) DelegationsStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || h.Hub == nil {
+		writeError(w, r, errors.New("streaming unsupported"), http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+
+	ch, unsubscribe := h.Hub.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case d, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(d)
+			if err != nil {
+				return
+			}
+			_, err = fmt.Fprintf(w, "event: delegation\ndata: %s\n\n", data)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/broadcast"
+	"github.com/stretchr/testify/assert"
+)
+
+// syncRecorder is a ResponseRecorder safe to read while the handler writes
+type syncRecorder struct {
+	mu sync.Mutex
+	*httptest.ResponseRecorder
+}
+
+func (r *syncRecorder) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ResponseRecorder.Write(b)
+}
+
+func (r *syncRecorder) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ResponseRecorder.Flush()
+}
+
+func (r *syncRecorder) body() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Body.String()
+}
+
+func Test_DelegationsStream(t *testing.T) {
+	hub := broadcast.NewHub()
+	h := Handlers{Hub: hub}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/delegations/events", nil).WithContext(ctx)
+	rec := &syncRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.DelegationsStream(rec, req)
+	}()
+
+	assert.Eventually(t, func() bool { return hub.Len() == 1 }, time.Second, time.Millisecond)
+	hub.Publish([]tds.Delegation{{
+		Timestamp: "2024-10-29T10:22:25Z",
+		Delegator: "tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms",
+		Amount:    "13814013",
+		Level:     "6976378",
+		ID:        "1401626186219520",
+	}})
+
+	expected := "event: delegation\n" +
+		`data: {"timestamp":"2024-10-29T10:22:25Z","delegator":"tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms","amount":"13814013","level":"6976378"}` +
+		"\n\n"
+	assert.Eventually(t, func() bool { return strings.Contains(rec.body(), expected) }, time.Second, time.Millisecond)
+
+	// client disconnection
+	cancel()
+	<-done
+	assert.Zero(t, hub.Len())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+	assert.True(t, rec.Flushed)
+}
+
+func Test_DelegationsStream_noHub(t *testing.T) {
+	h := Handlers{}
+	req := httptest.NewRequest("GET", "/delegations/events", nil)
+	rec := httptest.NewRecorder()
+	h.DelegationsStream(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, ErrCodeInternalError, errorCode(t, rec))
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+// csvFlushRows is the number of csv rows written between two flushes
+const csvFlushRows = 100
+
+// exportCSVHeader is the header row of DelegationsCSV
+var exportCSVHeader = []string{"timestamp", "delegator", "amount_mutez", "amount_xtz", "level", "id", "baker"}
+
+// DelegationsCSV downloads the delegations of the year given in the query,
+// or the current year, as a csv file.
+// limit caps the number of delegations, there is no limit by default.
+func (h *Handlers) DelegationsCSV(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	year := q.Get("year")
+	if year == "" {
+		year = time.Now().Format("2006")
+	}
+	if status, code, err := h.checkYears(r.Context(), []string{year}); err != nil {
+		writeError(w, r, err, status, code)
+		return
+	}
+
+	f := store.DelegationFilter{
+		Year:      &year,
+		SortOrder: q.Get("sort"),
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			writeError(w, r, errors.New("limit must be a positive integer"), http.StatusBadRequest, ErrCodeInvalidParameter)
+			return
+		}
+		f.Limit = limit
+	}
+
+	it, err := h.Store.QueryIter(r.Context(), f)
+	if errors.Is(err, store.ErrInvalidSort) {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+	defer it.Close()
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "delegations-"+year+".csv"))
+	// the status is sent, errors can only be logged from here
+	if err := writeCSV(w, it); err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Str("path", r.URL.Path).Msg("csv export interrupted")
+	}
+}
+
+// writeCSV writes the delegations of it as exportCSVHeader rows,
+// flushing w every csvFlushRows rows
+func writeCSV(w http.ResponseWriter, it store.DelegationIter) error {
+	flusher, _ := w.(http.Flusher)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportCSVHeader); err != nil {
+		return err
+	}
+	var n int
+	for d, ok := it.Next(); ok; d, ok = it.Next() {
+		if err := cw.Write([]string{d.Timestamp, d.Delegator, d.Amount, d.AmountXTZ(), d.Level, d.ID, d.Baker}); err != nil {
+			return err
+		}
+		if n++; n%csvFlushRows != 0 {
+			continue
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DelegationsCSV(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2022-05-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "13814013", Level: "10", Baker: "tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB"},
+		{ID: "2", Timestamp: "2022-06-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "20", Level: "20"},
+		{ID: "3", Timestamp: "2023-01-01T00:00:00Z", Delegator: "tz1ccccccccccccccccccccccccccccccccc", Amount: "30", Level: "30"},
+	}))
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/export.csv?year=2022", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="delegations-2022.csv"`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, "timestamp,delegator,amount_mutez,amount_xtz,level,id,baker\n"+
+		"2022-06-01T00:00:00Z,tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb,20,0.000020,20,2,\n"+
+		"2022-05-01T00:00:00Z,tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa,13814013,13.814013,10,1,tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/export.csv?year=2022&limit=1&sort=asc", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "timestamp,delegator,amount_mutez,amount_xtz,level,id,baker\n"+
+		"2022-05-01T00:00:00Z,tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa,13814013,13.814013,10,1,tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB\n", rec.Body.String())
+
+	for _, query := range []string{"year=2022&limit=0", "year=2022&limit=x", "year=2022&sort=up"} {
+		rec = httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/export.csv?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec), query)
+	}
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/export.csv?year=1999", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ErrCodeInvalidYear, errorCode(t, rec))
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("POST", "/delegations/export.csv", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func Test_DelegationsCSV_flush(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	delegations := make([]tds.Delegation, 2*csvFlushRows+1)
+	for i := range delegations {
+		delegations[i] = tds.Delegation{
+			ID:        strconv.Itoa(i + 1),
+			Timestamp: "2022-05-01T00:00:00Z",
+			Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			Amount:    "1",
+			Level:     strconv.Itoa(i + 1),
+		}
+	}
+	require.NoError(t, s.Insert(context.Background(), delegations))
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/export.csv?year=2022", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, rec.Flushed)
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, records, len(delegations)+1)
+}
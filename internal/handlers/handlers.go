@@ -2,8 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/frieeze/tezos-delegation/internal/broadcast"
 	"github.com/frieeze/tezos-delegation/internal/store"
 	"github.com/rs/zerolog/log"
 )
@@ -11,22 +16,140 @@ import (
 // Handlers is a struct that holds all  http handlers
 type Handlers struct {
 	Store store.Store
+	// Hub publishes the newly stored delegations
+	Hub *broadcast.Hub
+	// Syncer runs the live sync
+	Syncer Syncer
+	// BackupDir is the directory receiving the store backups
+	BackupDir string
+	// StrictYears rejects the years without stored delegations
+	// instead of every year outside the Tezos history
+	StrictYears bool
 }
 
-type errorResponse struct {
-	Error string `json:"error"`
-	Code  int    `json:"code"`
+// Syncer controls the live sync
+type Syncer interface {
+	// SyncNow starts a sync without waiting for it,
+	// returns false if a sync is already in progress
+	SyncNow() bool
+	// SetInterval changes the interval between two syncs
+	SetInterval(d time.Duration) error
+}
+
+// ErrorCode is a machine readable error code,
+// more precise than the HTTP status
+type ErrorCode string
+
+// Error codes sent in the error_code field of error responses
+const (
+	ErrCodeInvalidYear       ErrorCode = "invalid_year"
+	ErrCodeInvalidParameter  ErrorCode = "invalid_parameter"
+	ErrCodeDelegatorNotFound ErrorCode = "delegator_not_found"
+	ErrCodeNotFound          ErrorCode = "not_found"
+	ErrCodeMethodNotAllowed  ErrorCode = "method_not_allowed"
+	ErrCodePayloadTooLarge   ErrorCode = "payload_too_large"
+	ErrCodeStoreUnavailable  ErrorCode = "store_unavailable"
+	ErrCodeInternalError     ErrorCode = "internal_error"
+)
+
+// contentTypeJSON is the Content-Type of the JSON responses,
+// some clients need the charset to decode them
+const contentTypeJSON = "application/json; charset=utf-8"
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error     string    `json:"error"`
+	Code      int       `json:"code"`
+	ErrorCode ErrorCode `json:"error_code"`
 }
 
 // writeError logs and render the error
-func writeError(w http.ResponseWriter, r *http.Request, err error, code int) {
-	log.Ctx(r.Context()).Error().Err(err).Str("path", r.URL.Path).Msg("request failed")
-	w.WriteHeader(code)
-	writeJSON(w, errorResponse{Error: err.Error(), Code: code})
+func writeError(w http.ResponseWriter, r *http.Request, err error, status int, code ErrorCode) {
+	log.Ctx(r.Context()).Error().Err(err).Str("path", r.URL.Path).Str("error_code", string(code)).Msg("request failed")
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	writeJSON(w, ErrorResponse{Error: err.Error(), Code: status, ErrorCode: code})
+}
+
+// NotFound returns a handler answering every request with a 404 JSON error
+func NotFound() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, errors.New("not found"), http.StatusNotFound, ErrCodeNotFound)
+	})
+}
+
+// MethodNotAllowed returns a handler answering every request with a 405 JSON error
+func MethodNotAllowed() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, errors.New("method not allowed"), http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed)
+	})
+}
+
+// methodNotAllowed answers with a 405 JSON error, its Allow header lists
+// the methods mux routes for the request path, the routes added later included
+func methodNotAllowed(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(allowedMethods(mux, r), ", "))
+		MethodNotAllowed().ServeHTTP(w, r)
+	})
+}
 
+// allowedMethods returns the methods having a route on mux for the path of r,
+// the GET routes also serve HEAD
+func allowedMethods(mux *http.ServeMux, r *http.Request) []string {
+	var allowed []string
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := mux.Handler(probe); !strings.HasPrefix(pattern, method+" ") {
+			continue
+		}
+		allowed = append(allowed, method)
+		if method == http.MethodGet {
+			allowed = append(allowed, http.MethodHead)
+		}
+	}
+	return allowed
 }
 
 func writeJSON(w http.ResponseWriter, data interface{}) error {
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", contentTypeJSON)
 	return json.NewEncoder(w).Encode(data)
 }
+
+// jsonFlushRows is the number of streamed delegations written between two flushes
+const jsonFlushRows = 100
+
+// writeJSONStream renders the delegations of it as a delegationResponse,
+// encoding them one at a time and flushing w every jsonFlushRows delegations
+func writeJSONStream(w http.ResponseWriter, it store.DelegationIter) error {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	flusher, _ := w.(http.Flusher)
+	if _, err := io.WriteString(w, `{"data":[`); err != nil {
+		return err
+	}
+	var n int
+	for d, ok := it.Next(); ok; d, ok = it.Next() {
+		if n > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		n++
+		if n%jsonFlushRows == 0 && flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "]}\n")
+	return err
+}
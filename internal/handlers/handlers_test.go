@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_XTZRoutes_defaults(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	h := &Handlers{Store: s}
+	routes := h.AddXTZRoutes()
+	h.AddAdminRoutes(routes, func(next http.Handler) http.Handler { return next })
+
+	tests := []struct {
+		method, path string
+		status       int
+		code         ErrorCode
+		allow        string
+	}{
+		{method: "GET", path: "/nonexistent", status: http.StatusNotFound, code: ErrCodeNotFound},
+		// the admin route is listed along with the public one
+		{method: "POST", path: "/delegations", status: http.StatusMethodNotAllowed, code: ErrCodeMethodNotAllowed, allow: "GET, HEAD, DELETE"},
+		{method: "PUT", path: "/delegators/tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa/stats", status: http.StatusMethodNotAllowed, code: ErrCodeMethodNotAllowed, allow: "GET, HEAD"},
+		{method: "PUT", path: "/delegations/42", status: http.StatusMethodNotAllowed, code: ErrCodeMethodNotAllowed, allow: "GET, HEAD"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		assert.Equal(t, tt.status, rec.Code, tt.path)
+		assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"), tt.path)
+		assert.Equal(t, tt.code, errorCode(t, rec), tt.path)
+		assert.Equal(t, tt.allow, rec.Header().Get("Allow"), tt.path)
+	}
+
+	// the admin routes still take precedence
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("DELETE", "/delegations", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
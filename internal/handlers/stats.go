@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/frieeze/tezos-delegation/internal/tezos"
+)
+
+// YearStats holds the delegation statistics of a year
+type YearStats struct {
+	Year             string  `json:"year"`
+	Count            int64   `json:"count"`
+	TotalAmount      int64   `json:"total_amount"`
+	UniqueDelegators int64   `json:"unique_delegators"`
+	DailyAverage     float64 `json:"daily_average"`
+	// DailyCounts is keyed by "2006-01-02" dates, the days without delegations are left out
+	DailyCounts map[string]int64 `json:"daily_counts"`
+	// MostActiveDelegator has the most delegations of the year, nil without delegations
+	MostActiveDelegator *store.DelegatorSummary `json:"most_active_delegator"`
+}
+
+// YearStats returns the delegation statistics of the year given in the path
+func (h *Handlers) YearStats(w http.ResponseWriter, r *http.Request) {
+	year := r.PathValue("year")
+	if err := validateYear(year); err != nil {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidYear)
+		return
+	}
+
+	count, err := h.Store.CountByYear(r.Context(), year)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	delegators, err := h.Store.CountDistinctDelegators(r.Context(), year)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	total, err := h.Store.GetAmountSumByYear(r.Context(), year)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	daily, err := h.Store.GetActivityByDay(r.Context(), year)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	top, err := h.Store.GetTopDelegators(r.Context(), 1, year, store.SortByCount)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+	var mostActive *store.DelegatorSummary
+	if len(top) > 0 {
+		mostActive = &top[0]
+	}
+
+	err = writeJSON(w, YearStats{
+		Year:                year,
+		Count:               count,
+		TotalAmount:         total,
+		UniqueDelegators:    delegators,
+		DailyAverage:        float64(count) / float64(daysInYear(year)),
+		DailyCounts:         daily,
+		MostActiveDelegator: mostActive,
+	})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// DelegatorStats holds the delegation statistics of a delegator
+type DelegatorStats struct {
+	Address     string `json:"address"`
+	TotalAmount int64  `json:"total_amount"`
+	Count       int64  `json:"count"`
+}
+
+// DelegatorStats returns the delegation statistics of the address given in the path
+// An unknown address has a count and a total amount of 0
+func (h *Handlers) DelegatorStats(w http.ResponseWriter, r *http.Request) {
+	address := r.PathValue("address")
+	if err := tezos.ValidateAddress(address); err != nil {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+
+	total, err := h.Store.GetAmountSumByDelegator(r.Context(), address)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	count, err := h.Store.CountByDelegator(r.Context(), address)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	err = writeJSON(w, DelegatorStats{
+		Address:     address,
+		TotalAmount: total,
+		Count:       count,
+	})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// delegatorHistorySummary sums up the delegations of a delegator
+type delegatorHistorySummary struct {
+	TotalAmount int64 `json:"total_amount"`
+	Count       int   `json:"count"`
+	// FirstSeen and LastSeen are the dates of the first and last delegations
+	FirstSeen string `json:"first_seen"`
+	LastSeen  string `json:"last_seen"`
+}
+
+type delegatorHistoryResponse struct {
+	Data    tds.DelegationSlice     `json:"data"`
+	Summary delegatorHistorySummary `json:"summary"`
+}
+
+// DelegatorHistory returns every delegation of the address given in the path,
+// across all years and most recent first, along with their summary
+func (h *Handlers) DelegatorHistory(w http.ResponseWriter, r *http.Request) {
+	address := r.PathValue("address")
+	if err := tezos.ValidateAddress(address); err != nil {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+
+	delegations, err := h.Store.GetByDelegator(r.Context(), address)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+	if len(delegations) == 0 {
+		writeError(w, r, fmt.Errorf("address %q: no delegation stored", address), http.StatusNotFound, ErrCodeDelegatorNotFound)
+		return
+	}
+	total, err := delegations.TotalAmountMutez()
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+
+	// delegations are ordered by descending timestamps
+	err = writeJSON(w, delegatorHistoryResponse{
+		Data: delegations,
+		Summary: delegatorHistorySummary{
+			TotalAmount: total,
+			Count:       len(delegations),
+			FirstSeen:   day(delegations[len(delegations)-1].Timestamp),
+			LastSeen:    day(delegations[0].Timestamp),
+		},
+	})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// day returns the date part of an RFC3339 timestamp
+func day(timestamp string) string {
+	date, _, _ := strings.Cut(timestamp, "T")
+	return date
+}
+
+const (
+	defaultTopDelegators = 10
+	maxTopDelegators     = 100
+)
+
+type topDelegatorsResponse struct {
+	Data []store.DelegatorSummary `json:"data"`
+}
+
+// TopDelegators returns the biggest delegators of the year given in the query,
+// or the current year if no year is provided
+// n (default 10, up to 100) caps the number of delegators
+// and sort orders them by "amount" (default) or "count"
+func (h *Handlers) TopDelegators(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	year := q.Get("year")
+	if year == "" {
+		year = time.Now().Format("2006")
+	}
+	if err := validateYear(year); err != nil {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidYear)
+		return
+	}
+
+	n := defaultTopDelegators
+	if v := q.Get("n"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTopDelegators {
+			writeError(w, r, fmt.Errorf("n must be between 1 and %d", maxTopDelegators), http.StatusBadRequest, ErrCodeInvalidParameter)
+			return
+		}
+	}
+
+	top, err := h.Store.GetTopDelegators(r.Context(), n, year, q.Get("sort"))
+	if errors.Is(err, store.ErrInvalidSort) {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	err = writeJSON(w, topDelegatorsResponse{Data: top})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// DelegationFrequency returns the number of delegations of each delegator
+// for the year given in the query, or the current year if no year is provided
+// limit keeps the delegators with the most delegations
+func (h *Handlers) DelegationFrequency(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	year := q.Get("year")
+	if year == "" {
+		year = time.Now().Format("2006")
+	}
+	if err := validateYear(year); err != nil {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidYear)
+		return
+	}
+
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			writeError(w, r, errors.New("limit must be a positive integer"), http.StatusBadRequest, ErrCodeInvalidParameter)
+			return
+		}
+	}
+
+	counts, err := h.Store.GetCountByDelegator(r.Context(), year)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+	if limit > 0 && len(counts) > limit {
+		counts = topCounts(counts, limit)
+	}
+
+	err = writeJSON(w, counts)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// DelegationActivity returns the number of delegations of each day
+// of the year given in the query, or the current year if no year is provided,
+// keyed by "2006-01-02" dates
+// The response is sparse: out of the 365 or 366 days of the year,
+// the days without delegations are left out rather than set to 0
+func (h *Handlers) DelegationActivity(w http.ResponseWriter, r *http.Request) {
+	year := r.URL.Query().Get("year")
+	if year == "" {
+		year = time.Now().Format("2006")
+	}
+	if err := validateYear(year); err != nil {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidYear)
+		return
+	}
+
+	counts, err := h.Store.GetActivityByDay(r.Context(), year)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	err = writeJSON(w, counts)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
+
+// topCounts keeps the n delegators with the highest counts,
+// ties are broken by address
+func topCounts(counts map[string]int64, n int) map[string]int64 {
+	delegators := make([]string, 0, len(counts))
+	for d := range counts {
+		delegators = append(delegators, d)
+	}
+	sort.Slice(delegators, func(i, j int) bool {
+		ci, cj := counts[delegators[i]], counts[delegators[j]]
+		if ci != cj {
+			return ci > cj
+		}
+		return delegators[i] < delegators[j]
+	})
+
+	top := make(map[string]int64, n)
+	for _, d := range delegators[:n] {
+		top[d] = counts[d]
+	}
+	return top
+}
+
+// daysInYear returns the number of days of the given year,
+// or the number of elapsed days if it is the current year.
+func daysInYear(year string) int {
+	y, err := strconv.Atoi(year)
+	if err != nil {
+		return 365
+	}
+	start := time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+	if now := time.Now().UTC(); now.Before(end) && now.After(start) {
+		end = now
+	}
+	return max(int(end.Sub(start).Hours()/24), 1)
+}
+
+// defaultHistogramBuckets are the boundaries of 0, 1, 10, 100 and 1000 tez
+var defaultHistogramBuckets = []int64{0, 1_000_000, 10_000_000, 100_000_000, 1_000_000_000}
+
+// maxHistogramBuckets caps the number of boundaries of a histogram
+const maxHistogramBuckets = 50
+
+type histogramResponse struct {
+	Data []store.Bucket `json:"data"`
+}
+
+// DelegationHistogram returns the number of delegations in each amount range
+// of the year given in the query, or the current year if no year is provided
+// buckets is a comma separated list of increasing boundaries in mutez,
+// the last range has no upper bound
+func (h *Handlers) DelegationHistogram(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	year := q.Get("year")
+	if year == "" {
+		year = time.Now().Format("2006")
+	}
+	if err := validateYear(year); err != nil {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidYear)
+		return
+	}
+
+	boundaries := defaultHistogramBuckets
+	if v := q.Get("buckets"); v != "" {
+		list := strings.Split(v, ",")
+		if len(list) > maxHistogramBuckets {
+			writeError(w, r, fmt.Errorf("at most %d buckets can be requested", maxHistogramBuckets), http.StatusBadRequest, ErrCodeInvalidParameter)
+			return
+		}
+		boundaries = make([]int64, len(list))
+		for i, b := range list {
+			var err error
+			boundaries[i], err = strconv.ParseInt(strings.TrimSpace(b), 10, 64)
+			if err != nil {
+				writeError(w, r, fmt.Errorf("bucket %q: must be an amount in mutez", b), http.StatusBadRequest, ErrCodeInvalidParameter)
+				return
+			}
+		}
+	}
+
+	buckets, err := h.Store.GetAmountHistogram(r.Context(), year, boundaries)
+	if errors.Is(err, store.ErrInvalidBuckets) {
+		writeError(w, r, err, http.StatusBadRequest, ErrCodeInvalidParameter)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeStoreUnavailable)
+		return
+	}
+
+	err = writeJSON(w, histogramResponse{Data: buckets})
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_YearStats(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-15T08:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "100", Level: "1"},
+		{ID: "2", Timestamp: "2024-01-15T09:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "2"},
+		{ID: "3", Timestamp: "2024-03-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "20", Level: "3"},
+	})
+	require.NoError(t, err)
+
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/year/2024/stats", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"year": "2024",
+		"count": 3,
+		"total_amount": 130,
+		"unique_delegators": 2,
+		"daily_average": 0.00819672131147541,
+		"daily_counts": {"2024-01-15": 2, "2024-03-01": 1},
+		"most_active_delegator": {"address": "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", "total_amount": 30, "count": 2}
+	}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/year/2023/stats", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"most_active_delegator":null`)
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/year/24/stats", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ErrCodeInvalidYear, errorCode(t, rec))
+}
+
+func Test_DelegatorStats(t *testing.T) {
+	const (
+		delegator = "tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms"
+		unknown   = "tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP"
+	)
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2023-01-01T00:00:00Z", Delegator: delegator, Amount: "100", Level: "1"},
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: delegator, Amount: "10", Level: "2"},
+	})
+	require.NoError(t, err)
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegators/"+delegator+"/stats", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"address":"`+delegator+`","total_amount":110,"count":2}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegators/"+unknown+"/stats", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"address":"`+unknown+`","total_amount":0,"count":0}`, rec.Body.String())
+
+	// a malformed address is not reported as an unknown delegator
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegators/tz1a/stats", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec))
+}
+
+func Test_TopDelegators(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "100", Level: "1"},
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "2"},
+		{ID: "3", Timestamp: "2024-03-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "20", Level: "3"},
+	})
+	require.NoError(t, err)
+
+	h := Handlers{Store: s}
+	routes := h.AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegators/top?year=2024&n=1&sort=count", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[{"address":"tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb","total_amount":30,"count":2}]}`, rec.Body.String())
+
+	for _, query := range []string{"n=0", "n=101", "n=ten", "sort=level"} {
+		rec = httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegators/top?year=2024&"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec), query)
+	}
+	// a year pattern would rank the delegators of several years
+	for _, year := range []string{"%25", "2", "garbage"} {
+		rec = httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegators/top?year="+year, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, year)
+		assert.Equal(t, ErrCodeInvalidYear, errorCode(t, rec), year)
+	}
+}
+
+func Test_DelegationFrequency(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "100", Level: "1"},
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "2"},
+		{ID: "3", Timestamp: "2024-03-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "20", Level: "3"},
+		{ID: "4", Timestamp: "2024-04-01T00:00:00Z", Delegator: "tz1ccccccccccccccccccccccccccccccccc", Amount: "20", Level: "4"},
+	})
+	require.NoError(t, err)
+
+	h := Handlers{Store: s}
+	routes := h.AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/frequency?year=2024", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa":1,"tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb":2,"tz1ccccccccccccccccccccccccccccccccc":1}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/frequency?year=2024&limit=2", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa":1,"tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb":2}`, rec.Body.String())
+
+	for _, query := range []string{"limit=0", "limit=ten", "year=2017"} {
+		rec = httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/frequency?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func Test_DelegationActivity(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-15T08:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "100", Level: "1"},
+		{ID: "2", Timestamp: "2024-01-15T09:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "2"},
+		{ID: "3", Timestamp: "2024-03-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "20", Level: "3"},
+	})
+	require.NoError(t, err)
+
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/activity?year=2024", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"2024-01-15":2,"2024-03-01":1}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/activity?year=2017", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ErrCodeInvalidYear, errorCode(t, rec))
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("POST", "/delegations/activity", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func Test_DelegationHistogram(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "500", Level: "1"},
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "2000000", Level: "2"},
+		{ID: "3", Timestamp: "2024-03-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "20000000", Level: "3"},
+	})
+	require.NoError(t, err)
+
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/histogram?year=2024&buckets=0,1000000,10000000", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":[
+		{"min":0,"max":1000000,"count":1},
+		{"min":1000000,"max":10000000,"count":1},
+		{"min":10000000,"max":9223372036854775807,"count":1}
+	]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/histogram?year=2024", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `{"min":1000000000,"max":9223372036854775807,"count":0}`)
+
+	for _, query := range []string{"buckets=a", "buckets=10,5", "buckets=1,,2"} {
+		rec = httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/histogram?year=2024&"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec), query)
+	}
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegations/histogram?year=2000", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ErrCodeInvalidYear, errorCode(t, rec))
+}
+
+func Test_DelegatorHistory(t *testing.T) {
+	s, err := store.NewSqLite(context.Background(), ":memory:")
+	require.NoError(t, err)
+	defer s.Close()
+	const address = "tz1KhjVyh7yc6197M5iZqnpn7u7aDSoqWB4R"
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2019-01-01T10:00:00Z", Delegator: address, Amount: "100", Level: "1"},
+		{ID: "2", Timestamp: "2024-10-01T10:00:00Z", Delegator: address, Amount: "20", Level: "2"},
+		{ID: "3", Timestamp: "2022-03-01T00:00:00Z", Delegator: "tz1P9h5zJoaho148uXCv1iMsum76Rr9LJbGg", Amount: "30", Level: "3"},
+	})
+	require.NoError(t, err)
+	routes := (&Handlers{Store: s}).AddXTZRoutes()
+
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegators/"+address+"/history", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"data": [
+			{"timestamp":"2024-10-01T10:00:00Z","delegator":"`+address+`","amount":"20","level":"2"},
+			{"timestamp":"2019-01-01T10:00:00Z","delegator":"`+address+`","amount":"100","level":"1"}
+		],
+		"summary": {"total_amount":120,"count":2,"first_seen":"2019-01-01","last_seen":"2024-10-01"}
+	}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegators/tz1burnburnburnburnburnburnburjAYjjX/history", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, ErrCodeDelegatorNotFound, errorCode(t, rec))
+
+	for _, address := range []string{"tz1a", "tz5KhjVyh7yc6197M5iZqnpn7u7aDSoqWB4R", "tz1KhjVyh7yc6197M5iZqnpn7u7aDSoqWB40"} {
+		rec = httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest("GET", "/delegators/"+address+"/history", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, address)
+		assert.Equal(t, ErrCodeInvalidParameter, errorCode(t, rec), address)
+	}
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/frieeze/tezos-delegation/internal/version"
+)
+
+// Version returns the build information of the running binary
+func Version(w http.ResponseWriter, r *http.Request) {
+	err := writeJSON(w, version.Get())
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError, ErrCodeInternalError)
+		return
+	}
+}
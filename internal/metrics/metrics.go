@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Registry registers the sync metrics,
+// prometheus.DefaultRegisterer in production, a pedantic registry in tests
+type Registry = prometheus.Registerer
+
+// Sync error types
+const (
+	History = "history"
+	Live    = "live"
+)
+
+// Sync holds the metrics of the history and live syncers
+// A nil *Sync records nothing
+type Sync struct {
+	historyBatches     prometheus.Counter
+	historyDelegations prometheus.Counter
+	liveCycles         prometheus.Counter
+	liveDelegations    prometheus.Counter
+	apiDuration        *prometheus.HistogramVec
+	errors             *prometheus.CounterVec
+}
+
+// NewSync registers the sync metrics on reg
+// Metrics already registered by another syncer are shared
+func NewSync(reg Registry) *Sync {
+	return &Sync{
+		historyBatches: register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "tds_history_sync_batches_total",
+			Help: "Number of batches fetched by the history sync.",
+		})),
+		historyDelegations: register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "tds_history_sync_delegations_total",
+			Help: "Number of delegations fetched by the history sync.",
+		})),
+		liveCycles: register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "tds_live_sync_cycles_total",
+			Help: "Number of live syncs.",
+		})),
+		liveDelegations: register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "tds_live_sync_delegations_total",
+			Help: "Number of delegations fetched by the live sync.",
+		})),
+		apiDuration: register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "tds_sync_api_request_duration_seconds",
+			Help:    "Duration of the tzkt api requests.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"endpoint"})),
+		errors: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tds_sync_errors_total",
+			Help: "Number of failed syncs, by sync type.",
+		}, []string{"type"})),
+	}
+}
+
+// register registers c on reg, or returns the collector already registered
+func register[C prometheus.Collector](reg Registry, c C) C {
+	err := reg.Register(c)
+	var already prometheus.AlreadyRegisteredError
+	if errors.As(err, &already) {
+		if existing, ok := already.ExistingCollector.(C); ok {
+			return existing
+		}
+	}
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// HistoryBatch records a history batch of n delegations
+func (s *Sync) HistoryBatch(n int) {
+	if s == nil {
+		return
+	}
+	s.historyBatches.Inc()
+	s.historyDelegations.Add(float64(n))
+}
+
+// LiveCycle records a live sync of n delegations
+func (s *Sync) LiveCycle(n int) {
+	if s == nil {
+		return
+	}
+	s.liveCycles.Inc()
+	s.liveDelegations.Add(float64(n))
+}
+
+// APIRequest records the duration of a tzkt api request started at start
+func (s *Sync) APIRequest(endpoint string, start time.Time) {
+	if s == nil {
+		return
+	}
+	s.apiDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+}
+
+// Error records a failed sync of the given type, History or Live
+func (s *Sync) Error(typ string) {
+	if s == nil {
+		return
+	}
+	s.errors.WithLabelValues(typ).Inc()
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewSync_shared(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	a, b := NewSync(reg), NewSync(reg)
+
+	a.HistoryBatch(2)
+	b.HistoryBatch(3)
+	a.Error(History)
+	b.Error(Live)
+	b.APIRequest("delegations", time.Now())
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(a.historyBatches))
+	assert.Equal(t, 5.0, testutil.ToFloat64(b.historyDelegations))
+	assert.Equal(t, 1.0, testutil.ToFloat64(a.errors.WithLabelValues(History)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(a.errors.WithLabelValues(Live)))
+	assert.Equal(t, 1, testutil.CollectAndCount(reg, "tds_sync_api_request_duration_seconds"))
+}
+
+func Test_Sync_nil(t *testing.T) {
+	var s *Sync
+	assert.NotPanics(t, func() {
+		s.HistoryBatch(1)
+		s.LiveCycle(1)
+		s.APIRequest("delegations", time.Now())
+		s.Error(Live)
+	})
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+type ctxKey int
+
+const apiKeyCtxKey ctxKey = iota
+
+// keyPrefixLen is the number of characters of an API key
+// that can safely be logged to identify the caller.
+const keyPrefixLen = 6
+
+// APIKeyHeader is the header carrying the API key.
+const APIKeyHeader = "X-API-Key"
+
+// APIKey only lets requests carrying one of the given keys
+// in the X-API-Key header (or as a Bearer token) through.
+// Other requests are rejected with a 401.
+// If no key is given, every request is rejected.
+func APIKey(keys []string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(APIKeyHeader)
+			if key == "" {
+				key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			}
+			if key == "" || !validKey(keys, key) {
+				writeError(w, "unauthorized", http.StatusUnauthorized, ErrCodeUnauthorized)
+				return
+			}
+			ctx := context.WithValue(r.Context(), apiKeyCtxKey, key)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func validKey(keys []string, key string) bool {
+	valid := false
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// KeyPrefix returns the first characters of the API key
+// authenticated by APIKey, or an empty string if there is none.
+// At most half of the key is ever returned.
+func KeyPrefix(ctx context.Context) string {
+	key, _ := ctx.Value(apiKeyCtxKey).(string)
+	return key[:min(len(key)/2, keyPrefixLen)]
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func authTestHandler(t *testing.T, expectedPrefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, expectedPrefix, KeyPrefix(r.Context()))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func Test_APIKey(t *testing.T) {
+	h := APIKey([]string{"first-secret-key", "second-secret-key"})(authTestHandler(t, "second"))
+
+	req := httptest.NewRequest("DELETE", "/", nil)
+	req.Header.Set(APIKeyHeader, "second-secret-key")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	req = httptest.NewRequest("DELETE", "/", nil)
+	req.Header.Set("Authorization", "Bearer second-secret-key")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func Test_APIKey_unauthorized(t *testing.T) {
+	h := APIKey([]string{"secret-key"})(authTestHandler(t, ""))
+
+	req := httptest.NewRequest("DELETE", "/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.JSONEq(t, `{"error":"unauthorized","code":401,"error_code":"unauthorized"}`, rec.Body.String())
+
+	req = httptest.NewRequest("DELETE", "/", nil)
+	req.Header.Set(APIKeyHeader, "wrong-key")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func Test_APIKey_noKeys(t *testing.T) {
+	h := APIKey(nil)(authTestHandler(t, ""))
+
+	req := httptest.NewRequest("DELETE", "/", nil)
+	req.Header.Set(APIKeyHeader, "")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func Test_KeyPrefix_short(t *testing.T) {
+	h := APIKey([]string{"abcd"})(authTestHandler(t, "ab"))
+
+	req := httptest.NewRequest("DELETE", "/", nil)
+	req.Header.Set(APIKeyHeader, "abcd")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
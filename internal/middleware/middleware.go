@@ -1,42 +1,145 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
 	"net/http"
 	"time"
 
 	"github.com/rs/zerolog/hlog"
 )
 
-type Middleware func(http.Handler) http.Handler
+// Middleware wraps a handler, it is an alias so that the middlewares
+// of other packages can be used without conversion
+type Middleware = func(http.Handler) http.Handler
 
-func Use(mw ...Middleware) Middleware {
+// contentTypeJSON is the Content-Type of the error responses
+// written by the middlewares, matching the handlers ones
+const contentTypeJSON = "application/json; charset=utf-8"
+
+// Error codes sent in the error_code field of the middlewares error responses
+const (
+	ErrCodeUnauthorized    = "unauthorized"
+	ErrCodeRateLimited     = "rate_limited"
+	ErrCodePayloadTooLarge = "payload_too_large"
+)
+
+// errorResponse has the shape of handlers.ErrorResponse,
+// which can't be imported since the handlers use the middlewares
+type errorResponse struct {
+	Error     string `json:"error"`
+	Code      int    `json:"code"`
+	ErrorCode string `json:"error_code"`
+}
+
+// writeError renders an error response, the headers set beforehand are kept
+func writeError(w http.ResponseWriter, msg string, status int, code string) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: msg, Code: status, ErrorCode: code})
+}
+
+// Use chains the middlewares, the first one is the outermost:
+// it sees the requests first and the responses last
+func Use(mw ...func(http.Handler) http.Handler) Middleware {
 	return func(next http.Handler) http.Handler {
-		for _, m := range mw {
-			next = m(next)
+		for i := len(mw) - 1; i >= 0; i-- {
+			next = mw[i](next)
 		}
 		return next
 	}
 }
 
+// maxErrorBodyBytes is the size of the error response body
+// kept by the responseRecorder to find its error code.
+const maxErrorBodyBytes = 4 << 10
+
+// responseRecorder records the status and the number of bytes
+// written to the response, and the beginning of error bodies.
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	bytes   int
+	errBody bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	if rec.status > 299 && rec.errBody.Len() < maxErrorBodyBytes {
+		rec.errBody.Write(b[:min(n, maxErrorBodyBytes-rec.errBody.Len())])
+	}
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// errorCode returns the error_code field of the JSON error body,
+// or an empty string if there is none.
+func (rec *responseRecorder) errorCode() string {
+	var body struct {
+		ErrorCode string `json:"error_code"`
+	}
+	json.Unmarshal(rec.errBody.Bytes(), &body)
+	return body.ErrorCode
+}
+
+// Logger logs every request once it is served,
+// with its request and response body sizes.
+// Failed requests are logged at the error level
+// along with the error_code of their ErrorResponse.
 func Logger() Middleware {
-	return hlog.AccessHandler(
-		func(r *http.Request, status, size int, duration time.Duration) {
-			duration = duration.Truncate(time.Millisecond)
-			dur := duration.String()
-			if status > 299 {
-				hlog.FromRequest(r).Error().
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			dur := time.Since(start).Truncate(time.Millisecond).String()
+			if rec.status > 299 {
+				event := hlog.FromRequest(r).Error().
 					Str("method", r.Method).
-					Int("status", status).
+					Int("status", rec.status).
 					Stringer("url", r.URL).
 					Str("duration", dur).
-					Msg("")
+					Int64("req_bytes", max(r.ContentLength, 0)).
+					Int("resp_bytes", rec.bytes)
+				if code := rec.errorCode(); code != "" {
+					event = event.Str("error_code", code)
+				}
+				event.Msg("")
 				return
 			}
 			hlog.FromRequest(r).Info().
 				Str("method", r.Method).
-				Int("status", status).
+				Int("status", rec.status).
 				Stringer("url", r.URL).
 				Str("duration", dur).
+				Int64("req_bytes", max(r.ContentLength, 0)).
+				Int("resp_bytes", rec.bytes).
 				Msg("")
 		})
+	}
 }
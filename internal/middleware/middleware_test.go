@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveLogged(t *testing.T, h http.Handler, req *http.Request) (*httptest.ResponseRecorder, map[string]any) {
+	var buf bytes.Buffer
+	logged := Use(hlog.NewHandler(zerolog.New(&buf)), Logger())(h)
+	rec := httptest.NewRecorder()
+	logged.ServeHTTP(rec, req)
+
+	line := map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	return rec, line
+}
+
+func Test_Use(t *testing.T) {
+	var requests []string
+	named := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, name)
+				next.ServeHTTP(w, r)
+				w.Header().Add("X-Order", name)
+			})
+		}
+	}
+	h := Use(named("outer"), named("middle"), named("inner"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, []string{"outer", "middle", "inner"}, requests)
+	// the innermost middleware sets its header first, the outermost last
+	assert.Equal(t, []string{"inner", "middle", "outer"}, rec.Header().Values("X-Order"))
+}
+
+func Test_Logger(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	})
+
+	_, line := serveLogged(t, h, httptest.NewRequest("POST", "/xtz", strings.NewReader("12345")))
+	assert.Equal(t, "info", line["level"])
+	assert.Equal(t, float64(200), line["status"])
+	assert.Equal(t, float64(5), line["req_bytes"])
+	assert.Equal(t, float64(11), line["resp_bytes"])
+	assert.NotContains(t, line, "error_code")
+}
+
+func Test_Logger_error(t *testing.T) {
+	body := `{"error":"invalid year","code":400,"error_code":"invalid_year"}`
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(body))
+	})
+
+	rec, line := serveLogged(t, h, httptest.NewRequest("GET", "/xtz", nil))
+	assert.Equal(t, body, rec.Body.String())
+	assert.Equal(t, "error", line["level"])
+	assert.Equal(t, float64(400), line["status"])
+	assert.Equal(t, float64(0), line["req_bytes"])
+	assert.Equal(t, float64(len(body)), line["resp_bytes"])
+	assert.Equal(t, "invalid_year", line["error_code"])
+}
+
+func Test_Logger_flush(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := w.(http.Flusher)
+		assert.True(t, ok)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	_, line := serveLogged(t, h, httptest.NewRequest("GET", "/xtz", nil))
+	assert.Equal(t, float64(204), line["status"])
+	assert.Equal(t, float64(0), line["resp_bytes"])
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// rateLimitIdle is the inactivity duration after which a client limiter is evicted
+	rateLimitIdle = 5 * time.Minute
+	// rateLimitSweep is the minimum duration between two evictions of idle limiters
+	rateLimitSweep = time.Minute
+)
+
+type clientLimiter struct {
+	limiter *rate.Limiter
+	// last request as unix nano
+	last atomic.Int64
+}
+
+// RateLimit limits the number of requests per second of each client IP
+// using a token bucket of the given burst size.
+// Limited requests are rejected with a 429 and a Retry-After header.
+func RateLimit(rps float64, burst int) Middleware {
+	var (
+		clients   sync.Map
+		lastSweep atomic.Int64
+	)
+
+	sweep := func(now time.Time) {
+		last := lastSweep.Load()
+		if now.UnixNano()-last < int64(rateLimitSweep) || !lastSweep.CompareAndSwap(last, now.UnixNano()) {
+			return
+		}
+		clients.Range(func(key, value any) bool {
+			if now.UnixNano()-value.(*clientLimiter).last.Load() > int64(rateLimitIdle) {
+				clients.Delete(key)
+			}
+			return true
+		})
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+			sweep(now)
+
+			v, _ := clients.LoadOrStore(clientIP(r), &clientLimiter{
+				limiter: rate.NewLimiter(rate.Limit(rps), burst),
+			})
+			client := v.(*clientLimiter)
+			client.last.Store(now.UnixNano())
+
+			res := client.limiter.ReserveN(now, 1)
+			if delay := res.DelayFrom(now); !res.OK() || delay > 0 {
+				res.CancelAt(now)
+				retry := int(math.Ceil(delay.Seconds()))
+				if !res.OK() {
+					retry = int(math.Ceil(rateLimitIdle.Seconds()))
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(max(retry, 1)))
+				writeError(w, "too many requests", http.StatusTooManyRequests, ErrCodeRateLimited)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the IP of the request's remote address, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rateLimitRequest(h http.Handler, remote string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = remote
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func Test_RateLimit(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := RateLimit(1, 2)(ok)
+
+	assert.Equal(t, http.StatusOK, rateLimitRequest(h, "10.0.0.1:1234").Code)
+	assert.Equal(t, http.StatusOK, rateLimitRequest(h, "10.0.0.1:1235").Code)
+
+	rec := rateLimitRequest(h, "10.0.0.1:1236")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":"too many requests","code":429,"error_code":"rate_limited"}`, rec.Body.String())
+
+	// other clients are not limited
+	assert.Equal(t, http.StatusOK, rateLimitRequest(h, "10.0.0.2:1234").Code)
+}
+
+func Test_RateLimit_noBurst(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := RateLimit(1, 0)(ok)
+
+	rec := rateLimitRequest(h, "10.0.0.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+}
+
+func Test_clientIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "[::1]:8080"
+	assert.Equal(t, "::1", clientIP(req))
+
+	req.RemoteAddr = "10.0.0.1"
+	assert.Equal(t, "10.0.0.1", clientIP(req))
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// DefaultMaxRequestBytes is the request body limit used by RequestSizeLimit
+// when no positive limit is given.
+const DefaultMaxRequestBytes int64 = 10 << 20
+
+// RequestSizeLimit caps request bodies to maxBytes, or DefaultMaxRequestBytes
+// if maxBytes is not positive.
+// Requests declaring a bigger Content-Length are rejected with a 413
+// before reaching the handler. Other bodies are wrapped with http.MaxBytesReader,
+// reading past the limit fails with an *http.MaxBytesError.
+func RequestSizeLimit(maxBytes int64) Middleware {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxRequestBytes
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				w.Header().Set("Connection", "close")
+				writeError(w, "request entity too large", http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
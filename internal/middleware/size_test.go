@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readBody(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		assert.NoError(t, err)
+	})
+}
+
+func Test_RequestSizeLimit(t *testing.T) {
+	h := RequestSizeLimit(8)(readBody(t))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader("12345678")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader("123456789")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.JSONEq(t, `{"error":"request entity too large","code":413,"error_code":"payload_too_large"}`, rec.Body.String())
+}
+
+func Test_RequestSizeLimit_unknownLength(t *testing.T) {
+	called := false
+	h := RequestSizeLimit(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		readBody(t).ServeHTTP(w, r)
+	}))
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("123456789"))
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.True(t, called)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func Test_RequestSizeLimit_default(t *testing.T) {
+	h := RequestSizeLimit(0)(readBody(t))
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.ContentLength = DefaultMaxRequestBytes + 1
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
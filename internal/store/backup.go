@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// BackupPath returns the path of a backup made at t inside dir,
+// named delegations-{timestamp}.db.
+func BackupPath(dir string, t time.Time) string {
+	return filepath.Join(dir, "delegations-"+t.UTC().Format("20060102T150405Z")+".db")
+}
+
+// Backup copies the live database to dest using SQLite's online backup API,
+// writers are not blocked while the copy runs.
+// The copy is written next to dest then renamed, so dest is either
+// missing or a complete backup.
+func (s *sqlite) Backup(ctx context.Context, dest string) error {
+	tmp := dest + ".tmp"
+	err := s.backup(ctx, tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+func (s *sqlite) backup(ctx context.Context, dest string) error {
+	destDB, err := sql.Open("sqlite3", dest)
+	if err != nil {
+		return fmt.Errorf("open backup: %w", err)
+	}
+	defer destDB.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("open backup: %w", err)
+	}
+	defer destConn.Close()
+
+	srcConn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destRaw any) error {
+		return srcConn.Raw(func(srcRaw any) error {
+			destSQLite, ok := destRaw.(*sqlite3.SQLiteConn)
+			srcSQLite, ok2 := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("backup: not a sqlite3 connection")
+			}
+
+			b, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return fmt.Errorf("start backup: %w", err)
+			}
+			// copy every page at once
+			_, err = b.Step(-1)
+			if err != nil {
+				b.Finish()
+				return fmt.Errorf("backup: %w", err)
+			}
+			return b.Finish()
+		})
+	})
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BackupPath(t *testing.T) {
+	at := time.Date(2024, time.October, 29, 2, 0, 0, 0, time.UTC)
+	assert.Equal(t, filepath.Join("backups", "delegations-20241029T020000Z.db"), BackupPath("backups", at))
+}
+
+func Test_sqlite_Backup(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	dest := BackupPath(t.TempDir(), time.Now())
+	err := s.Backup(context.Background(), dest)
+	require.NoError(t, err)
+	assert.NoFileExists(t, dest+".tmp")
+
+	backup, err := NewSqLite(context.Background(), dest)
+	require.NoError(t, err)
+	defer backup.Close()
+
+	last, err := backup.LastDelegation(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &delegations[2], last)
+}
+
+func Test_sqlite_Backup_error(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	dest := filepath.Join(t.TempDir(), "missing", "delegations.db")
+	err := s.Backup(context.Background(), dest)
+	assert.Error(t, err)
+	_, err = os.Stat(dest)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Checkpoint marks a point of the sync timeline,
+// the delegations up to Timestamp are expected to be complete.
+type Checkpoint struct {
+	Label     string `json:"label"`
+	Timestamp string `json:"timestamp"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ErrEmptyLabel is returned when a checkpoint has no label.
+var ErrEmptyLabel = errors.New("empty checkpoint label")
+
+// createCheckpointsTable creates the checkpoints table
+// of the databases created before it existed.
+func (s *sqlite) createCheckpointsTable(ctx context.Context) error {
+	const query = `
+	CREATE TABLE IF NOT EXISTS checkpoints (
+		label      TEXT NOT NULL,
+		timestamp  TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	);
+	`
+	_, err := s.db.ExecContext(ctx, query)
+	return err
+}
+
+// CreateCheckpoint marks the given timestamp with a label.
+// The timestamp should be in RFC3339 format.
+func (s *sqlite) CreateCheckpoint(ctx context.Context, label, timestamp string) error {
+	if label == "" {
+		return ErrEmptyLabel
+	}
+	const query = `
+	INSERT INTO checkpoints (label, timestamp, created_at)
+	VALUES (?, ?, ?);
+	`
+	_, err := s.db.ExecContext(ctx, query, label, timestamp, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// GetCheckpoints returns every checkpoint, by creation order.
+func (s sqlite) GetCheckpoints(ctx context.Context) ([]Checkpoint, error) {
+	const query = `
+	SELECT label, timestamp, created_at
+	FROM checkpoints
+	ORDER BY rowid;
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkpoints := []Checkpoint{}
+	for rows.Next() {
+		var c Checkpoint
+		err = rows.Scan(&c.Label, &c.Timestamp, &c.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	return checkpoints, rows.Err()
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sqlite_Checkpoints(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	checkpoints, err := s.GetCheckpoints(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, checkpoints)
+
+	require.NoError(t, s.CreateCheckpoint(context.Background(), "backfill", "2024-01-01T00:00:00Z"))
+	require.NoError(t, s.CreateCheckpoint(context.Background(), "verified", "2023-01-01T00:00:00Z"))
+	assert.ErrorIs(t, s.CreateCheckpoint(context.Background(), "", "2023-01-01T00:00:00Z"), ErrEmptyLabel)
+
+	checkpoints, err = s.GetCheckpoints(context.Background())
+	require.NoError(t, err)
+	require.Len(t, checkpoints, 2)
+	assert.Equal(t, "backfill", checkpoints[0].Label)
+	assert.Equal(t, "2024-01-01T00:00:00Z", checkpoints[0].Timestamp)
+	assert.Equal(t, "verified", checkpoints[1].Label)
+	_, err = time.Parse(time.RFC3339, checkpoints[1].CreatedAt)
+	assert.NoError(t, err)
+}
+
+func Test_sqlite_Checkpoints_sharded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "delegations.db")
+	s, err := NewSqLite(context.Background(), path)
+	require.NoError(t, err)
+	require.NoError(t, s.CreateCheckpoint(context.Background(), "backfill", "2024-01-01T00:00:00Z"))
+	require.NoError(t, s.Close())
+
+	_, err = MigrateToShards(context.Background(), path)
+	require.NoError(t, err)
+
+	s, err = NewSqLite(context.Background(), path)
+	require.NoError(t, err)
+	defer s.Close()
+	checkpoints, err := s.GetCheckpoints(context.Background())
+	require.NoError(t, err)
+	require.Len(t, checkpoints, 1)
+	assert.Equal(t, "backfill", checkpoints[0].Label)
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	tds "github.com/frieeze/tezos-delegation"
+)
+
+// ErrInvalidCursor is returned when a delta or page cursor is not a delegation id.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// GetDelta returns at most limit delegations of a given year
+// with an id greater than since, an empty since starts from the first one.
+// Delegations are ordered by id in ascending order.
+func (s sqlite) GetDelta(ctx context.Context, year, since string, limit int) (tds.DelegationSlice, error) {
+	var cursor int64
+	if since != "" {
+		var err error
+		cursor, err = strconv.ParseInt(since, 10, 64)
+		if err != nil || cursor < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCursor, since)
+		}
+	}
+
+	const query = `
+	SELECT level, delegator, amount, timestamp, id, baker, operation_hash
+	FROM delegations
+	WHERE CAST(id AS INTEGER) > ? AND year = ?
+	ORDER BY CAST(id AS INTEGER) ASC
+	LIMIT ?;
+	`
+	rows, err := s.db.QueryContext(ctx, query, cursor, year, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(ctx, rows)
+
+	return scanDelegations(ctx, rows)
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sqlite_GetDelta(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ds := tds.DelegationSlice{
+		{ID: "9", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+		{ID: "10", Timestamp: "2024-01-02T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "2"},
+		{ID: "11", Timestamp: "2023-12-31T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "3"},
+		{ID: "12", Timestamp: "2024-01-03T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "4"},
+	}
+	require.NoError(t, s.Insert(context.Background(), ds))
+
+	// ids are compared as integers, "10" comes after "9"
+	delta, err := s.GetDelta(context.Background(), "2024", "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{ds[0], ds[1]}, delta)
+
+	delta, err = s.GetDelta(context.Background(), "2024", "10", 2)
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{ds[3]}, delta)
+
+	delta, err = s.GetDelta(context.Background(), "2024", "12", 2)
+	require.NoError(t, err)
+	assert.Empty(t, delta)
+
+	for _, since := range []string{"abc", "-1", "1 OR 1=1"} {
+		_, err = s.GetDelta(context.Background(), "2024", since, 2)
+		assert.ErrorIs(t, err, ErrInvalidCursor, since)
+	}
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	tds "github.com/frieeze/tezos-delegation"
+)
+
+// Export and import formats.
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// importBatchSize is the number of delegations inserted at once by Import.
+const importBatchSize = 1000
+
+var (
+	// ErrUnknownFormat is returned when the export format is not supported.
+	ErrUnknownFormat = errors.New("unknown format")
+	// ErrInvalidCSVHeader is returned when an imported csv does not start with tds.CSVHeader.
+	ErrInvalidCSVHeader = errors.New("invalid csv header")
+)
+
+// jsonlDelegation exposes the delegation id,
+// which is needed to import the delegations back.
+type jsonlDelegation struct {
+	tds.Delegation
+	ID string `json:"id"`
+}
+
+// Export writes every delegation to w, ordered by ascending timestamps.
+// Rows are streamed from the database cursor, one at a time.
+// Supported formats are FormatCSV and FormatJSONL.
+func (s *sqlite) Export(ctx context.Context, w io.Writer, format string) error {
+	var write func(d tds.Delegation) error
+	var flush func() error
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(tds.CSVHeader); err != nil {
+			return err
+		}
+		write = func(d tds.Delegation) error { return cw.Write(d.CSV()) }
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		write = func(d tds.Delegation) error { return enc.Encode(jsonlDelegation{Delegation: d, ID: d.ID}) }
+		flush = func() error { return nil }
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+
+	const query = `
+	SELECT level, delegator, amount, timestamp, id, baker, operation_hash
+	FROM delegations
+	ORDER BY timestamp, CAST(id AS INTEGER);
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d tds.Delegation
+		err := rows.Scan(&d.Level, &d.Delegator, &d.Amount, &d.Timestamp, &d.ID, &d.Baker, &d.OperationHash)
+		if err != nil {
+			return err
+		}
+		if err := write(d); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// Import reads the delegations written by Export from r
+// and inserts them in batches of importBatchSize.
+// Returns the number of delegations read, duplicates included.
+func (s *sqlite) Import(ctx context.Context, r io.Reader, format string) (int64, error) {
+	var read func() (tds.Delegation, error)
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		header, err := cr.Read()
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if err == io.EOF || !slices.Equal(header, tds.CSVHeader) {
+			return 0, ErrInvalidCSVHeader
+		}
+		read = func() (tds.Delegation, error) {
+			record, err := cr.Read()
+			if err != nil {
+				return tds.Delegation{}, err
+			}
+			return tds.Delegation{
+				ID:        record[0],
+				Timestamp: record[1],
+				Delegator: record[2],
+				Amount:    record[3],
+				Level:     record[4],
+				Baker:     record[5],
+			}, nil
+		}
+	case FormatJSONL:
+		dec := json.NewDecoder(r)
+		read = func() (tds.Delegation, error) {
+			var d jsonlDelegation
+			if err := dec.Decode(&d); err != nil {
+				return tds.Delegation{}, err
+			}
+			d.Delegation.ID = d.ID
+			return d.Delegation, nil
+		}
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+
+	var count int64
+	batch := make([]tds.Delegation, 0, importBatchSize)
+	for {
+		d, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("read delegation %d: %w", count+1, err)
+		}
+		batch = append(batch, d)
+		if len(batch) == importBatchSize {
+			if err := s.Insert(ctx, batch); err != nil {
+				return count, err
+			}
+			count += int64(len(batch))
+			batch = batch[:0]
+		}
+	}
+	if err := s.Insert(ctx, batch); err != nil {
+		return count, err
+	}
+	return count + int64(len(batch)), nil
+}
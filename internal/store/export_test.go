@@ -0,0 +1,103 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sqlite_Export_CSV(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	var buf bytes.Buffer
+	err := s.Export(context.Background(), &buf, FormatCSV)
+	require.NoError(t, err)
+
+	assert.Equal(t, `id,timestamp,delegator,amount,level,baker
+1401626186219520,2020-10-29T10:22:25Z,tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms,13814013,6976378,tz1aRoaRhSpRYvFdyvgWLL6TGyRoGF51wDjM
+1401610442899456,2021-10-29T10:10:00Z,tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP,2548493,6976305,
+1401609161539584,2022-10-29T10:09:00Z,tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP,2548751,6976299,tz1aRoaRhSpRYvFdyvgWLL6TGyRoGF51wDjM
+`, buf.String())
+}
+
+func Test_sqlite_Export_JSONL(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	var buf bytes.Buffer
+	err := s.Export(context.Background(), &buf, FormatJSONL)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, len(delegations))
+	assert.JSONEq(t, `{
+		"id":"1401626186219520",
+		"timestamp":"2020-10-29T10:22:25Z",
+		"delegator":"tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms",
+		"amount":"13814013",
+		"level":"6976378",
+		"baker":"tz1aRoaRhSpRYvFdyvgWLL6TGyRoGF51wDjM"
+	}`, lines[0])
+}
+
+func Test_sqlite_Export_unknownFormat(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	err := s.Export(context.Background(), &bytes.Buffer{}, "xml")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+
+	_, err = s.Import(context.Background(), strings.NewReader(""), "xml")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func Test_sqlite_Import(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			ds := fakeDelegations(2500)
+			src, err := NewSqLite(context.Background(), memoryPath)
+			require.NoError(t, err)
+			defer src.Close()
+			require.NoError(t, src.Insert(context.Background(), ds))
+
+			var buf bytes.Buffer
+			require.NoError(t, src.Export(context.Background(), &buf, format))
+
+			dst, err := NewSqLite(context.Background(), memoryPath)
+			require.NoError(t, err)
+			defer dst.Close()
+
+			count, err := dst.Import(context.Background(), &buf, format)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(ds)), count)
+
+			var exported bytes.Buffer
+			require.NoError(t, src.Export(context.Background(), &exported, format))
+			var imported bytes.Buffer
+			require.NoError(t, dst.Export(context.Background(), &imported, format))
+			assert.Equal(t, exported.String(), imported.String())
+		})
+	}
+}
+
+func Test_sqlite_Import_invalidCSVHeader(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Import(context.Background(), strings.NewReader("timestamp,delegator\n"), FormatCSV)
+	assert.ErrorIs(t, err, ErrInvalidCSVHeader)
+
+	_, err = s.Import(context.Background(), strings.NewReader(""), FormatCSV)
+	assert.ErrorIs(t, err, ErrInvalidCSVHeader)
+
+	count, err := s.Import(context.Background(), strings.NewReader(strings.Join(tds.CSVHeader, ",")+"\n"), FormatCSV)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/rs/zerolog/log"
+)
+
+// DelegationFilter selects the delegations returned by Query.
+// Nil fields are ignored.
+type DelegationFilter struct {
+	// Delegator only keeps the delegations of this address.
+	Delegator *string
+	// Year only keeps the delegations of this year, in the format "2006".
+	Year *string
+	// Month only keeps the delegations of this month of Year, in the format "01".
+	Month *string
+	// From only keeps the delegations made at or after this date.
+	From *time.Time
+	// To only keeps the delegations made before this date.
+	To *time.Time
+	// MinAmount only keeps the delegations of at least this amount.
+	MinAmount *int64
+	// MaxAmount only keeps the delegations of at most this amount.
+	MaxAmount *int64
+	// Baker only keeps the delegations to this baker.
+	Baker *string
+	// Limit caps the number of delegations returned, 0 means no limit.
+	Limit int
+	// After only keeps the delegations ordered after the one with this id,
+	// allowing to page through results.
+	After string
+	// SortOrder orders the delegations by timestamp, SortAsc or SortDesc (the default).
+	SortOrder string
+}
+
+// ErrInvalidMonth is returned when a month is not between "01" and "12".
+var ErrInvalidMonth = errors.New("invalid month")
+
+// validateMonth checks that month is a two digit month, from "01" to "12".
+func validateMonth(month string) error {
+	if m, err := strconv.Atoi(month); len(month) != 2 || err != nil || m < 1 || m > 12 {
+		return fmt.Errorf("%w: %q", ErrInvalidMonth, month)
+	}
+	return nil
+}
+
+// DelegationFilter sort orders.
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// direction returns the SQL direction of the sort order.
+// Only whitelisted orders are accepted.
+func (f DelegationFilter) direction() (string, error) {
+	switch f.SortOrder {
+	case SortDesc, "":
+		return "DESC", nil
+	case SortAsc:
+		return "ASC", nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidSort, f.SortOrder)
+	}
+}
+
+// build returns the WHERE clause matching the filter and its arguments.
+func (f DelegationFilter) build() (string, []any, error) {
+	dir, err := f.direction()
+	if err != nil {
+		return "", nil, err
+	}
+	var (
+		conds []string
+		args  []any
+	)
+	if f.Delegator != nil {
+		conds = append(conds, "delegator = ?")
+		args = append(args, *f.Delegator)
+	}
+	if f.Month != nil {
+		if f.Year == nil {
+			return "", nil, fmt.Errorf("%w: month without a year", ErrInvalidMonth)
+		}
+		if err := validateMonth(*f.Month); err != nil {
+			return "", nil, err
+		}
+		conds = append(conds, "year = ?", "timestamp LIKE ?")
+		args = append(args, *f.Year, *f.Year+"-"+*f.Month+"%")
+	} else if f.Year != nil {
+		conds = append(conds, "year = ?")
+		args = append(args, *f.Year)
+	}
+	if f.From != nil {
+		conds = append(conds, "timestamp >= ?")
+		args = append(args, f.From.UTC().Format(time.RFC3339))
+	}
+	if f.To != nil {
+		conds = append(conds, "timestamp < ?")
+		args = append(args, f.To.UTC().Format(time.RFC3339))
+	}
+	if f.MinAmount != nil {
+		conds = append(conds, "CAST(amount AS INTEGER) >= ?")
+		args = append(args, *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		conds = append(conds, "CAST(amount AS INTEGER) <= ?")
+		args = append(args, *f.MaxAmount)
+	}
+	if f.Baker != nil {
+		conds = append(conds, "baker = ?")
+		args = append(args, *f.Baker)
+	}
+	if f.After != "" {
+		cmp := "<"
+		if dir == "ASC" {
+			cmp = ">"
+		}
+		conds = append(conds, `(timestamp, CAST(id AS INTEGER)) `+cmp+`
+		(SELECT timestamp, CAST(id AS INTEGER) FROM delegations WHERE id = ?)`)
+		args = append(args, f.After)
+	}
+
+	if len(conds) == 0 {
+		return "", args, nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+// Query returns the delegations matching the filter.
+// Delegations are ordered by timestamp in descending order,
+// unless the filter sort order is SortAsc.
+func (s sqlite) Query(ctx context.Context, f DelegationFilter) (tds.DelegationSlice, error) {
+	rows, err := s.queryRows(ctx, f)
+	if err != nil || rows == nil {
+		return tds.DelegationSlice{}, err
+	}
+	defer closeRows(ctx, rows)
+
+	return scanDelegations(ctx, rows)
+}
+
+// queryRows runs the query of the filter.
+// The rows are nil when no table can hold matching delegations.
+func (s sqlite) queryRows(ctx context.Context, f DelegationFilter) (*sql.Rows, error) {
+	where, args, err := f.build()
+	if err != nil {
+		return nil, err
+	}
+	// whitelisted by build
+	dir, _ := f.direction()
+	from, ok, err := s.source(ctx, f)
+	if err != nil || !ok {
+		return nil, err
+	}
+	query := `
+	SELECT level, delegator, amount, timestamp, id, baker, operation_hash
+	FROM ` + from + `
+	` + where + `
+	ORDER BY timestamp ` + dir + `, CAST(id AS INTEGER) ` + dir
+	if f.Limit > 0 {
+		query += `
+	LIMIT ?`
+		args = append(args, f.Limit)
+	}
+
+	return s.db.QueryContext(ctx, query+";", args...)
+}
+
+// scanDelegations reads all the delegations of the given rows.
+// It stops early if ctx is done, returning the delegations read so far and the context error.
+func scanDelegations(ctx context.Context, rows *sql.Rows) (tds.DelegationSlice, error) {
+	var delegations = tds.DelegationSlice{}
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return delegations, err
+		}
+		var d tds.Delegation
+		err := rows.Scan(
+			&d.Level,
+			&d.Delegator,
+			&d.Amount,
+			&d.Timestamp,
+			&d.ID,
+			&d.Baker,
+			&d.OperationHash,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delegations = append(delegations, d)
+	}
+	return delegations, rows.Err()
+}
+
+// closeRows closes rows and logs the error, to be deferred by the scans.
+func closeRows(ctx context.Context, rows *sql.Rows) {
+	if err := rows.Close(); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to close rows")
+	}
+}
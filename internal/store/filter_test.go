@@ -0,0 +1,250 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func Test_sqlite_Query(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	tests := []struct {
+		name   string
+		filter DelegationFilter
+		want   tds.DelegationSlice
+	}{
+		{
+			name: "no filter",
+			want: tds.DelegationSlice{delegations[2], delegations[1], delegations[0]},
+		},
+		{
+			name:   "delegator",
+			filter: DelegationFilter{Delegator: ptr("tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP")},
+			want:   tds.DelegationSlice{delegations[2], delegations[1]},
+		},
+		{
+			name:   "year",
+			filter: DelegationFilter{Year: ptr("2020")},
+			want:   tds.DelegationSlice{delegations[0]},
+		},
+		{
+			name: "date range",
+			filter: DelegationFilter{
+				From: ptr(time.Date(2021, time.October, 29, 10, 10, 0, 0, time.UTC)),
+				To:   ptr(time.Date(2022, time.October, 29, 10, 9, 0, 0, time.UTC)),
+			},
+			want: tds.DelegationSlice{delegations[1]},
+		},
+		{
+			name:   "amount range",
+			filter: DelegationFilter{MinAmount: ptr(int64(2548493)), MaxAmount: ptr(int64(2548751))},
+			want:   tds.DelegationSlice{delegations[2], delegations[1]},
+		},
+		{
+			name:   "limit",
+			filter: DelegationFilter{Limit: 1},
+			want:   tds.DelegationSlice{delegations[2]},
+		},
+		{
+			name:   "after",
+			filter: DelegationFilter{After: delegations[2].ID},
+			want:   tds.DelegationSlice{delegations[1], delegations[0]},
+		},
+		{
+			name:   "ascending",
+			filter: DelegationFilter{SortOrder: SortAsc},
+			want:   tds.DelegationSlice{delegations[0], delegations[1], delegations[2]},
+		},
+		{
+			name:   "descending",
+			filter: DelegationFilter{SortOrder: SortDesc},
+			want:   tds.DelegationSlice{delegations[2], delegations[1], delegations[0]},
+		},
+		{
+			name:   "ascending after",
+			filter: DelegationFilter{SortOrder: SortAsc, After: delegations[0].ID, Limit: 1},
+			want:   tds.DelegationSlice{delegations[1]},
+		},
+		{
+			name:   "no match",
+			filter: DelegationFilter{Year: ptr("2020"), Delegator: ptr("tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP")},
+			want:   tds.DelegationSlice{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds, err := s.Query(context.Background(), tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ds)
+		})
+	}
+}
+
+func Test_sqlite_Query_invalidSortOrder(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	_, err := s.Query(context.Background(), DelegationFilter{SortOrder: "timestamp; DROP TABLE delegations"})
+	assert.ErrorIs(t, err, ErrInvalidSort)
+}
+
+func Test_sqlite_Query_Paging(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	var (
+		all   []tds.Delegation
+		after string
+	)
+	for {
+		ds, err := s.Query(context.Background(), DelegationFilter{Limit: 2, After: after})
+		require.NoError(t, err)
+		if len(ds) == 0 {
+			break
+		}
+		all = append(all, ds...)
+		after = ds[len(ds)-1].ID
+	}
+	assert.Equal(t, []tds.Delegation{delegations[2], delegations[1], delegations[0]}, all)
+}
+
+func Test_sqlite_Query_Baker(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	ds, err := s.Query(context.Background(), DelegationFilter{Baker: ptr("tz1aRoaRhSpRYvFdyvgWLL6TGyRoGF51wDjM")})
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{delegations[2], delegations[0]}, ds)
+}
+
+func Test_sqlite_GetByBaker(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	ds, err := s.GetByBaker(context.Background(), "tz1aRoaRhSpRYvFdyvgWLL6TGyRoGF51wDjM")
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{delegations[2], delegations[0]}, ds)
+
+	ds, err = s.GetByBaker(context.Background(), "tz1unknownUUUUUUUUUUUUUUUUUUUUUUUUUU")
+	require.NoError(t, err)
+	assert.Empty(t, ds)
+}
+
+func Test_sqlite_GetByTimestamp(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"unified": nil,
+		"sharded": {WithYearSharding()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := NewSqLite(context.Background(), memoryPath, opts...)
+			require.NoError(t, err)
+			defer s.Close()
+
+			ds := tds.DelegationSlice{
+				{ID: "1", Timestamp: "2024-10-29T10:22:25Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+				{ID: "2", Timestamp: "2024-10-29T10:22:26Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "2"},
+				{ID: "3", Timestamp: "2024-10-29T10:22:25Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "1", Level: "1"},
+			}
+			require.NoError(t, s.Insert(context.Background(), ds))
+
+			got, err := s.GetByTimestamp(context.Background(), "2024-10-29T10:22:25Z")
+			require.NoError(t, err)
+			assert.Equal(t, tds.DelegationSlice{ds[2], ds[0]}, got)
+
+			got, err = s.GetByTimestamp(context.Background(), "2024-10-29T10:22:27Z")
+			require.NoError(t, err)
+			assert.Empty(t, got)
+
+			// the timestamps are indexed, in each per year table once sharded
+			var indexes int
+			err = s.(*sqlite).db.QueryRow(`SELECT COUNT(*) FROM sqlite_master
+			WHERE type = 'index' AND name LIKE 'idx_timestamp%';`).Scan(&indexes)
+			require.NoError(t, err)
+			assert.Equal(t, 1, indexes)
+		})
+	}
+}
+
+func Test_sqlite_GetByOperationHash(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"unified": nil,
+		"sharded": {WithYearSharding()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := NewSqLite(context.Background(), memoryPath, opts...)
+			require.NoError(t, err)
+			defer s.Close()
+
+			ds := tds.DelegationSlice{
+				{ID: "1", Timestamp: "2023-10-29T10:22:25Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1", OperationHash: "ooA"},
+				{ID: "2", Timestamp: "2024-10-29T10:22:26Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "2", OperationHash: "ooB"},
+				{ID: "3", Timestamp: "2024-10-29T10:22:27Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "1", Level: "3"},
+			}
+			require.NoError(t, s.Insert(context.Background(), ds))
+
+			got, err := s.GetByOperationHash(context.Background(), "ooB")
+			require.NoError(t, err)
+			assert.Equal(t, tds.DelegationSlice{ds[1]}, got)
+
+			got, err = s.GetByOperationHash(context.Background(), "ooC")
+			require.NoError(t, err)
+			assert.Empty(t, got)
+
+			// the delegations stored without hash don't match
+			got, err = s.GetByOperationHash(context.Background(), "")
+			require.NoError(t, err)
+			assert.Empty(t, got)
+		})
+	}
+}
+
+func Test_sqlite_GetByDelegator(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	ds, err := s.GetByDelegator(context.Background(), "tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms")
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{delegations[0]}, ds)
+}
+
+func Test_sqlite_GetByMonth(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ds := tds.DelegationSlice{
+		{ID: "1", Timestamp: "2023-12-31T23:59:59Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+		{ID: "2", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "2"},
+		{ID: "3", Timestamp: "2024-01-31T23:59:59Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "3"},
+		{ID: "4", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "4"},
+		{ID: "5", Timestamp: "2024-12-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "5"},
+		{ID: "6", Timestamp: "2025-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "6"},
+	}
+	require.NoError(t, s.Insert(context.Background(), ds))
+
+	january, err := s.GetByMonth(context.Background(), "2024", "01")
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{ds[2], ds[1]}, january)
+
+	december, err := s.GetByMonth(context.Background(), "2024", "12")
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{ds[4]}, december)
+
+	for _, month := range []string{"1", "00", "13", "ab", "1%"} {
+		_, err = s.GetByMonth(context.Background(), "2024", month)
+		assert.ErrorIs(t, err, ErrInvalidMonth, month)
+	}
+
+	_, err = s.Query(context.Background(), DelegationFilter{Month: ptr("01")})
+	assert.ErrorIs(t, err, ErrInvalidMonth)
+}
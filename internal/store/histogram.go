@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrInvalidBuckets is returned when histogram boundaries are empty or not increasing.
+var ErrInvalidBuckets = errors.New("invalid buckets")
+
+// Bucket is the number of delegations of an amount range of a histogram.
+type Bucket struct {
+	// Min is the lowest amount of the range, in mutez.
+	Min int64 `json:"min"`
+	// Max is the amount excluded from the range, in mutez,
+	// math.MaxInt64 for the last, unbounded, range.
+	Max   int64 `json:"max"`
+	Count int64 `json:"count"`
+}
+
+// GetAmountHistogram returns the number of delegations of a given year
+// in each amount range delimited by the strictly increasing boundaries, in mutez.
+// Boundaries [0, 10, 100] count the amounts in [0,10), [10,100) and [100,∞),
+// amounts below the first boundary are not counted.
+// The year should be in the format "2006".
+func (s sqlite) GetAmountHistogram(ctx context.Context, year string, boundaries []int64) ([]Bucket, error) {
+	if len(boundaries) == 0 {
+		return nil, fmt.Errorf("%w: no boundary", ErrInvalidBuckets)
+	}
+	buckets := make([]Bucket, len(boundaries))
+	for i, boundary := range boundaries {
+		if i > 0 && boundary <= boundaries[i-1] {
+			return nil, fmt.Errorf("%w: %d is not greater than %d", ErrInvalidBuckets, boundary, boundaries[i-1])
+		}
+		buckets[i] = Bucket{Min: boundary, Max: math.MaxInt64}
+		if i > 0 {
+			buckets[i-1].Max = boundary
+		}
+	}
+
+	// bucket maps each amount to the index of its bucket
+	bucket := "0"
+	args := make([]any, 0, len(boundaries)+2)
+	if len(buckets) > 1 {
+		var cases strings.Builder
+		cases.WriteString("CASE ")
+		for i, b := range buckets[:len(buckets)-1] {
+			fmt.Fprintf(&cases, "WHEN amount < ? THEN %d ", i)
+			args = append(args, b.Max)
+		}
+		fmt.Fprintf(&cases, "ELSE %d END", len(buckets)-1)
+		bucket = cases.String()
+	}
+	args = append(args, year, boundaries[0])
+	query := `
+	SELECT ` + bucket + ` AS bucket, COUNT(*)
+	FROM (
+		SELECT CAST(amount AS INTEGER) AS amount
+		FROM delegations
+		WHERE year = ?
+	)
+	WHERE amount >= ?
+	GROUP BY bucket;
+	`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			i     int
+			count int64
+		)
+		if err := rows.Scan(&i, &count); err != nil {
+			return nil, err
+		}
+		buckets[i].Count = count
+	}
+	return buckets, rows.Err()
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sqlite_GetAmountHistogram(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.Insert(context.Background(), tds.DelegationSlice{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "5", Level: "1"},
+		{ID: "2", Timestamp: "2024-01-02T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "999999", Level: "2"},
+		{ID: "3", Timestamp: "2024-01-03T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1000000", Level: "3"},
+		{ID: "4", Timestamp: "2024-01-04T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "250000000", Level: "4"},
+		{ID: "5", Timestamp: "2023-01-04T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "7", Level: "5"},
+	}))
+
+	buckets, err := s.GetAmountHistogram(context.Background(), "2024", []int64{0, 1e6, 10e6, 100e6})
+	require.NoError(t, err)
+	assert.Equal(t, []Bucket{
+		{Min: 0, Max: 1e6, Count: 2},
+		{Min: 1e6, Max: 10e6, Count: 1},
+		{Min: 10e6, Max: 100e6, Count: 0},
+		{Min: 100e6, Max: math.MaxInt64, Count: 1},
+	}, buckets)
+
+	// amounts below the first boundary are left out
+	buckets, err = s.GetAmountHistogram(context.Background(), "2024", []int64{10})
+	require.NoError(t, err)
+	assert.Equal(t, []Bucket{{Min: 10, Max: math.MaxInt64, Count: 3}}, buckets)
+
+	for _, boundaries := range [][]int64{nil, {10, 10}, {10, 5}} {
+		_, err = s.GetAmountHistogram(context.Background(), "2024", boundaries)
+		assert.ErrorIs(t, err, ErrInvalidBuckets, boundaries)
+	}
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	tds "github.com/frieeze/tezos-delegation"
+)
+
+// DelegationIter reads delegations one at a time from the database cursor,
+// without loading the whole result in memory.
+// It must be closed, the store connection is held until then.
+type DelegationIter interface {
+	// Next returns the next delegation, false once the iteration is over.
+	Next() (tds.Delegation, bool)
+	// Err returns the error that ended the iteration, if any.
+	Err() error
+	// Close releases the cursor.
+	Close() error
+}
+
+// rowsIter is the DelegationIter of sql rows, nil rows yield no delegation.
+type rowsIter struct {
+	ctx  context.Context
+	rows *sql.Rows
+	err  error
+}
+
+func (it *rowsIter) Next() (tds.Delegation, bool) {
+	if it.rows == nil || it.err != nil || !it.rows.Next() {
+		return tds.Delegation{}, false
+	}
+	if it.err = it.ctx.Err(); it.err != nil {
+		return tds.Delegation{}, false
+	}
+	var d tds.Delegation
+	it.err = it.rows.Scan(&d.Level, &d.Delegator, &d.Amount, &d.Timestamp, &d.ID, &d.Baker, &d.OperationHash)
+	return d, it.err == nil
+}
+
+func (it *rowsIter) Err() error {
+	if it.err != nil || it.rows == nil {
+		return it.err
+	}
+	return it.rows.Err()
+}
+
+func (it *rowsIter) Close() error {
+	if it.rows == nil {
+		return nil
+	}
+	return it.rows.Close()
+}
+
+// QueryIter returns an iterator over the delegations matching the filter,
+// in the order of Query.
+func (s sqlite) QueryIter(ctx context.Context, f DelegationFilter) (DelegationIter, error) {
+	rows, err := s.queryRows(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return &rowsIter{ctx: ctx, rows: rows}, nil
+}
+
+// GetByYearIter returns an iterator over the delegations of a given year.
+// Delegations are ordered by timestamp in descending order.
+// The year should be in the format "2006".
+func (s sqlite) GetByYearIter(ctx context.Context, year string) (DelegationIter, error) {
+	return s.QueryIter(ctx, DelegationFilter{Year: &year})
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collect(t *testing.T, it DelegationIter) tds.DelegationSlice {
+	t.Helper()
+	got := tds.DelegationSlice{}
+	for d, ok := it.Next(); ok; d, ok = it.Next() {
+		got = append(got, d)
+	}
+	return got
+}
+
+func Test_sqlite_GetByYearIter(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"unified": nil,
+		"sharded": {WithYearSharding()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := NewSqLite(context.Background(), memoryPath, opts...)
+			require.NoError(t, err)
+			defer s.Close()
+			require.NoError(t, s.Insert(context.Background(), fakeDelegations(25)))
+
+			want, err := s.GetByYear(context.Background(), "2024")
+			require.NoError(t, err)
+			it, err := s.GetByYearIter(context.Background(), "2024")
+			require.NoError(t, err)
+			assert.Equal(t, want, collect(t, it))
+			assert.NoError(t, it.Err())
+			require.NoError(t, it.Close())
+
+			// the connection is released once closed
+			it, err = s.GetByYearIter(context.Background(), "2020")
+			require.NoError(t, err)
+			assert.Empty(t, collect(t, it))
+			assert.NoError(t, it.Err())
+			require.NoError(t, it.Close())
+		})
+	}
+}
+
+func Test_sqlite_QueryIter(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+	ds := fakeDelegations(10)
+	require.NoError(t, s.Insert(context.Background(), ds))
+
+	year := "2024"
+	it, err := s.QueryIter(context.Background(), DelegationFilter{Year: &year, Limit: 2, SortOrder: SortAsc})
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{ds[0], ds[1]}, collect(t, it))
+	require.NoError(t, it.Close())
+
+	_, err = s.QueryIter(context.Background(), DelegationFilter{SortOrder: "up"})
+	assert.ErrorIs(t, err, ErrInvalidSort)
+
+	// canceled after the first row
+	it, err = s.QueryIter(&cancelAfter{Context: context.Background(), n: 1}, DelegationFilter{Year: &year})
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{ds[9]}, collect(t, it))
+	assert.ErrorIs(t, it.Err(), context.Canceled)
+	require.NoError(t, it.Close())
+}
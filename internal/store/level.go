@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	tds "github.com/frieeze/tezos-delegation"
+)
+
+// ErrInvalidLevel is returned when a level is not an integer.
+var ErrInvalidLevel = errors.New("invalid level")
+
+func parseLevel(level string) (int64, error) {
+	l, err := strconv.ParseInt(level, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidLevel, level)
+	}
+	return l, nil
+}
+
+// GetByLevelRange returns the delegations between minLevel and maxLevel (both included).
+// Delegations are ordered by level in descending order.
+func (s sqlite) GetByLevelRange(ctx context.Context, minLevel, maxLevel string) (tds.DelegationSlice, error) {
+	lo, err := parseLevel(minLevel)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := parseLevel(maxLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	const query = `
+	SELECT level, delegator, amount, timestamp, id, baker, operation_hash
+	FROM delegations
+	WHERE CAST(level AS INTEGER) >= ? AND CAST(level AS INTEGER) <= ?
+	ORDER BY CAST(level AS INTEGER) DESC, CAST(id AS INTEGER) DESC;
+	`
+	rows, err := s.db.QueryContext(ctx, query, lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(ctx, rows)
+
+	return scanDelegations(ctx, rows)
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sqlite_GetByLevelRange(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	ds, err := s.GetByLevelRange(context.Background(), "6976300", "6976378")
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{delegations[0], delegations[1]}, ds)
+
+	ds, err = s.GetByLevelRange(context.Background(), "6976299", "6976299")
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{delegations[2]}, ds)
+
+	ds, err = s.GetByLevelRange(context.Background(), "1", "2")
+	require.NoError(t, err)
+	assert.Empty(t, ds)
+
+	_, err = s.GetByLevelRange(context.Background(), "1", "1e9")
+	assert.ErrorIs(t, err, ErrInvalidLevel)
+}
+
+func Test_sqlite_Insert_invalidLevel(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	err := s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+		{ID: "2", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "two"},
+	})
+	assert.ErrorIs(t, err, tds.ErrInvalidDelegation)
+	assert.ErrorContains(t, err, `id "2"`)
+
+	count, err := s.CountByYear(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupportedDatabase is returned when a database url selects a backend
+// this build doesn't provide.
+var ErrUnsupportedDatabase = errors.New("unsupported database")
+
+// postgresSchemes are the url schemes selecting the PostgreSQL backend.
+var postgresSchemes = []string{"postgres://", "postgresql://"}
+
+// IsPostgresURL reports whether databaseURL selects the PostgreSQL backend.
+func IsPostgresURL(databaseURL string) bool {
+	for _, scheme := range postgresSchemes {
+		if strings.HasPrefix(strings.ToLower(databaseURL), scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Open opens the store of databaseURL: postgres:// and postgresql:// urls
+// select the PostgreSQL backend, any other value is a SQLite file path.
+// The PostgreSQL backend isn't available yet, its urls fail with ErrUnsupportedDatabase.
+func Open(ctx context.Context, databaseURL string, opts ...Option) (Store, error) {
+	if IsPostgresURL(databaseURL) {
+		// the url is left out of the error, it may hold a password
+		return nil, fmt.Errorf("%w: postgres", ErrUnsupportedDatabase)
+	}
+	return NewSqLite(ctx, databaseURL, opts...)
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	tds "github.com/frieeze/tezos-delegation"
+)
+
+// GetByYearWithCount returns a page of at most limit delegations of a given year,
+// skipping the first offset ones, along with the number of delegations of the year.
+// Delegations are ordered by timestamp in descending order, a limit of 0 means no limit.
+// The year should be in the format "2006".
+func (s sqlite) GetByYearWithCount(ctx context.Context, year string, limit, offset int) (tds.DelegationSlice, int64, error) {
+	if limit <= 0 {
+		// a negative limit is no limit for sqlite
+		limit = -1
+	}
+
+	// the window function counts every row of the year
+	// before LIMIT and OFFSET are applied
+	const query = `
+	SELECT level, delegator, amount, timestamp, id, baker, operation_hash, COUNT(*) OVER() AS total_count
+	FROM delegations
+	WHERE year = ?
+	ORDER BY timestamp DESC, CAST(id AS INTEGER) DESC
+	LIMIT ? OFFSET ?;
+	`
+	rows, err := s.db.QueryContext(ctx, query, year, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer closeRows(ctx, rows)
+
+	var (
+		delegations = tds.DelegationSlice{}
+		total       int64
+	)
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return delegations, total, err
+		}
+		var d tds.Delegation
+		err := rows.Scan(
+			&d.Level,
+			&d.Delegator,
+			&d.Amount,
+			&d.Timestamp,
+			&d.ID,
+			&d.Baker,
+			&d.OperationHash,
+			&total,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		delegations = append(delegations, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(delegations) > 0 || offset == 0 {
+		return delegations, total, nil
+	}
+
+	// past the last page there is no row to carry the count
+	rows.Close()
+	total, err = s.CountByYear(ctx, year)
+	return delegations, total, err
+}
+
+// Page is a page of delegations returned by GetPage.
+type Page struct {
+	Items tds.DelegationSlice
+	// NextCursor is the After value of the next page, empty on the last page.
+	NextCursor string
+	// HasMore reports whether more delegations match the filter.
+	HasMore bool
+}
+
+// GetPage returns the page of at most f.Limit delegations matching the filter
+// after the f.After cursor, an empty cursor starts from the first delegation.
+// Pages start after the (timestamp, id) of the cursor delegation instead of skipping rows,
+// a Limit of 0 returns every delegation in a single page.
+// ErrInvalidCursor is returned when no delegation has the cursor id.
+func (s sqlite) GetPage(ctx context.Context, f DelegationFilter) (Page, error) {
+	if f.After != "" {
+		const query = `
+		SELECT EXISTS(SELECT 1 FROM delegations WHERE id = ?);
+		`
+		var exists bool
+		err := s.db.QueryRowContext(ctx, query, f.After).Scan(&exists)
+		if err != nil {
+			return Page{}, err
+		}
+		if !exists {
+			return Page{}, fmt.Errorf("%w: %q", ErrInvalidCursor, f.After)
+		}
+	}
+
+	limit := f.Limit
+	if limit > 0 {
+		// one more delegation tells whether there is a next page
+		f.Limit++
+	}
+	items, err := s.Query(ctx, f)
+	if err != nil {
+		return Page{}, err
+	}
+	if limit <= 0 || len(items) <= limit {
+		return Page{Items: items}, nil
+	}
+	items = items[:limit]
+	return Page{
+		Items:      items,
+		NextCursor: items[limit-1].ID,
+		HasMore:    true,
+	}, nil
+}
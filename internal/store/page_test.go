@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sqlite_GetByYearWithCount(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ds := tds.DelegationSlice{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+		{ID: "2", Timestamp: "2024-01-02T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "2"},
+		{ID: "3", Timestamp: "2023-12-31T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "3"},
+		{ID: "4", Timestamp: "2024-01-03T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "4"},
+	}
+	require.NoError(t, s.Insert(context.Background(), ds))
+
+	page, total, err := s.GetByYearWithCount(context.Background(), "2024", 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{ds[3], ds[1]}, page)
+	assert.Equal(t, int64(3), total)
+
+	page, total, err = s.GetByYearWithCount(context.Background(), "2024", 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{ds[0]}, page)
+	assert.Equal(t, int64(3), total)
+
+	page, total, err = s.GetByYearWithCount(context.Background(), "2024", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{ds[3], ds[1], ds[0]}, page)
+	assert.Equal(t, int64(3), total)
+
+	// past the last page the count is still returned
+	page, total, err = s.GetByYearWithCount(context.Background(), "2024", 2, 4)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+	assert.Equal(t, int64(3), total)
+
+	page, total, err = s.GetByYearWithCount(context.Background(), "2020", 2, 0)
+	require.NoError(t, err)
+	assert.Empty(t, page)
+	assert.Zero(t, total)
+}
+
+func Test_sqlite_GetPage(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"unified": nil,
+		"sharded": {WithYearSharding()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := NewSqLite(context.Background(), memoryPath, opts...)
+			require.NoError(t, err)
+			defer s.Close()
+
+			ds := fakeDelegations(25)
+			// ties on the timestamp are ordered by id
+			for i := range ds {
+				ds[i].Timestamp = ds[i/3*3].Timestamp
+			}
+			require.NoError(t, s.Insert(context.Background(), ds))
+			year := "2024"
+			all, err := s.Query(context.Background(), DelegationFilter{Year: &year})
+			require.NoError(t, err)
+
+			var (
+				got   tds.DelegationSlice
+				pages int
+			)
+			f := DelegationFilter{Year: &year, Limit: 10}
+			for {
+				page, err := s.GetPage(context.Background(), f)
+				require.NoError(t, err)
+				got = append(got, page.Items...)
+				pages++
+				if !page.HasMore {
+					assert.Empty(t, page.NextCursor)
+					break
+				}
+				assert.Equal(t, page.Items[len(page.Items)-1].ID, page.NextCursor)
+				f.After = page.NextCursor
+			}
+			assert.Equal(t, 3, pages)
+			assert.Equal(t, all, got)
+
+			// a full last page has no next page
+			page, err := s.GetPage(context.Background(), DelegationFilter{Year: &year, Limit: 25})
+			require.NoError(t, err)
+			assert.Len(t, page.Items, 25)
+			assert.False(t, page.HasMore)
+
+			page, err = s.GetPage(context.Background(), DelegationFilter{Year: &year})
+			require.NoError(t, err)
+			assert.Equal(t, all, page.Items)
+			assert.False(t, page.HasMore)
+
+			// an unknown cursor is not read as the end of the pages
+			_, err = s.GetPage(context.Background(), DelegationFilter{Year: &year, Limit: 10, After: "unknown"})
+			assert.ErrorIs(t, err, ErrInvalidCursor)
+		})
+	}
+}
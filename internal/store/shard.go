@@ -0,0 +1,378 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	tds "github.com/frieeze/tezos-delegation"
+)
+
+// A sharded store keeps the delegations of each year in their own table,
+// delegations_2018, delegations_2019, ..., and reads them all together
+// through a delegations view.
+
+// shardPrefix prefixes the year of the per year tables.
+const shardPrefix = "delegations_"
+
+var (
+	// ErrNotSharded is returned when a sharded store is opened
+	// on a database holding a unified delegations table.
+	ErrNotSharded = errors.New("delegations table is not sharded, migrate it with MigrateToShards")
+
+	shardYear = regexp.MustCompile(`^[0-9]{4}$`)
+)
+
+// WithYearSharding stores the delegations of each year in their own table.
+// A database holding a unified delegations table must be migrated first
+// with MigrateToShards, sharded databases are detected without this option.
+func WithYearSharding() Option {
+	return func(s *sqlite) {
+		s.sharded = true
+	}
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// shardTable returns the table holding the delegations of the given year.
+func shardTable(year string) (string, error) {
+	if !shardYear.MatchString(year) {
+		return "", fmt.Errorf("invalid shard year: %q", year)
+	}
+	return shardPrefix + year, nil
+}
+
+// objectType returns the type of the delegations schema object,
+// "table", "view" or "" if it does not exist.
+func objectType(ctx context.Context, q querier) (string, error) {
+	const query = `SELECT type FROM sqlite_master WHERE name = 'delegations';`
+	var typ string
+	err := q.QueryRowContext(ctx, query).Scan(&typ)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return typ, err
+}
+
+// shardTables returns the per year tables, ordered by year.
+func shardTables(ctx context.Context, q querier) ([]string, error) {
+	const query = `
+	SELECT name
+	FROM sqlite_master
+	WHERE type = 'table' AND name GLOB 'delegations_[0-9][0-9][0-9][0-9]'
+	ORDER BY name;
+	`
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// hasShard reports whether the table of the given year exists.
+func hasShard(ctx context.Context, q querier, table string) (bool, error) {
+	const query = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?;`
+	var count int
+	err := q.QueryRowContext(ctx, query, table).Scan(&count)
+	return count > 0, err
+}
+
+// createShard creates the table of the given year and its indexes.
+func createShard(ctx context.Context, q querier, table string) error {
+	_, err := q.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+table+` `+tableSchema+`;`)
+	if err != nil {
+		return err
+	}
+	year := strings.TrimPrefix(table, shardPrefix)
+	for _, index := range []string{
+		`CREATE INDEX IF NOT EXISTS idx_level_` + year + ` ON ` + table + `(CAST(level AS INTEGER));`,
+		`CREATE INDEX IF NOT EXISTS idx_timestamp_` + year + ` ON ` + table + `(timestamp);`,
+		`CREATE INDEX IF NOT EXISTS idx_operation_hash_` + year + ` ON ` + table + `(operation_hash);`,
+	} {
+		if _, err = q.ExecContext(ctx, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexShards creates the missing indexes of the per year tables.
+func indexShards(ctx context.Context, q querier) error {
+	tables, err := shardTables(ctx, q)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if err = createShard(ctx, q, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshView recreates the delegations view over every per year table.
+func refreshView(ctx context.Context, q querier) error {
+	tables, err := shardTables(ctx, q)
+	if err != nil {
+		return err
+	}
+	selects := make([]string, 0, len(tables))
+	for _, table := range tables {
+		selects = append(selects, `SELECT level, delegator, amount, timestamp, id, baker, operation_hash, year FROM `+table)
+	}
+	if len(selects) == 0 {
+		// keeps the columns of the view until the first year is inserted
+		selects = append(selects, `SELECT '' AS level, '' AS delegator, '' AS amount,
+		'' AS timestamp, '' AS id, '' AS baker, '' AS operation_hash, '' AS year WHERE 0`)
+	}
+
+	_, err = q.ExecContext(ctx, `DROP VIEW IF EXISTS delegations;`)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `CREATE VIEW delegations AS `+strings.Join(selects, "\n\tUNION ALL ")+`;`)
+	return err
+}
+
+// migrateShardsYear adds the year column to the per year tables
+// created before it existed, and to the delegations view.
+func migrateShardsYear(ctx context.Context, q querier) error {
+	// the view only has the column once every table has it
+	has, err := hasColumn(ctx, q, "delegations", "year")
+	if err != nil || has {
+		return err
+	}
+	tables, err := shardTables(ctx, q)
+	if err != nil {
+		return err
+	}
+	// renaming a table fails while a view references a missing one
+	if _, err = q.ExecContext(ctx, `DROP VIEW IF EXISTS delegations;`); err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if err = addYearColumn(ctx, q, table); err != nil {
+			return err
+		}
+		// recreates the index dropped with the old table
+		if err = createShard(ctx, q, table); err != nil {
+			return err
+		}
+	}
+	return refreshView(ctx, q)
+}
+
+// migrateShardsOperationHash adds the operation_hash column to the per year
+// tables created before it existed, and to the delegations view.
+func migrateShardsOperationHash(ctx context.Context, q querier) error {
+	has, err := hasColumn(ctx, q, "delegations", "operation_hash")
+	if err != nil || has {
+		return err
+	}
+	tables, err := shardTables(ctx, q)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if err = addOperationHashColumn(ctx, q, table); err != nil {
+			return err
+		}
+	}
+	return refreshView(ctx, q)
+}
+
+// insertShards inserts the delegations in the table of their year,
+// creating the missing tables.
+// Returns the delegations actually inserted.
+func insertShards(ctx context.Context, tx *sql.Tx, ds []tds.Delegation) ([]tds.Delegation, error) {
+	var (
+		years  []string
+		byYear = map[string][]tds.Delegation{}
+	)
+	for _, d := range ds {
+		// validated RFC3339 timestamps start with the year
+		year := d.Timestamp[:4]
+		if _, ok := byYear[year]; !ok {
+			years = append(years, year)
+		}
+		byYear[year] = append(byYear[year], d)
+	}
+
+	inserted := make([]tds.Delegation, 0, len(ds))
+	created := false
+	for _, year := range years {
+		table, err := shardTable(year)
+		if err != nil {
+			return nil, err
+		}
+		exists, err := hasShard(ctx, tx, table)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			if err = createShard(ctx, tx, table); err != nil {
+				return nil, err
+			}
+			created = true
+		}
+
+		var rows []tds.Delegation
+		if len(byYear[year]) < bulkMinRows {
+			rows, err = insertRows(ctx, tx, table, byYear[year])
+		} else {
+			rows, err = insertBulk(ctx, tx, table, byYear[year])
+		}
+		if err != nil {
+			return nil, err
+		}
+		inserted = append(inserted, rows...)
+	}
+	if created {
+		if err := refreshView(ctx, tx); err != nil {
+			return nil, err
+		}
+	}
+	return inserted, nil
+}
+
+// MigrateToShards moves the delegations of the unified table of the database
+// at path to per year tables, and returns the number of delegations moved.
+// The store is then opened sharded, migrating a sharded database does nothing.
+func MigrateToShards(ctx context.Context, path string) (int64, error) {
+	st, err := NewSqLite(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	defer st.Close()
+	s := st.(*sqlite)
+	if s.sharded {
+		return 0, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT DISTINCT substr(timestamp, 1, 4) FROM delegations;`)
+	if err != nil {
+		return 0, err
+	}
+	var years []string
+	for rows.Next() {
+		var year string
+		if err = rows.Scan(&year); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		years = append(years, year)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var moved int64
+	for _, year := range years {
+		table, err := shardTable(year)
+		if err != nil {
+			return 0, err
+		}
+		if err = createShard(ctx, tx, table); err != nil {
+			return 0, err
+		}
+		res, err := tx.ExecContext(ctx, `
+		INSERT INTO `+table+` (level, delegator, amount, timestamp, id, baker, operation_hash)
+		SELECT level, delegator, amount, timestamp, id, baker, operation_hash
+		FROM delegations
+		WHERE substr(timestamp, 1, 4) = ?
+		ORDER BY pk
+		ON CONFLICT(id) DO NOTHING;`, year)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		moved += n
+	}
+
+	if _, err = tx.ExecContext(ctx, `DROP TABLE delegations;`); err != nil {
+		return 0, err
+	}
+	if err = refreshView(ctx, tx); err != nil {
+		return 0, err
+	}
+	return moved, tx.Commit()
+}
+
+// deleteShards deletes the delegations made before the given date
+// from every per year table, or all of them if before is empty.
+// Returns the number of deleted delegations.
+func (s *sqlite) deleteShards(ctx context.Context, before string) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	tables, err := shardTables(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for _, table := range tables {
+		var res sql.Result
+		if before == "" {
+			res, err = tx.ExecContext(ctx, `DELETE FROM `+table+`;`)
+		} else {
+			res, err = tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE timestamp < ?;`, before)
+		}
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		deleted += n
+	}
+	return deleted, tx.Commit()
+}
+
+// source returns the table or view Query reads the filtered delegations from:
+// the table of the filtered year on a sharded store, the delegations table
+// or view otherwise.
+// ok is false when the year has no table, and so no delegations.
+func (s sqlite) source(ctx context.Context, f DelegationFilter) (table string, ok bool, err error) {
+	if !s.sharded || f.Year == nil {
+		return "delegations", true, nil
+	}
+	table, err = shardTable(*f.Year)
+	if err != nil {
+		// the view handles any year
+		return "delegations", true, nil
+	}
+	ok, err = hasShard(ctx, s.db, table)
+	return table, ok, err
+}
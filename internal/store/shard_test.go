@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var shardDelegations = tds.DelegationSlice{
+	{ID: "1", Timestamp: "2023-06-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+	{ID: "2", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "2", Level: "2"},
+	{ID: "3", Timestamp: "2024-06-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "3", Level: "3"},
+}
+
+func Test_sqlite_yearSharding(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath, WithYearSharding())
+	require.NoError(t, err)
+	defer s.Close()
+
+	// reads work before the first table is created
+	all, err := s.Query(context.Background(), DelegationFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, all)
+
+	require.NoError(t, s.Insert(context.Background(), shardDelegations))
+	// duplicates are ignored across tables
+	require.NoError(t, s.Insert(context.Background(), shardDelegations[1:]))
+
+	tables, err := shardTables(context.Background(), s.(*sqlite).db)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"delegations_2023", "delegations_2024"}, tables)
+
+	ds, err := s.GetByYear(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{shardDelegations[2], shardDelegations[1]}, ds)
+
+	ds, err = s.GetByYear(context.Background(), "2022")
+	require.NoError(t, err)
+	assert.Empty(t, ds)
+
+	// the other reads go through the view
+	ds, err = s.GetByDelegator(context.Background(), "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{shardDelegations[1], shardDelegations[0]}, ds)
+	first, err := s.GetFirst(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, shardDelegations[0], *first)
+	byID, err := s.GetByID(context.Background(), shardDelegations[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, shardDelegations[1], *byID)
+
+	deleted, err := s.DeleteBeforeDate(context.Background(), "2024-03-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	deleted, err = s.BulkDelete(context.Background(), []string{shardDelegations[2].ID})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	require.NoError(t, s.Empty(context.Background()))
+	all, err = s.Query(context.Background(), DelegationFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func Test_sqlite_yearSharding_bulk(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath, WithYearSharding())
+	require.NoError(t, err)
+	defer s.Close()
+
+	ds := fakeDelegations(2 * bulkMinRows)
+	require.NoError(t, s.Insert(context.Background(), ds))
+	require.NoError(t, s.Insert(context.Background(), ds))
+
+	count, err := s.CountByYear(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(ds)), count)
+}
+
+func Test_NewSqLite_yearSharding_unified(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "delegations.db")
+	s, err := NewSqLite(context.Background(), path)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	_, err = NewSqLite(context.Background(), path, WithYearSharding())
+	assert.ErrorIs(t, err, ErrNotSharded)
+}
+
+func Test_MigrateToShards(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "delegations.db")
+	s, err := NewSqLite(context.Background(), path)
+	require.NoError(t, err)
+	require.NoError(t, s.Insert(context.Background(), shardDelegations))
+	require.NoError(t, s.Close())
+
+	moved, err := MigrateToShards(context.Background(), path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(shardDelegations)), moved)
+
+	// already sharded
+	moved, err = MigrateToShards(context.Background(), path)
+	require.NoError(t, err)
+	assert.Zero(t, moved)
+
+	// detected without the option
+	s, err = NewSqLite(context.Background(), path)
+	require.NoError(t, err)
+	defer s.Close()
+	assert.True(t, s.(*sqlite).sharded)
+
+	ds, err := s.GetByYear(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{shardDelegations[2], shardDelegations[1]}, ds)
+
+	require.NoError(t, s.Insert(context.Background(), tds.DelegationSlice{
+		{ID: "4", Timestamp: "2025-01-01T00:00:00Z", Delegator: "tz1ccccccccccccccccccccccccccccccccc", Amount: "4", Level: "4"},
+	}))
+	last, err := s.LastDelegation(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "4", last.ID)
+}
+
+func Test_NewSqLite_yearSharding_addYearColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "delegations.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		`CREATE TABLE delegations_2024 (
+			pk        INTEGER PRIMARY KEY AUTOINCREMENT,
+			id	  TEXT UNIQUE,
+			level     TEXT NOT NULL,
+			delegator TEXT NOT NULL,
+			amount    TEXT NOT NULL,
+			timestamp TEXT NOT NULL,
+			baker     TEXT NOT NULL DEFAULT ''
+		);`,
+		`INSERT INTO delegations_2024 (level, delegator, amount, timestamp, id)
+		VALUES ('2', 'tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa', '2', '2024-01-01T00:00:00Z', '2');`,
+		`CREATE VIEW delegations AS
+		SELECT level, delegator, amount, timestamp, id, baker FROM delegations_2024;`,
+	} {
+		_, err = db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.Close())
+
+	s, err := NewSqLite(context.Background(), path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ds, err := s.GetByYear(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{shardDelegations[1]}, ds)
+
+	// the view has the column too
+	has, err := hasColumn(context.Background(), s.(*sqlite).db, "delegations", "year")
+	require.NoError(t, err)
+	assert.True(t, has)
+	all, err := s.Query(context.Background(), DelegationFilter{})
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+}
+
+func Test_NewSqLite_yearSharding_addOperationHashColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "delegations.db")
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		`CREATE TABLE delegations_2024 (
+			pk        INTEGER PRIMARY KEY AUTOINCREMENT,
+			id	  TEXT UNIQUE,
+			level     TEXT NOT NULL,
+			delegator TEXT NOT NULL,
+			amount    TEXT NOT NULL,
+			timestamp TEXT NOT NULL,
+			baker     TEXT NOT NULL DEFAULT '',
+			year      TEXT GENERATED ALWAYS AS (substr(timestamp, 1, 4)) STORED
+		);`,
+		`INSERT INTO delegations_2024 (level, delegator, amount, timestamp, id)
+		VALUES ('2', 'tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa', '2', '2024-01-01T00:00:00Z', '2');`,
+		`CREATE VIEW delegations AS
+		SELECT level, delegator, amount, timestamp, id, baker, year FROM delegations_2024;`,
+	} {
+		_, err = db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.Close())
+
+	s, err := NewSqLite(context.Background(), path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	d := tds.Delegation{ID: "3", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "3", Level: "3", OperationHash: "ooA"}
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{d}))
+
+	got, err := s.GetByOperationHash(context.Background(), "ooA")
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{d}, got)
+	all, err := s.Query(context.Background(), DelegationFilter{})
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// IndexInfo describes an index of the database.
+type IndexInfo struct {
+	Name    string   `json:"name"`
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+}
+
+// DBStats is a diagnostic view of the database.
+type DBStats struct {
+	Indexes []IndexInfo `json:"indexes"`
+	// RowCounts is the number of rows of each table.
+	RowCounts map[string]int64 `json:"row_counts"`
+	// FileSize is the size in bytes of the database file, 0 in memory.
+	FileSize int64 `json:"file_size"`
+}
+
+// DBStatser is implemented by the stores able to describe their database,
+// it is not part of Store as a maintenance only method.
+type DBStatser interface {
+	DBStats(ctx context.Context) (DBStats, error)
+}
+
+// expressionColumn names the index columns computed by an expression.
+const expressionColumn = "<expression>"
+
+// IndexStats returns every index of the database with its columns,
+// ordered by table and name.
+func (s *sqlite) IndexStats(ctx context.Context) ([]IndexInfo, error) {
+	const query = `
+	SELECT name, tbl_name
+	FROM sqlite_master
+	WHERE type = 'index'
+	ORDER BY tbl_name, name;
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := []IndexInfo{}
+	for rows.Next() {
+		var idx IndexInfo
+		err = rows.Scan(&idx.Name, &idx.Table)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, idx)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range indexes {
+		indexes[i].Columns, err = s.indexColumns(ctx, indexes[i].Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return indexes, nil
+}
+
+// indexColumns returns the columns of the given index, in index order.
+func (s *sqlite) indexColumns(ctx context.Context, index string) ([]string, error) {
+	const query = `SELECT name FROM pragma_index_info(?) ORDER BY seqno;`
+	rows, err := s.db.QueryContext(ctx, query, index)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := []string{}
+	for rows.Next() {
+		var name sql.NullString
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		if !name.Valid {
+			name.String = expressionColumn
+		}
+		columns = append(columns, name.String)
+	}
+	return columns, rows.Err()
+}
+
+// rowCounts returns the number of rows of each table.
+func (s *sqlite) rowCounts(ctx context.Context) (map[string]int64, error) {
+	const query = `
+	SELECT name
+	FROM sqlite_master
+	WHERE type = 'table' AND name NOT LIKE 'sqlite_%';
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	counts := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		var count int64
+		// table names come from sqlite_master
+		err = s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM "`+table+`";`).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		counts[table] = count
+	}
+	return counts, nil
+}
+
+// DBStats returns the indexes, the row counts of the tables
+// and the file size of the database.
+func (s *sqlite) DBStats(ctx context.Context) (DBStats, error) {
+	indexes, err := s.IndexStats(ctx)
+	if err != nil {
+		return DBStats{}, err
+	}
+	counts, err := s.rowCounts(ctx)
+	if err != nil {
+		return DBStats{}, err
+	}
+	return DBStats{
+		Indexes:   indexes,
+		RowCounts: counts,
+		FileSize:  s.fileSize(),
+	}, nil
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sqlite_IndexStats(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	indexes, err := s.(*sqlite).IndexStats(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, indexes, IndexInfo{Name: "idx_year", Table: "delegations", Columns: []string{"year"}})
+	assert.Contains(t, indexes, IndexInfo{Name: "idx_level", Table: "delegations", Columns: []string{expressionColumn}})
+	// the unique constraint of the id column
+	assert.Contains(t, indexes, IndexInfo{Name: "sqlite_autoindex_delegations_1", Table: "delegations", Columns: []string{"id"}})
+}
+
+func Test_sqlite_DBStats(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	statser, ok := s.(DBStatser)
+	require.True(t, ok)
+	stats, err := statser.DBStats(context.Background())
+	require.NoError(t, err)
+	assert.NotEmpty(t, stats.Indexes)
+	assert.Equal(t, map[string]int64{"delegations": int64(len(delegations)), "checkpoints": 0}, stats.RowCounts)
+	assert.Positive(t, stats.FileSize)
+}
+
+func Test_sqlite_DBStats_sharded(t *testing.T) {
+	s, err := NewSqLite(context.Background(), filepath.Join(t.TempDir(), "delegations.db"), WithYearSharding())
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.Insert(context.Background(), shardDelegations))
+
+	stats, err := s.(DBStatser).DBStats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"delegations_2023": 1, "delegations_2024": 2, "checkpoints": 0}, stats.RowCounts)
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Names of the statements prepared with the store.
+const (
+	stmtLastDelegation = "last_delegation"
+	stmtGetByYear      = "get_by_year"
+	stmtInsertRow      = "insert_row"
+)
+
+const lastDelegationQuery = `
+	SELECT level, delegator, amount, timestamp, id, baker, operation_hash
+	FROM delegations
+	ORDER BY timestamp DESC
+	LIMIT 1;
+	`
+
+// getByYearQuery is the query of Query filtering a year of the unified table.
+const getByYearQuery = `
+	SELECT level, delegator, amount, timestamp, id, baker, operation_hash
+	FROM delegations
+	WHERE year = ?
+	ORDER BY timestamp DESC, CAST(id AS INTEGER) DESC;
+	`
+
+// insertRowQuery returns the statement inserting a single delegation in table.
+func insertRowQuery(table string) string {
+	return `
+	INSERT INTO ` + table + ` (level, delegator, amount, timestamp, id, baker, operation_hash)
+	VALUES (?, ?, ?, ?, ?, ?, ?);
+	`
+}
+
+// prepare prepares the statements of the hot paths once, they are closed with the store.
+// The statements on the unified table are left out of a sharded store,
+// its per year tables are queried instead.
+func (s *sqlite) prepare(ctx context.Context) error {
+	queries := map[string]string{
+		stmtLastDelegation: lastDelegationQuery,
+	}
+	if !s.sharded {
+		queries[stmtGetByYear] = getByYearQuery
+		queries[stmtInsertRow] = insertRowQuery("delegations")
+	}
+
+	s.stmts = make(map[string]*sql.Stmt, len(queries))
+	for name, query := range queries {
+		stmt, err := s.db.PrepareContext(ctx, query)
+		if err != nil {
+			return errors.Join(fmt.Errorf("prepare %s: %w", name, err), s.closeStmts())
+		}
+		s.stmts[name] = stmt
+	}
+	return nil
+}
+
+// closeStmts closes the prepared statements.
+func (s *sqlite) closeStmts() error {
+	var errs []error
+	for _, stmt := range s.stmts {
+		errs = append(errs, stmt.Close())
+	}
+	s.stmts = nil
+	return errors.Join(errs...)
+}
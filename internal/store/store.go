@@ -2,135 +2,558 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/broadcast"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog/log"
 )
 
 // Store is the interface that wraps the basic store methods.
 type Store interface {
 	// Insert adds delegations to the store.
 	Insert(ctx context.Context, ds []tds.Delegation) error
+	// InsertCount adds delegations to the store and returns the number of delegations
+	// actually inserted, duplicates excluded.
+	InsertCount(ctx context.Context, ds []tds.Delegation) (int64, error)
 	// GetByYear returns all delegations for a given year, ordered by descending timestamps.
-	GetByYear(ctx context.Context, year string) ([]tds.Delegation, error)
+	GetByYear(ctx context.Context, year string) (tds.DelegationSlice, error)
+	// GetByYearIter streams the delegations of a year, ordered by descending timestamps.
+	GetByYearIter(ctx context.Context, year string) (DelegationIter, error)
+	// GetByYearWithCount returns a page of delegations for a given year, ordered by descending timestamps,
+	// and the number of delegations of the year.
+	GetByYearWithCount(ctx context.Context, year string, limit, offset int) (tds.DelegationSlice, int64, error)
+	// GetByMonth returns all delegations for a given month, ordered by descending timestamps.
+	GetByMonth(ctx context.Context, year, month string) (tds.DelegationSlice, error)
+	// GetByDelegator returns all delegations of a given delegator, ordered by descending timestamps.
+	GetByDelegator(ctx context.Context, delegator string) (tds.DelegationSlice, error)
+	// GetByBaker returns all delegations to a given baker, ordered by descending timestamps.
+	GetByBaker(ctx context.Context, baker string) (tds.DelegationSlice, error)
+	// GetByTimestamp returns the delegations made at an exact second, ordered by descending ids.
+	GetByTimestamp(ctx context.Context, ts string) (tds.DelegationSlice, error)
+	// GetByOperationHash returns the delegations of an operation, ordered by descending ids.
+	GetByOperationHash(ctx context.Context, hash string) (tds.DelegationSlice, error)
+	// GetDelta returns at most limit delegations of a given year with an id greater than since, ordered by ascending ids.
+	GetDelta(ctx context.Context, year, since string, limit int) (tds.DelegationSlice, error)
+	// GetByLevelRange returns the delegations between two block levels, ordered by descending levels.
+	GetByLevelRange(ctx context.Context, minLevel, maxLevel string) (tds.DelegationSlice, error)
+	// Query returns the delegations matching the filter, ordered by descending timestamps.
+	Query(ctx context.Context, f DelegationFilter) (tds.DelegationSlice, error)
+	// QueryIter streams the delegations matching the filter, ordered by descending timestamps.
+	QueryIter(ctx context.Context, f DelegationFilter) (DelegationIter, error)
+	// GetPage returns a page of the delegations matching the filter after its After cursor.
+	GetPage(ctx context.Context, f DelegationFilter) (Page, error)
 	// LastDelegation returns the last delegation by timestamp.
 	LastDelegation(ctx context.Context) (*tds.Delegation, error)
+	// GetFirst returns the first delegation by timestamp.
+	GetFirst(ctx context.Context) (*tds.Delegation, error)
+	// GetByID returns the delegation with the given id, or ErrNotFound.
+	GetByID(ctx context.Context, id string) (*tds.Delegation, error)
+	// CacheTag returns a tag which changes whenever the delegations of a given year change.
+	CacheTag(ctx context.Context, year string) (string, error)
+	// CountByYear returns the number of delegations for a given year.
+	CountByYear(ctx context.Context, year string) (int64, error)
+	// CountByDateRange returns the number of delegations between from (included) and to (excluded).
+	CountByDateRange(ctx context.Context, from, to string) (int64, error)
+	// GetDistinctDelegators returns the distinct delegators for a given year.
+	GetDistinctDelegators(ctx context.Context, year string) ([]string, error)
+	// CountDistinctDelegators returns the number of distinct delegators for a given year.
+	CountDistinctDelegators(ctx context.Context, year string) (int64, error)
+	// GetDistinctYears returns the years having delegations, most recent first.
+	GetDistinctYears(ctx context.Context) ([]string, error)
+	// GetAmountSumByYear returns the total amount delegated for a given year.
+	GetAmountSumByYear(ctx context.Context, year string) (int64, error)
+	// CountByDelegator returns the number of delegations of a given delegator.
+	CountByDelegator(ctx context.Context, delegator string) (int64, error)
+	// GetCountByDelegator returns the number of delegations of each delegator for a given year.
+	GetCountByDelegator(ctx context.Context, year string) (map[string]int64, error)
+	// GetActivityByDay returns the number of delegations of each day of a given year having some.
+	GetActivityByDay(ctx context.Context, year string) (map[string]int64, error)
+	// GetAmountSumByDelegator returns the total amount delegated by a given delegator.
+	GetAmountSumByDelegator(ctx context.Context, delegator string) (int64, error)
+	// GetAmountHistogram returns the number of delegations of a given year in each amount range.
+	GetAmountHistogram(ctx context.Context, year string, boundaries []int64) ([]Bucket, error)
+	// GetTopDelegators returns the n biggest delegators of a given year, sorted by SortByAmount or SortByCount.
+	GetTopDelegators(ctx context.Context, n int, year, sortBy string) ([]DelegatorSummary, error)
+	// DeleteBeforeDate deletes the delegations made before the given date
+	// and returns the number of deleted delegations.
+	DeleteBeforeDate(ctx context.Context, before string) (int64, error)
+	// BulkDelete deletes the delegations with the given ids
+	// and returns the number of deleted delegations.
+	BulkDelete(ctx context.Context, ids []string) (int64, error)
+	// Export writes every delegation to w in the given format.
+	Export(ctx context.Context, w io.Writer, format string) error
+	// Import reads delegations from r in the given format, inserts them
+	// and returns the number of delegations read.
+	Import(ctx context.Context, r io.Reader, format string) (int64, error)
+	// Backup copies the whole store to the dest file.
+	Backup(ctx context.Context, dest string) error
 	// Empty deletes all delegations from the store.
 	Empty(ctx context.Context) error
+	// Vacuum reclaims the disk space freed by deletions.
+	Vacuum(ctx context.Context) error
+	// CreateCheckpoint marks the given timestamp with a label.
+	CreateCheckpoint(ctx context.Context, label, timestamp string) error
+	// GetCheckpoints returns every checkpoint, by creation order.
+	GetCheckpoints(ctx context.Context) ([]Checkpoint, error)
+	// Subscribe sends every newly inserted delegation to ch, without blocking.
+	Subscribe(ch chan<- tds.Delegation)
+	// Unsubscribe stops sending delegations to ch.
+	Unsubscribe(ch chan<- tds.Delegation)
 	// Close the store.
 	Close() error
 }
 
+// ErrNotFound is returned when no delegation matches.
+var ErrNotFound = errors.New("delegation not found")
+
 type sqlite struct {
 	db *sql.DB
+
+	path    string
+	opts    SQLiteOpts
+	hub     *broadcast.Hub
+	sharded bool
+	dedup   bool
+	// stmts are the prepared statements, by name
+	stmts map[string]*sql.Stmt
+}
+
+// memoryPath opens a SQLite3 database living in memory only.
+const memoryPath = ":memory:"
+
+// Option configures a SQLite3 store.
+type Option func(*sqlite)
+
+// SQLiteOpts tunes the connections of a SQLite3 store.
+type SQLiteOpts struct {
+	// JournalMode is the journal mode of the database, WAL by default.
+	JournalMode string
+	// CacheSize is the page cache size of each connection,
+	// in KiB when negative and in pages otherwise, -2000 by default.
+	CacheSize int
+	// BusyTimeout is how long a connection waits for a lock, 5s by default.
+	BusyTimeout time.Duration
+	// ForeignKeys enforces the foreign key constraints, off by default.
+	ForeignKeys bool
+}
+
+// DefaultSQLiteOpts returns the options used by NewSqLite.
+func DefaultSQLiteOpts() SQLiteOpts {
+	return SQLiteOpts{
+		JournalMode: "WAL",
+		CacheSize:   -2000,
+		BusyTimeout: 5 * time.Second,
+	}
+}
+
+// dsn returns the connection string of the database at path.
+// The pragmas are set in the DSN so they apply to every pooled connection.
+func (o SQLiteOpts) dsn(path string) string {
+	return fmt.Sprintf("file:%s?_journal_mode=%s&_synchronous=NORMAL&_busy_timeout=%d&_cache_size=%d&_foreign_keys=%t",
+		path, url.QueryEscape(o.JournalMode), o.BusyTimeout.Milliseconds(), o.CacheSize, o.ForeignKeys)
+}
+
+// WithSQLiteOpts replaces the default connection options,
+// start from DefaultSQLiteOpts to only override some of them.
+func WithSQLiteOpts(o SQLiteOpts) Option {
+	return func(s *sqlite) {
+		s.opts = o
+	}
+}
+
+// WithJournalMode overrides the default WAL journal mode.
+func WithJournalMode(mode string) Option {
+	return func(s *sqlite) {
+		s.opts.JournalMode = mode
+	}
+}
+
+// WithHub publishes the newly inserted delegations on the given hub.
+func WithHub(h *broadcast.Hub) Option {
+	return func(s *sqlite) {
+		s.hub = h
+	}
+}
+
+// WithDedup drops the delegations sharing the id of a previous one
+// from the GetByYear results.
+// The UNIQUE id constraint already prevents duplicates,
+// the guard costs a lookup per delegation.
+func WithDedup() Option {
+	return func(s *sqlite) {
+		s.dedup = true
+	}
 }
 
 // NewSqLite creates a new SQLite3 store.
 // If the database file does not exist, it will be created.
-func NewSqLite(ctx context.Context, path string) (Store, error) {
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("open database file: %w", err)
+// The ":memory:" path opens a database living in memory only.
+// The database uses the WAL journal mode by default so readers
+// don't block on the writer, and waits up to 5s for locks,
+// see SQLiteOpts.
+func NewSqLite(ctx context.Context, path string, opts ...Option) (Store, error) {
+	store := &sqlite{
+		path: path,
+		opts: DefaultSQLiteOpts(),
+	}
+	for _, opt := range opts {
+		opt(store)
+	}
+	if store.hub == nil {
+		store.hub = broadcast.NewHub()
 	}
-	f.Close()
 
-	db, err := sql.Open("sqlite3", path)
+	inMemory := path == memoryPath
+	if !inMemory {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("open database file: %w", err)
+		}
+		f.Close()
+	}
+
+	db, err := sql.Open("sqlite3", store.opts.dsn(path))
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
-
-	store := &sqlite{
-		db: db,
+	if inMemory {
+		// every connection would get its own in-memory database
+		db.SetMaxOpenConns(1)
 	}
+	store.db = db
 
-	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	tableCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
 	defer cancel()
 
-	err = store.createTable(ctx)
+	err = store.createTable(tableCtx)
 	if err != nil {
 		return nil, fmt.Errorf("create table: %w", err)
 	}
+	err = store.createCheckpointsTable(tableCtx)
+	if err != nil {
+		return nil, fmt.Errorf("create checkpoints table: %w", err)
+	}
+
+	// rebuilding and indexing the tables of an existing database
+	// can take much longer than creating them
+	err = store.migrateYear(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("add year column: %w", err)
+	}
+
+	err = store.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	return store, nil
 }
 
+const (
+	// bulkMinRows is the batch size from which rows are inserted
+	// with multi-row statements
+	bulkMinRows = 10
+	// bulkChunkRows is the number of rows per multi-row statement,
+	// keeping the 7 variables per row below SQLite's limit
+	bulkChunkRows = 999
+	// bulkChunkIDs is the number of ids per DELETE statement,
+	// SQLite's default variable limit
+	bulkChunkIDs = 999
+)
+
 // Insert adds delegations to the database.
 // If a delegation with the same id already exists, it will be ignored.
+// Every delegation must be valid, otherwise nothing is inserted.
+// Newly inserted delegations are published on the hub and to the subscribers.
 func (s *sqlite) Insert(ctx context.Context, ds []tds.Delegation) error {
+	_, err := s.InsertCount(ctx, ds)
+	return err
+}
+
+// InsertCount adds delegations to the database like Insert
+// and returns the number of delegations actually inserted,
+// the ignored duplicates are not counted.
+func (s *sqlite) InsertCount(ctx context.Context, ds []tds.Delegation) (int64, error) {
 	if len(ds) == 0 {
-		return nil
+		return 0, nil
 	}
-	const query = `
-	INSERT INTO delegations (level, delegator, amount, timestamp, id)
-	VALUES (?, ?, ?, ?, ?);
-	`
+	for i, d := range ds {
+		if err := d.Validate(); err != nil {
+			return 0, fmt.Errorf("delegation %d (id %q): %w", i, d.ID, err)
+		}
+	}
+	start := time.Now()
 	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.PrepareContext(ctx, query)
+	var inserted []tds.Delegation
+	switch {
+	case s.sharded:
+		inserted, err = insertShards(ctx, tx, ds)
+	case len(ds) < bulkMinRows:
+		// the statement prepared with the store, bound to the transaction
+		stmt := tx.StmtContext(ctx, s.stmts[stmtInsertRow])
+		inserted, err = execRows(ctx, stmt, ds)
+		stmt.Close()
+	default:
+		inserted, err = insertBulk(ctx, tx, "delegations", ds)
+	}
 	if err != nil {
-		return err
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	log.Ctx(ctx).Debug().
+		Int("batch", len(ds)).
+		Int("inserted", len(inserted)).
+		Dur("query_ms", time.Since(start)).
+		Msg("insert batch")
+
+	if len(inserted) > 0 {
+		s.hub.Publish(inserted)
+	}
+	return int64(len(inserted)), nil
+}
+
+// insertRows inserts the delegations in table one statement at a time.
+// Returns the delegations actually inserted.
+func insertRows(ctx context.Context, tx *sql.Tx, table string, ds []tds.Delegation) ([]tds.Delegation, error) {
+	stmt, err := tx.PrepareContext(ctx, insertRowQuery(table))
+	if err != nil {
+		return nil, err
 	}
 	defer stmt.Close()
+	return execRows(ctx, stmt, ds)
+}
 
+// execRows inserts the delegations with stmt, an insertRowQuery statement.
+// Returns the delegations actually inserted.
+func execRows(ctx context.Context, stmt *sql.Stmt, ds []tds.Delegation) ([]tds.Delegation, error) {
+	inserted := make([]tds.Delegation, 0, len(ds))
 	for _, d := range ds {
-		_, err = stmt.ExecContext(ctx, d.Level, d.Delegator, d.Amount, d.Timestamp, d.ID)
-		if err != nil && !isUniqueViolation(err) {
-			return err
+		_, err := stmt.ExecContext(ctx, d.Level, d.Delegator, d.Amount, d.Timestamp, d.ID, d.Baker, d.OperationHash)
+		if isUniqueViolation(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
 		}
+		inserted = append(inserted, d)
 	}
-	return tx.Commit()
+	return inserted, nil
+}
+
+// insertBulk inserts the delegations in table with multi-row statements
+// of up to bulkChunkRows rows.
+// Returns the delegations actually inserted.
+func insertBulk(ctx context.Context, tx *sql.Tx, table string, ds []tds.Delegation) ([]tds.Delegation, error) {
+	query := `
+	INSERT INTO ` + table + ` (level, delegator, amount, timestamp, id, baker, operation_hash)
+	VALUES `
+	inserted := make([]tds.Delegation, 0, len(ds))
+	for chunk := range slices.Chunk(ds, bulkChunkRows) {
+		args := make([]any, 0, len(chunk)*7)
+		byID := make(map[string]tds.Delegation, len(chunk))
+		for _, d := range chunk {
+			args = append(args, d.Level, d.Delegator, d.Amount, d.Timestamp, d.ID, d.Baker, d.OperationHash)
+			byID[d.ID] = d
+		}
+		values := strings.Repeat("(?, ?, ?, ?, ?, ?, ?), ", len(chunk))
+		// only the duplicate ids are skipped, any other constraint still fails
+		rows, err := tx.QueryContext(ctx, query+strings.TrimSuffix(values, ", ")+" ON CONFLICT(id) DO NOTHING RETURNING id;", args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id string
+			if err = rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			inserted = append(inserted, byID[id])
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return inserted, nil
 }
+
+// isUniqueViolation reports whether err is a duplicate id,
+// of the unified table or of a per year one.
 func isUniqueViolation(err error) bool {
-	return err.Error() == "UNIQUE constraint failed: delegations.id"
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.HasPrefix(msg, "UNIQUE constraint failed: delegations") && strings.HasSuffix(msg, ".id")
+}
+
+// Subscribe sends every newly inserted delegation to ch.
+// Sends never block, delegations are dropped while ch is full.
+func (s *sqlite) Subscribe(ch chan<- tds.Delegation) {
+	s.hub.Add(ch)
+}
+
+// Unsubscribe stops sending delegations to ch, which is not closed.
+func (s *sqlite) Unsubscribe(ch chan<- tds.Delegation) {
+	s.hub.Remove(ch)
 }
 
 // GetByYear returns all delegations for a given year.
 // Delegations are ordered by timestamp in descending order.
 // The year should be in the format "2006".
-func (s sqlite) GetByYear(ctx context.Context, year string) ([]tds.Delegation, error) {
+func (s sqlite) GetByYear(ctx context.Context, year string) (tds.DelegationSlice, error) {
+	start := time.Now()
+	ds, err := s.getByYear(ctx, year)
+	if err != nil {
+		return ds, err
+	}
+	if s.dedup {
+		ds = dedupDelegations(ds)
+	}
+	// tells a slow query apart from a slow response encoding
+	log.Ctx(ctx).Debug().
+		Str("year", year).
+		Dur("query_ms", time.Since(start)).
+		Int("rows", len(ds)).
+		Msg("get by year query")
+	return ds, nil
+}
+
+func (s sqlite) getByYear(ctx context.Context, year string) (tds.DelegationSlice, error) {
+	stmt, ok := s.stmts[stmtGetByYear]
+	if !ok {
+		return s.Query(ctx, DelegationFilter{Year: &year})
+	}
+	rows, err := stmt.QueryContext(ctx, year)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(ctx, rows)
+
+	return scanDelegations(ctx, rows)
+}
+
+// dedupDelegations keeps the first delegation of each id, in place.
+func dedupDelegations(ds tds.DelegationSlice) tds.DelegationSlice {
+	seen := make(map[string]struct{}, len(ds))
+	kept := ds[:0]
+	for _, d := range ds {
+		if _, ok := seen[d.ID]; ok {
+			continue
+		}
+		seen[d.ID] = struct{}{}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+// GetByMonth returns all delegations for a given month.
+// Delegations are ordered by timestamp in descending order.
+// The year should be in the format "2006" and the month in the format "01".
+func (s sqlite) GetByMonth(ctx context.Context, year, month string) (tds.DelegationSlice, error) {
+	return s.Query(ctx, DelegationFilter{Year: &year, Month: &month})
+}
+
+// GetByDelegator returns all delegations of a given delegator.
+// Delegations are ordered by timestamp in descending order.
+func (s sqlite) GetByDelegator(ctx context.Context, delegator string) (tds.DelegationSlice, error) {
+	return s.Query(ctx, DelegationFilter{Delegator: &delegator})
+}
+
+// GetByBaker returns all delegations to a given baker.
+// Delegations are ordered by timestamp in descending order.
+func (s sqlite) GetByBaker(ctx context.Context, baker string) (tds.DelegationSlice, error) {
+	return s.Query(ctx, DelegationFilter{Baker: &baker})
+}
+
+// GetByTimestamp returns the delegations made at the given second,
+// usually the delegations of a single block.
+// Delegations are ordered by id in descending order.
+// The timestamp should be in the stored format "2006-01-02T15:04:05Z".
+func (s sqlite) GetByTimestamp(ctx context.Context, ts string) (tds.DelegationSlice, error) {
 	const query = `
-	SELECT level, delegator, amount, timestamp, id
+	SELECT level, delegator, amount, timestamp, id, baker, operation_hash
 	FROM delegations
-	WHERE timestamp LIKE ?
-	ORDER BY timestamp DESC;
+	WHERE timestamp = ?
+	ORDER BY CAST(id AS INTEGER) DESC;
 	`
-	rows, err := s.db.QueryContext(ctx, query, year+"%")
+	rows, err := s.db.QueryContext(ctx, query, ts)
 	if err != nil {
 		return nil, err
 	}
+	defer closeRows(ctx, rows)
 
-	var delegations = []tds.Delegation{}
-	for rows.Next() {
-		var d tds.Delegation
-		err = rows.Scan(
-			&d.Level,
-			&d.Delegator,
-			&d.Amount,
-			&d.Timestamp,
-			&d.ID,
-		)
-		if err != nil {
-			return nil, err
-		}
-		delegations = append(delegations, d)
+	return scanDelegations(ctx, rows)
+}
+
+// GetByOperationHash returns the delegations of the operation with the given hash,
+// usually a single one.
+// Delegations are ordered by id in descending order.
+// The delegations stored without hash are never returned.
+func (s sqlite) GetByOperationHash(ctx context.Context, hash string) (tds.DelegationSlice, error) {
+	if hash == "" {
+		return tds.DelegationSlice{}, nil
+	}
+	const query = `
+	SELECT level, delegator, amount, timestamp, id, baker, operation_hash
+	FROM delegations
+	WHERE operation_hash = ?
+	ORDER BY CAST(id AS INTEGER) DESC;
+	`
+	rows, err := s.db.QueryContext(ctx, query, hash)
+	if err != nil {
+		return nil, err
 	}
-	return delegations, nil
+	defer closeRows(ctx, rows)
+
+	return scanDelegations(ctx, rows)
 }
 
 // LastDelegation returns the last delegation by timestamp.
 func (s sqlite) LastDelegation(ctx context.Context) (*tds.Delegation, error) {
+	var d tds.Delegation
+	err := s.stmts[stmtLastDelegation].QueryRowContext(ctx).Scan(
+		&d.Level,
+		&d.Delegator,
+		&d.Amount,
+		&d.Timestamp,
+		&d.ID,
+		&d.Baker,
+		&d.OperationHash,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &d, err
+}
+
+// GetFirst returns the first delegation by timestamp.
+// It returns nil if the store is empty.
+func (s sqlite) GetFirst(ctx context.Context) (*tds.Delegation, error) {
 	const query = `
-	SELECT level, delegator, amount, timestamp, id
+	SELECT level, delegator, amount, timestamp, id, baker, operation_hash
 	FROM delegations
-	ORDER BY timestamp DESC
+	ORDER BY timestamp ASC
 	LIMIT 1;
 	`
 	var d tds.Delegation
@@ -140,6 +563,8 @@ func (s sqlite) LastDelegation(ctx context.Context) (*tds.Delegation, error) {
 		&d.Amount,
 		&d.Timestamp,
 		&d.ID,
+		&d.Baker,
+		&d.OperationHash,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -147,29 +572,448 @@ func (s sqlite) LastDelegation(ctx context.Context) (*tds.Delegation, error) {
 	return &d, err
 }
 
+// GetByID returns the delegation with the given id,
+// looked up through the unique index of the id column.
+// It returns ErrNotFound if no delegation has this id.
+func (s sqlite) GetByID(ctx context.Context, id string) (*tds.Delegation, error) {
+	const query = `
+	SELECT level, delegator, amount, timestamp, id, baker, operation_hash
+	FROM delegations
+	WHERE id = ?;
+	`
+	var d tds.Delegation
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&d.Level,
+		&d.Delegator,
+		&d.Amount,
+		&d.Timestamp,
+		&d.ID,
+		&d.Baker,
+		&d.OperationHash,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// CacheTag returns the hex encoded SHA256 of the year, its highest delegation id
+// and its number of delegations, so that inserts and deletions both change the tag.
+// The year should be in the format "2006".
+func (s sqlite) CacheTag(ctx context.Context, year string) (string, error) {
+	const query = `
+	SELECT COALESCE(MAX(CAST(id AS INTEGER)), 0), COUNT(*)
+	FROM delegations
+	WHERE year = ?;
+	`
+	var maxID, count int64
+	err := s.db.QueryRowContext(ctx, query, year).Scan(&maxID, &count)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%d", year, maxID, count)))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// CountByYear returns the number of delegations for a given year.
+func (s sqlite) CountByYear(ctx context.Context, year string) (int64, error) {
+	const query = `
+	SELECT COUNT(*)
+	FROM delegations
+	WHERE year = ?;
+	`
+	var count int64
+	err := s.db.QueryRowContext(ctx, query, year).Scan(&count)
+	return count, err
+}
+
+// CountByDateRange returns the number of delegations
+// between from (included) and to (excluded).
+// Dates should be in RFC3339 format.
+func (s sqlite) CountByDateRange(ctx context.Context, from, to string) (int64, error) {
+	const query = `
+	SELECT COUNT(*)
+	FROM delegations
+	WHERE timestamp >= ? AND timestamp < ?;
+	`
+	var count int64
+	err := s.db.QueryRowContext(ctx, query, from, to).Scan(&count)
+	return count, err
+}
+
+// GetDistinctDelegators returns the distinct delegators for a given year,
+// ordered alphabetically.
+func (s sqlite) GetDistinctDelegators(ctx context.Context, year string) ([]string, error) {
+	const query = `
+	SELECT DISTINCT delegator
+	FROM delegations
+	WHERE year = ?
+	ORDER BY delegator;
+	`
+	rows, err := s.db.QueryContext(ctx, query, year)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var delegators = []string{}
+	for rows.Next() {
+		var d string
+		err = rows.Scan(&d)
+		if err != nil {
+			return nil, err
+		}
+		delegators = append(delegators, d)
+	}
+	return delegators, rows.Err()
+}
+
+// CountDistinctDelegators returns the number of distinct delegators for a given year.
+func (s sqlite) CountDistinctDelegators(ctx context.Context, year string) (int64, error) {
+	const query = `
+	SELECT COUNT(DISTINCT delegator)
+	FROM delegations
+	WHERE year = ?;
+	`
+	var count int64
+	err := s.db.QueryRowContext(ctx, query, year).Scan(&count)
+	return count, err
+}
+
+// GetDistinctYears returns the years having delegations,
+// ordered from the most recent.
+func (s sqlite) GetDistinctYears(ctx context.Context) ([]string, error) {
+	const query = `
+	SELECT DISTINCT year
+	FROM delegations
+	ORDER BY year DESC;
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var years = []string{}
+	for rows.Next() {
+		var y string
+		err = rows.Scan(&y)
+		if err != nil {
+			return nil, err
+		}
+		years = append(years, y)
+	}
+	return years, rows.Err()
+}
+
+// GetAmountSumByYear returns the total amount delegated for a given year.
+// Empty or non-numeric amounts count as 0.
+func (s sqlite) GetAmountSumByYear(ctx context.Context, year string) (int64, error) {
+	const query = `
+	SELECT COALESCE(SUM(CAST(amount AS INTEGER)), 0)
+	FROM delegations
+	WHERE year = ?;
+	`
+	var sum int64
+	err := s.db.QueryRowContext(ctx, query, year).Scan(&sum)
+	return sum, err
+}
+
+// CountByDelegator returns the number of delegations of a given delegator.
+func (s sqlite) CountByDelegator(ctx context.Context, delegator string) (int64, error) {
+	const query = `
+	SELECT COUNT(*)
+	FROM delegations
+	WHERE delegator = ?;
+	`
+	var count int64
+	err := s.db.QueryRowContext(ctx, query, delegator).Scan(&count)
+	return count, err
+}
+
+// GetCountByDelegator returns the number of delegations of each delegator for a given year.
+// The year should be in the format "2006".
+func (s sqlite) GetCountByDelegator(ctx context.Context, year string) (map[string]int64, error) {
+	const query = `
+	SELECT delegator, COUNT(*)
+	FROM delegations
+	WHERE year = ?
+	GROUP BY delegator
+	ORDER BY COUNT(*) DESC;
+	`
+	rows, err := s.db.QueryContext(ctx, query, year)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int64{}
+	for rows.Next() {
+		var (
+			delegator string
+			count     int64
+		)
+		err = rows.Scan(&delegator, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[delegator] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetActivityByDay returns the number of delegations of each day of a given year,
+// keyed by "2006-01-02" dates.
+// The days without delegations are left out, callers fill them with 0.
+func (s sqlite) GetActivityByDay(ctx context.Context, year string) (map[string]int64, error) {
+	const query = `
+	SELECT substr(timestamp, 1, 10) AS day, COUNT(*)
+	FROM delegations
+	WHERE year = ?
+	GROUP BY day
+	ORDER BY day;
+	`
+	rows, err := s.db.QueryContext(ctx, query, year)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int64{}
+	for rows.Next() {
+		var (
+			day   string
+			count int64
+		)
+		err = rows.Scan(&day, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[day] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetAmountSumByDelegator returns the total amount delegated by a given delegator
+// across all years, 0 if the delegator is unknown.
+// Empty or non-numeric amounts count as 0.
+func (s sqlite) GetAmountSumByDelegator(ctx context.Context, delegator string) (int64, error) {
+	const query = `
+	SELECT COALESCE(SUM(CAST(amount AS INTEGER)), 0)
+	FROM delegations
+	WHERE delegator = ?;
+	`
+	var sum int64
+	err := s.db.QueryRowContext(ctx, query, delegator).Scan(&sum)
+	return sum, err
+}
+
 // Close closes the database connection.
 func (s *sqlite) Close() error {
-	return s.db.Close()
+	return errors.Join(s.closeStmts(), s.db.Close())
 }
 
 // Empty deletes all delegations from the database.
 func (s *sqlite) Empty(ctx context.Context) error {
+	if s.sharded {
+		_, err := s.deleteShards(ctx, "")
+		return err
+	}
 	const query = `DELETE FROM delegations;`
 	_, err := s.db.ExecContext(ctx, query)
 	return err
 }
 
-func (s *sqlite) createTable(ctx context.Context) error {
-	const query = `
-	CREATE TABLE IF NOT EXISTS delegations (
+// DeleteBeforeDate deletes the delegations made before the given date
+// and returns the number of deleted delegations.
+// Date should be in RFC3339 format.
+func (s *sqlite) DeleteBeforeDate(ctx context.Context, before string) (int64, error) {
+	if s.sharded {
+		return s.deleteShards(ctx, before)
+	}
+	const query = `DELETE FROM delegations WHERE timestamp < ?;`
+	res, err := s.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// BulkDelete deletes the delegations with the given ids, in chunks of bulkChunkIDs,
+// and returns the number of deleted delegations. Unknown ids are ignored.
+// Either every chunk is deleted or none is.
+func (s *sqlite) BulkDelete(ctx context.Context, ids []string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	tables := []string{"delegations"}
+	if s.sharded {
+		tables, err = shardTables(ctx, tx)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var deleted int64
+	for chunk := range slices.Chunk(ids, bulkChunkIDs) {
+		args := make([]any, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+		in := strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ")
+		for _, table := range tables {
+			res, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE id IN (`+in+`);`, args...)
+			if err != nil {
+				return 0, err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return 0, err
+			}
+			deleted += n
+		}
+	}
+	return deleted, tx.Commit()
+}
+
+// tableSchema defines the columns of the delegations tables.
+const tableSchema = `(
 		pk        INTEGER PRIMARY KEY AUTOINCREMENT,
 		id	  TEXT UNIQUE,
 		level     TEXT NOT NULL,
 		delegator TEXT NOT NULL,
 		amount    TEXT NOT NULL,
-		timestamp TEXT NOT NULL
-	);
-	`
-	_, err := s.db.ExecContext(ctx, query)
+		timestamp TEXT NOT NULL,
+		baker     TEXT NOT NULL DEFAULT '',
+		operation_hash TEXT NOT NULL DEFAULT '',
+		year      TEXT GENERATED ALWAYS AS (substr(timestamp, 1, 4)) STORED
+	)`
+
+func (s *sqlite) createTable(ctx context.Context) error {
+	typ, err := objectType(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	switch {
+	case typ == "view":
+		// migrated to per year tables
+		s.sharded = true
+		return nil
+	case s.sharded && typ == "table":
+		return ErrNotSharded
+	case s.sharded:
+		return refreshView(ctx, s.db)
+	}
+
+	_, err = s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS delegations `+tableSchema+`;`)
+	if err != nil {
+		return err
+	}
+	if err = s.addBakerColumn(ctx); err != nil {
+		return err
+	}
+	return addOperationHashColumn(ctx, s.db, "delegations")
+}
+
+// hasColumn reports whether the given table or view has the given column.
+func hasColumn(ctx context.Context, q querier, table, column string) (bool, error) {
+	const query = `SELECT COUNT(*) FROM pragma_table_xinfo(?) WHERE name = ?;`
+	var count int
+	err := q.QueryRowContext(ctx, query, table, column).Scan(&count)
+	return count > 0, err
+}
+
+// addBakerColumn adds the baker column
+// to tables created before it existed.
+func (s *sqlite) addBakerColumn(ctx context.Context) error {
+	has, err := hasColumn(ctx, s.db, "delegations", "baker")
+	if err != nil || has {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `ALTER TABLE delegations ADD COLUMN baker TEXT NOT NULL DEFAULT '';`)
 	return err
 }
+
+// addOperationHashColumn adds the operation_hash column
+// to the tables created before it existed.
+func addOperationHashColumn(ctx context.Context, q querier, table string) error {
+	has, err := hasColumn(ctx, q, table, "operation_hash")
+	if err != nil || has {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `ALTER TABLE `+table+` ADD COLUMN operation_hash TEXT NOT NULL DEFAULT '';`)
+	return err
+}
+
+// migrateYear adds the generated year column to the tables
+// created before it existed, and indexes the delegations table.
+func (s *sqlite) migrateYear(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if s.sharded {
+		if err = migrateShardsYear(ctx, tx); err != nil {
+			return err
+		}
+		if err = migrateShardsOperationHash(ctx, tx); err != nil {
+			return err
+		}
+		// adds the indexes created with the newer tables
+		if err = indexShards(ctx, tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if err = addYearColumn(ctx, tx, "delegations"); err != nil {
+		return err
+	}
+	for _, index := range []string{
+		`CREATE INDEX IF NOT EXISTS idx_level ON delegations(CAST(level AS INTEGER));`,
+		`CREATE INDEX IF NOT EXISTS idx_year ON delegations(year);`,
+		`CREATE INDEX IF NOT EXISTS idx_timestamp ON delegations(timestamp);`,
+		`CREATE INDEX IF NOT EXISTS idx_operation_hash ON delegations(operation_hash);`,
+	} {
+		if _, err = tx.ExecContext(ctx, index); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// addYearColumn rebuilds a table without the year column, its indexes are dropped.
+// SQLite can't add a stored generated column to an existing table,
+// the rows are copied to a new table which replaces the old one.
+func addYearColumn(ctx context.Context, q querier, table string) error {
+	has, err := hasColumn(ctx, q, table, "year")
+	if err != nil || has {
+		return err
+	}
+	rebuild := table + "_rebuild"
+	for _, stmt := range []string{
+		`DROP TABLE IF EXISTS ` + rebuild + `;`,
+		`CREATE TABLE ` + rebuild + ` ` + tableSchema + `;`,
+		// keeping the primary keys keeps the insertion order
+		`INSERT INTO ` + rebuild + ` (pk, id, level, delegator, amount, timestamp, baker)
+		SELECT pk, id, level, delegator, amount, timestamp, baker FROM ` + table + `;`,
+		`DROP TABLE ` + table + `;`,
+		`ALTER TABLE ` + rebuild + ` RENAME TO ` + table + `;`,
+	} {
+		if _, err = q.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,12 +1,21 @@
 package store
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/broadcast"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -18,6 +27,7 @@ var (
 			Delegator: "tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms",
 			Amount:    "13814013",
 			Level:     "6976378",
+			Baker:     "tz1aRoaRhSpRYvFdyvgWLL6TGyRoGF51wDjM",
 			ID:        "1401626186219520",
 		},
 		{
@@ -32,6 +42,7 @@ var (
 			Delegator: "tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP",
 			Amount:    "2548751",
 			Level:     "6976299",
+			Baker:     "tz1aRoaRhSpRYvFdyvgWLL6TGyRoGF51wDjM",
 			ID:        "1401609161539584",
 		},
 	}
@@ -119,6 +130,34 @@ func Test_sqlite_GetByYear_Empty(t *testing.T) {
 	assert.Len(t, ds, 0)
 }
 
+// cancelAfter is a context canceled once Err has been called n times,
+// to cancel a scan in the middle of its rows
+type cancelAfter struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.n == 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+func Test_sqlite_GetByYear_canceled(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+	ds := fakeDelegations(10)
+	require.NoError(t, s.Insert(context.Background(), ds))
+
+	// canceled after the first row
+	got, err := s.GetByYear(&cancelAfter{Context: context.Background(), n: 1}, "2024")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, tds.DelegationSlice{ds[9]}, got)
+}
+
 func Test_sqlite_LastDelegation(t *testing.T) {
 	s, path := prepareDB(t)
 	defer cleanupDB(t, s, path)
@@ -138,6 +177,71 @@ func Test_sqlite_LastDelegation_Empty(t *testing.T) {
 	assert.Nil(t, d)
 }
 
+func Test_sqlite_GetFirst(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	d, err := s.GetFirst(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, delegations[0], *d)
+}
+
+func Test_sqlite_GetFirst_Empty(t *testing.T) {
+	s, err := NewSqLite(context.Background(), path)
+	require.NoError(t, err)
+	defer cleanupDB(t, s, path)
+
+	d, err := s.GetFirst(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, d)
+}
+
+func Test_sqlite_GetByID(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	d, err := s.GetByID(context.Background(), delegations[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, delegations[1], *d)
+
+	d, err = s.GetByID(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Nil(t, d)
+}
+
+func Test_sqlite_CacheTag(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	empty, err := s.CacheTag(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Len(t, empty, 64)
+
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{
+		{ID: "9", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+		{ID: "10", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "2"},
+	}))
+	tag, err := s.CacheTag(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.NotEqual(t, empty, tag)
+
+	// other years don't change the tag
+	require.NoError(t, s.Insert(context.Background(), []tds.Delegation{
+		{ID: "11", Timestamp: "2025-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "3"},
+	}))
+	again, err := s.CacheTag(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Equal(t, tag, again)
+
+	// deletions do
+	_, err = s.DeleteBeforeDate(context.Background(), "2024-01-15T00:00:00Z")
+	require.NoError(t, err)
+	pruned, err := s.CacheTag(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.NotEqual(t, tag, pruned)
+}
+
 func Test_sqlite_Drop(t *testing.T) {
 	s, path := prepareDB(t)
 	defer cleanupDB(t, s, path)
@@ -149,3 +253,728 @@ func Test_sqlite_Drop(t *testing.T) {
 	require.NoError(t, err)
 	assert.Zero(t, count)
 }
+
+func Test_sqlite_CountByYear(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	count, err := s.CountByYear(context.Background(), "2021")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	count, err = s.CountByYear(context.Background(), "2000")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func Test_sqlite_GetDistinctDelegators(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	ds, err := s.GetDistinctDelegators(context.Background(), "2022")
+	require.NoError(t, err)
+	assert.Equal(t, []string{delegations[2].Delegator}, ds)
+
+	ds, err = s.GetDistinctDelegators(context.Background(), "2000")
+	require.NoError(t, err)
+	require.NotNil(t, ds)
+	assert.Empty(t, ds)
+}
+
+func Test_sqlite_CountDistinctDelegators(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	count, err := s.CountDistinctDelegators(context.Background(), "2022")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	count, err = s.CountDistinctDelegators(context.Background(), "2000")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func Test_sqlite_GetDistinctYears(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	years, err := s.GetDistinctYears(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, years)
+	assert.Empty(t, years)
+
+	require.NoError(t, s.Insert(context.Background(), delegations))
+	years, err = s.GetDistinctYears(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2022", "2021", "2020"}, years)
+}
+
+func Test_sqlite_GetAmountSumByYear(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	sum, err := s.GetAmountSumByYear(context.Background(), "2021")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2548493), sum)
+
+	// Empty or non-numeric amounts, rejected by Insert
+	_, err = s.(*sqlite).db.Exec(`INSERT INTO delegations (level, delegator, amount, timestamp, id)
+	VALUES ('1', 'tz1', '', '2021-11-01T00:00:00Z', '1'), ('2', 'tz1', 'abc', '2021-11-02T00:00:00Z', '2');`)
+	require.NoError(t, err)
+
+	sum, err = s.GetAmountSumByYear(context.Background(), "2021")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2548493), sum)
+
+	sum, err = s.GetAmountSumByYear(context.Background(), "2000")
+	require.NoError(t, err)
+	assert.Zero(t, sum)
+}
+
+func Test_sqlite_CountByDateRange(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	count, err := s.CountByDateRange(context.Background(), "2021-01-01T00:00:00Z", "2022-10-29T10:09:00Z")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	count, err = s.CountByDateRange(context.Background(), "2020-10-29T10:22:25Z", "2023-01-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+}
+
+func Test_sqlite_DeleteBeforeDate(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	deleted, err := s.DeleteBeforeDate(context.Background(), "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	count, err := s.CountByDateRange(context.Background(), "2018-01-01T00:00:00Z", "2030-01-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	deleted, err = s.DeleteBeforeDate(context.Background(), "2021-01-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+}
+
+func Test_sqlite_BulkDelete(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	deleted, err := s.BulkDelete(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	deleted, err = s.BulkDelete(context.Background(), []string{delegations[0].ID, delegations[2].ID, "unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	all, err := s.Query(context.Background(), DelegationFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{delegations[1]}, all)
+}
+
+func Test_sqlite_BulkDelete_chunks(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ds := fakeDelegations(2*bulkChunkIDs + 1)
+	require.NoError(t, s.Insert(context.Background(), ds))
+
+	ids := make([]string, len(ds)-1)
+	for i := range ids {
+		ids[i] = ds[i+1].ID
+	}
+	deleted, err := s.BulkDelete(context.Background(), ids)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(ids)), deleted)
+
+	all, err := s.Query(context.Background(), DelegationFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{ds[0]}, all)
+}
+
+func journalMode(t *testing.T, db *sql.DB) string {
+	var mode string
+	err := db.QueryRow("PRAGMA journal_mode;").Scan(&mode)
+	require.NoError(t, err)
+	return mode
+}
+
+func Test_NewSqLite_addBakerColumn(t *testing.T) {
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE delegations (
+		pk        INTEGER PRIMARY KEY AUTOINCREMENT,
+		id	  TEXT UNIQUE,
+		level     TEXT NOT NULL,
+		delegator TEXT NOT NULL,
+		amount    TEXT NOT NULL,
+		timestamp TEXT NOT NULL
+	);`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO delegations (level, delegator, amount, timestamp, id)
+	VALUES ('1', 'tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms', '1', '2020-10-29T10:22:25Z', '1');`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	s, err := NewSqLite(context.Background(), path)
+	require.NoError(t, err)
+	defer cleanupDB(t, s, path)
+
+	last, err := s.LastDelegation(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, last.Baker)
+	assert.Empty(t, last.OperationHash)
+}
+
+func Test_sqlite_GetByYear_dedup(t *testing.T) {
+	// a table without the UNIQUE id constraint accepts duplicates
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE delegations (
+		pk        INTEGER PRIMARY KEY AUTOINCREMENT,
+		id	  TEXT,
+		level     TEXT NOT NULL,
+		delegator TEXT NOT NULL,
+		amount    TEXT NOT NULL,
+		timestamp TEXT NOT NULL,
+		baker     TEXT NOT NULL DEFAULT '',
+		year      TEXT GENERATED ALWAYS AS (substr(timestamp, 1, 4)) STORED
+	);`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	s, err := NewSqLite(context.Background(), path, WithDedup())
+	require.NoError(t, err)
+	defer cleanupDB(t, s, path)
+	for range 2 {
+		_, err = s.(*sqlite).db.ExecContext(context.Background(), `INSERT INTO delegations (level, delegator, amount, timestamp, id)
+		VALUES ('1', 'tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms', '1', '2020-10-29T10:22:25Z', '1');`)
+		require.NoError(t, err)
+	}
+
+	ds, err := s.GetByYear(context.Background(), "2020")
+	require.NoError(t, err)
+	assert.Len(t, ds, 1)
+
+	s.(*sqlite).dedup = false
+	ds, err = s.GetByYear(context.Background(), "2020")
+	require.NoError(t, err)
+	assert.Len(t, ds, 2)
+}
+
+func Test_NewSqLite_addYearColumn(t *testing.T) {
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE delegations (
+		pk        INTEGER PRIMARY KEY AUTOINCREMENT,
+		id	  TEXT UNIQUE,
+		level     TEXT NOT NULL,
+		delegator TEXT NOT NULL,
+		amount    TEXT NOT NULL,
+		timestamp TEXT NOT NULL,
+		baker     TEXT NOT NULL DEFAULT ''
+	);`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO delegations (level, delegator, amount, timestamp, id) VALUES
+	('1', 'tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms', '1', '2020-10-29T10:22:25Z', '1'),
+	('2', 'tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms', '2', '2021-10-29T10:22:25Z', '2');`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	s, err := NewSqLite(context.Background(), path)
+	require.NoError(t, err)
+	defer cleanupDB(t, s, path)
+
+	ds, err := s.GetByYear(context.Background(), "2021")
+	require.NoError(t, err)
+	if assert.Len(t, ds, 1) {
+		assert.Equal(t, "2", ds[0].ID)
+	}
+
+	// the rows and the indexes are rebuilt
+	var pk int
+	err = s.(*sqlite).db.QueryRow(`SELECT pk FROM delegations WHERE id = '2';`).Scan(&pk)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pk)
+	var indexes int
+	err = s.(*sqlite).db.QueryRow(`SELECT COUNT(*) FROM sqlite_master
+	WHERE type = 'index' AND name IN ('idx_level', 'idx_year');`).Scan(&indexes)
+	require.NoError(t, err)
+	assert.Equal(t, 2, indexes)
+}
+
+func Test_sqlite_GetByYear_index(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	rows, err := s.(*sqlite).db.Query(`EXPLAIN QUERY PLAN `+getByYearQuery, "2020")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		require.NoError(t, rows.Scan(&id, &parent, &notUsed, &detail))
+		plan = append(plan, detail)
+	}
+	require.NoError(t, rows.Err())
+	assert.Contains(t, plan, "SEARCH delegations USING INDEX idx_year (year=?)")
+}
+
+func Test_NewSqLite_JournalMode(t *testing.T) {
+	s, err := NewSqLite(context.Background(), path)
+	require.NoError(t, err)
+	assert.Equal(t, "wal", journalMode(t, s.(*sqlite).db))
+	cleanupDB(t, s, path)
+
+	s, err = NewSqLite(context.Background(), path, WithJournalMode("DELETE"))
+	require.NoError(t, err)
+	defer cleanupDB(t, s, path)
+	assert.Equal(t, "delete", journalMode(t, s.(*sqlite).db))
+}
+
+func Test_NewSqLite_SQLiteOpts(t *testing.T) {
+	opts := SQLiteOpts{
+		JournalMode: "TRUNCATE",
+		CacheSize:   -4096,
+		BusyTimeout: 2 * time.Second,
+		ForeignKeys: true,
+	}
+	s, err := NewSqLite(context.Background(), path, WithSQLiteOpts(opts))
+	require.NoError(t, err)
+	defer cleanupDB(t, s, path)
+	db := s.(*sqlite).db
+	// opens a new connection per query, each one must get the pragmas
+	db.SetMaxIdleConns(0)
+
+	assert.Equal(t, "truncate", journalMode(t, db))
+	for pragma, want := range map[string]int{
+		"cache_size":   -4096,
+		"busy_timeout": 2000,
+		"foreign_keys": 1,
+	} {
+		var got int
+		require.NoError(t, db.QueryRow("PRAGMA "+pragma+";").Scan(&got))
+		assert.Equal(t, want, got, pragma)
+	}
+}
+
+func Test_NewSqLite_DefaultSQLiteOpts(t *testing.T) {
+	s, err := NewSqLite(context.Background(), path)
+	require.NoError(t, err)
+	defer cleanupDB(t, s, path)
+	db := s.(*sqlite).db
+
+	assert.Equal(t, "wal", journalMode(t, db))
+	for pragma, want := range map[string]int{
+		"cache_size":   -2000,
+		"busy_timeout": 5000,
+		"foreign_keys": 0,
+	} {
+		var got int
+		require.NoError(t, db.QueryRow("PRAGMA "+pragma+";").Scan(&got))
+		assert.Equal(t, want, got, pragma)
+	}
+}
+
+func Test_sqlite_ConcurrentReads(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	batch := make([]tds.Delegation, 5000)
+	for i := range batch {
+		batch[i] = tds.Delegation{
+			Timestamp: fmt.Sprintf("2023-01-01T00:00:%02dZ", i%60),
+			Delegator: "tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms",
+			Amount:    "1",
+			Level:     strconv.Itoa(i + 1),
+			ID:        strconv.Itoa(i),
+		}
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		assert.NoError(t, s.Insert(context.Background(), batch))
+	}()
+
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				_, err := s.GetByYear(context.Background(), "2021")
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	count, err := s.CountByYear(context.Background(), "2023")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(batch)), count)
+}
+
+func fakeDelegations(n int) []tds.Delegation {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ds := make([]tds.Delegation, n)
+	for i := range ds {
+		ds[i] = tds.Delegation{
+			Timestamp: start.Add(time.Duration(i) * time.Second).Format(time.RFC3339),
+			Delegator: "tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms",
+			Amount:    strconv.Itoa(i * 1000),
+			Level:     strconv.Itoa(i + 1),
+			ID:        strconv.Itoa(i),
+		}
+	}
+	return ds
+}
+
+// benchmarkInsert inserts n delegations the given number of times
+// in a fresh in-memory database on every iteration
+func benchmarkInsert(b *testing.B, n, times int) {
+	benchmarkInsertFunc(b, n, times, func(s Store, ds []tds.Delegation) error {
+		return s.Insert(context.Background(), ds)
+	})
+}
+
+// benchmarkInsertRows is benchmarkInsert forcing one statement per row
+func benchmarkInsertRows(b *testing.B, n int) {
+	benchmarkInsertFunc(b, n, 1, func(s Store, ds []tds.Delegation) error {
+		tx, err := s.(*sqlite).db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		_, err = insertRows(context.Background(), tx, "delegations", ds)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+func benchmarkInsertFunc(b *testing.B, n, times int, insert func(Store, []tds.Delegation) error) {
+	ds := fakeDelegations(n)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		b.StopTimer()
+		s, err := NewSqLite(context.Background(), memoryPath)
+		require.NoError(b, err)
+		b.StartTimer()
+
+		for range times {
+			err = insert(s, ds)
+			require.NoError(b, err)
+		}
+
+		b.StopTimer()
+		require.NoError(b, s.Close())
+		b.StartTimer()
+	}
+}
+
+func BenchmarkInsert_100(b *testing.B) {
+	benchmarkInsert(b, 100, 1)
+}
+
+func BenchmarkInsert_1000(b *testing.B) {
+	benchmarkInsert(b, 1000, 1)
+}
+
+func BenchmarkInsert_10000(b *testing.B) {
+	benchmarkInsert(b, 10000, 1)
+}
+
+func BenchmarkInsert_Duplicate_1000(b *testing.B) {
+	benchmarkInsert(b, 1000, 2)
+}
+
+func BenchmarkInsert_PerRow_1000(b *testing.B) {
+	benchmarkInsertRows(b, 1000)
+}
+
+func BenchmarkInsert_PerRow_10000(b *testing.B) {
+	benchmarkInsertRows(b, 10000)
+}
+
+func Test_sqlite_Insert_Bulk(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// more than one chunk, with duplicates
+	ds := fakeDelegations(2*bulkChunkRows + 10)
+	err = s.Insert(context.Background(), ds[:bulkChunkRows])
+	require.NoError(t, err)
+	err = s.Insert(context.Background(), ds)
+	require.NoError(t, err)
+
+	count, err := length(s.(*sqlite).db)
+	require.NoError(t, err)
+	assert.Equal(t, len(ds), count)
+
+	got, err := s.GetByYear(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Equal(t, ds[len(ds)-1], got[0])
+}
+
+func Test_insertBulk_constraint(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+	db := s.(*sqlite).db
+
+	// a constraint other than the unique id is not ignored
+	_, err = db.Exec(`CREATE TABLE constrained ` + tableSchema + `;
+	CREATE UNIQUE INDEX idx_constrained_hash ON constrained(operation_hash);`)
+	require.NoError(t, err)
+	ds := fakeDelegations(3)
+	for i := range ds {
+		ds[i].OperationHash = "op" + ds[i].ID
+	}
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	defer tx.Rollback()
+	inserted, err := insertBulk(context.Background(), tx, "constrained", ds[:2])
+	require.NoError(t, err)
+	assert.Len(t, inserted, 2)
+
+	// the duplicate id is skipped
+	inserted, err = insertBulk(context.Background(), tx, "constrained", ds[1:2])
+	require.NoError(t, err)
+	assert.Empty(t, inserted)
+
+	d := ds[2]
+	d.OperationHash = ds[0].OperationHash
+	_, err = insertBulk(context.Background(), tx, "constrained", []tds.Delegation{d})
+	assert.ErrorContains(t, err, "UNIQUE constraint failed: constrained.operation_hash")
+}
+
+func Test_sqlite_InsertCount(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	for _, ds := range [][]tds.Delegation{delegations, fakeDelegations(2 * bulkMinRows)} {
+		n, err := s.InsertCount(context.Background(), ds[:len(ds)-1])
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(ds)-1), n)
+
+		// only the last delegation is new
+		n, err = s.InsertCount(context.Background(), ds)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	}
+}
+
+func Test_sqlite_DelegatorStats(t *testing.T) {
+	s, path := prepareDB(t)
+	defer cleanupDB(t, s, path)
+
+	sum, err := s.GetAmountSumByDelegator(context.Background(), "tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2548493+2548751), sum)
+
+	count, err := s.CountByDelegator(context.Background(), "tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	// unknown delegator, including an injection attempt
+	for _, d := range []string{"tz1unknownUUUUUUUUUUUUUUUUUUUUUUUUUU", "' OR 1=1 --"} {
+		sum, err = s.GetAmountSumByDelegator(context.Background(), d)
+		require.NoError(t, err)
+		assert.Zero(t, sum)
+
+		count, err = s.CountByDelegator(context.Background(), d)
+		require.NoError(t, err)
+		assert.Zero(t, count)
+	}
+}
+
+func Test_sqlite_GetCountByDelegator(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "1", Level: "2"},
+		{ID: "3", Timestamp: "2024-03-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "1", Level: "3"},
+		{ID: "4", Timestamp: "2023-03-01T00:00:00Z", Delegator: "tz1ccccccccccccccccccccccccccccccccc", Amount: "1", Level: "4"},
+	})
+	require.NoError(t, err)
+
+	counts, err := s.GetCountByDelegator(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa": 1, "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb": 2}, counts)
+
+	counts, err = s.GetCountByDelegator(context.Background(), "2000")
+	require.NoError(t, err)
+	assert.Empty(t, counts)
+}
+
+func Test_sqlite_GetActivityByDay(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-15T08:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+		{ID: "2", Timestamp: "2024-01-15T23:59:59Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "1", Level: "2"},
+		{ID: "3", Timestamp: "2024-03-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "1", Level: "3"},
+		{ID: "4", Timestamp: "2023-12-31T23:59:59Z", Delegator: "tz1ccccccccccccccccccccccccccccccccc", Amount: "1", Level: "4"},
+	})
+	require.NoError(t, err)
+
+	counts, err := s.GetActivityByDay(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"2024-01-15": 2, "2024-03-01": 1}, counts)
+
+	counts, err = s.GetActivityByDay(context.Background(), "2000")
+	require.NoError(t, err)
+	assert.Empty(t, counts)
+}
+
+func Test_sqlite_debugLogs(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	var buf bytes.Buffer
+	ctx := zerolog.New(&buf).Level(zerolog.DebugLevel).WithContext(context.Background())
+	err = s.Insert(ctx, []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "1", Level: "1"},
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "1", Level: "2"},
+	})
+	require.NoError(t, err)
+	_, err = s.GetByYear(ctx, "2024")
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	for i, want := range []map[string]any{
+		{"message": "insert batch", "batch": float64(2), "inserted": float64(2)},
+		{"message": "get by year query", "year": "2024", "rows": float64(2)},
+	} {
+		line := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(lines[i]), &line))
+		assert.Equal(t, "debug", line["level"])
+		assert.Contains(t, line, "query_ms")
+		for k, v := range want {
+			assert.Equal(t, v, line[k], k)
+		}
+	}
+}
+
+func Test_sqlite_Insert_Hub(t *testing.T) {
+	hub := broadcast.NewHub()
+	ch, unsub := hub.Subscribe()
+	defer unsub()
+
+	s, err := NewSqLite(context.Background(), memoryPath, WithHub(hub))
+	require.NoError(t, err)
+	defer s.Close()
+
+	// per row insert
+	err = s.Insert(context.Background(), delegations[:1])
+	require.NoError(t, err)
+	err = s.Insert(context.Background(), delegations)
+	require.NoError(t, err)
+	assert.Equal(t, delegations[0], <-ch)
+	assert.Equal(t, delegations[1], <-ch)
+	assert.Equal(t, delegations[2], <-ch)
+	assert.Empty(t, ch)
+
+	// bulk insert
+	ds := fakeDelegations(bulkMinRows)
+	err = s.Insert(context.Background(), ds[:1])
+	require.NoError(t, err)
+	assert.Equal(t, ds[0], <-ch)
+	err = s.Insert(context.Background(), ds)
+	require.NoError(t, err)
+	for _, d := range ds[1:] {
+		assert.Equal(t, d, <-ch)
+	}
+	assert.Empty(t, ch)
+}
+
+func Test_sqlite_Subscribe(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ch := make(chan tds.Delegation, len(delegations))
+	s.Subscribe(ch)
+
+	err = s.Insert(context.Background(), delegations[:1])
+	require.NoError(t, err)
+	// the duplicate is not sent again
+	err = s.Insert(context.Background(), delegations)
+	require.NoError(t, err)
+	assert.Equal(t, delegations[0], <-ch)
+	assert.Equal(t, delegations[1], <-ch)
+	assert.Equal(t, delegations[2], <-ch)
+	assert.Empty(t, ch)
+
+	// a full channel doesn't block inserts
+	ds := fakeDelegations(len(delegations) + 1)
+	err = s.Insert(context.Background(), ds)
+	require.NoError(t, err)
+	assert.Len(t, ch, len(delegations))
+
+	s.Unsubscribe(ch)
+	for range len(delegations) {
+		<-ch
+	}
+	err = s.Insert(context.Background(), fakeDelegations(len(ds) + 1)[len(ds):])
+	require.NoError(t, err)
+	assert.Empty(t, ch)
+}
+
+func Test_sqlite_prepare(t *testing.T) {
+	st, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	s := st.(*sqlite)
+	assert.Len(t, s.stmts, 3)
+
+	// the prepared statements are reused by every call
+	ds := fakeDelegations(3)
+	for _, d := range ds {
+		require.NoError(t, s.Insert(context.Background(), []tds.Delegation{d}))
+		last, err := s.LastDelegation(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, d, *last)
+	}
+	got, err := s.GetByYear(context.Background(), "2024")
+	require.NoError(t, err)
+	assert.Equal(t, tds.DelegationSlice{ds[2], ds[1], ds[0]}, got)
+
+	require.NoError(t, s.Close())
+	assert.Nil(t, s.stmts)
+
+	// the unified table statements are left out of sharded stores
+	st, err = NewSqLite(context.Background(), memoryPath, WithYearSharding())
+	require.NoError(t, err)
+	defer st.Close()
+	assert.Len(t, st.(*sqlite).stmts, 1)
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DelegatorSummary holds the delegation totals of a delegator.
+type DelegatorSummary struct {
+	Address     string `json:"address"`
+	TotalAmount int64  `json:"total_amount"`
+	Count       int    `json:"count"`
+}
+
+// GetTopDelegators sort orders.
+const (
+	SortByAmount = "amount"
+	SortByCount  = "count"
+)
+
+// ErrInvalidSort is returned when the sort order is not supported.
+var ErrInvalidSort = errors.New("invalid sort")
+
+// GetTopDelegators returns the n biggest delegators of a given year.
+// Delegators are sorted by total amount with SortByAmount (the default)
+// or by number of delegations with SortByCount, ties are ordered by address.
+// The year should be in the format "2006".
+func (s sqlite) GetTopDelegators(ctx context.Context, n int, year, sortBy string) ([]DelegatorSummary, error) {
+	var order string
+	switch sortBy {
+	case SortByAmount, "":
+		order = "SUM(CAST(amount AS INTEGER)) DESC"
+	case SortByCount:
+		order = "COUNT(*) DESC"
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSort, sortBy)
+	}
+
+	query := `
+	SELECT delegator, COALESCE(SUM(CAST(amount AS INTEGER)), 0), COUNT(*)
+	FROM delegations
+	WHERE year = ?
+	GROUP BY delegator
+	ORDER BY ` + order + `, delegator
+	LIMIT ?;
+	`
+	rows, err := s.db.QueryContext(ctx, query, year, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries = []DelegatorSummary{}
+	for rows.Next() {
+		var d DelegatorSummary
+		if err := rows.Scan(&d.Address, &d.TotalAmount, &d.Count); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, d)
+	}
+	return summaries, rows.Err()
+}
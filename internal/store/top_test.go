@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sqlite_GetTopDelegators(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	err = s.Insert(context.Background(), []tds.Delegation{
+		{ID: "1", Timestamp: "2024-01-01T00:00:00Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "100", Level: "1"},
+		{ID: "2", Timestamp: "2024-02-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "10", Level: "2"},
+		{ID: "3", Timestamp: "2024-03-01T00:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "20", Level: "3"},
+		{ID: "4", Timestamp: "2024-04-01T00:00:00Z", Delegator: "tz1ccccccccccccccccccccccccccccccccc", Amount: "50", Level: "4"},
+		{ID: "5", Timestamp: "2023-01-01T00:00:00Z", Delegator: "tz1ccccccccccccccccccccccccccccccccc", Amount: "1000", Level: "5"},
+	})
+	require.NoError(t, err)
+
+	top, err := s.GetTopDelegators(context.Background(), 2, "2024", "")
+	require.NoError(t, err)
+	assert.Equal(t, []DelegatorSummary{
+		{Address: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", TotalAmount: 100, Count: 1},
+		{Address: "tz1ccccccccccccccccccccccccccccccccc", TotalAmount: 50, Count: 1},
+	}, top)
+
+	top, err = s.GetTopDelegators(context.Background(), 10, "2024", SortByCount)
+	require.NoError(t, err)
+	assert.Equal(t, []DelegatorSummary{
+		{Address: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", TotalAmount: 30, Count: 2},
+		{Address: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", TotalAmount: 100, Count: 1},
+		{Address: "tz1ccccccccccccccccccccccccccccccccc", TotalAmount: 50, Count: 1},
+	}, top)
+
+	top, err = s.GetTopDelegators(context.Background(), 10, "2022", SortByAmount)
+	require.NoError(t, err)
+	assert.Empty(t, top)
+
+	_, err = s.GetTopDelegators(context.Background(), 10, "2024", "level")
+	assert.ErrorIs(t, err, ErrInvalidSort)
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// vacuumTimeout bounds the exclusive lock held by VACUUM.
+const vacuumTimeout = 5 * time.Minute
+
+// Vacuum rewrites the database file without the pages freed by deletions.
+// Writers are blocked while it runs, for up to vacuumTimeout.
+// The file size before and after is logged.
+func (s *sqlite) Vacuum(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, vacuumTimeout)
+	defer cancel()
+
+	before := s.fileSize()
+	_, err := s.db.ExecContext(ctx, `VACUUM;`)
+	if err != nil {
+		return err
+	}
+	// in WAL mode the rewritten pages only reach the file on checkpoint
+	_, err = s.db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE);`)
+	if err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).Info().
+		Int64("size_before", before).
+		Int64("size_after", s.fileSize()).
+		Msg("store vacuumed")
+	return nil
+}
+
+// fileSize returns the size in bytes of the database file,
+// 0 for in-memory databases.
+func (s *sqlite) fileSize() int64 {
+	if s.path == memoryPath {
+		return 0
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,32 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sqlite_Vacuum(t *testing.T) {
+	s, err := NewSqLite(context.Background(), filepath.Join(t.TempDir(), "delegations.db"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.Insert(context.Background(), fakeDelegations(5000)))
+	require.NoError(t, s.Vacuum(context.Background()))
+	full := s.(*sqlite).fileSize()
+
+	require.NoError(t, s.Empty(context.Background()))
+	require.NoError(t, s.Vacuum(context.Background()))
+	assert.Less(t, s.(*sqlite).fileSize(), full)
+}
+
+func Test_sqlite_Vacuum_memory(t *testing.T) {
+	s, err := NewSqLite(context.Background(), memoryPath)
+	require.NoError(t, err)
+	defer s.Close()
+
+	assert.NoError(t, s.Vacuum(context.Background()))
+}
@@ -0,0 +1,23 @@
+// Package tezos holds the Tezos protocol helpers shared by the other packages
+package tezos
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrInvalidAddress is returned for a string which is not a Tezos account address
+var ErrInvalidAddress = errors.New("not a Tezos address")
+
+// addressFormat matches the base58 implicit (tz1 to tz4) and originated (KT1) account addresses
+var addressFormat = regexp.MustCompile(`^(tz[1-4]|KT1)[1-9A-HJ-NP-Za-km-z]{33}$`)
+
+// ValidateAddress checks that s is a Tezos implicit or originated account address,
+// such as a delegator or a baker
+func ValidateAddress(s string) error {
+	if !addressFormat.MatchString(s) {
+		return fmt.Errorf("address %q: %w", s, ErrInvalidAddress)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package tezos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ValidateAddress(t *testing.T) {
+	for _, address := range []string{
+		"tz1KhjVyh7yc6197M5iZqnpn7u7aDSoqWB4R",
+		"tz2KhjVyh7yc6197M5iZqnpn7u7aDSoqWB4R",
+		"tz3KhjVyh7yc6197M5iZqnpn7u7aDSoqWB4R",
+		"tz4KhjVyh7yc6197M5iZqnpn7u7aDSoqWB4R",
+		"KT1KhjVyh7yc6197M5iZqnpn7u7aDSoqWB4R",
+	} {
+		assert.NoError(t, ValidateAddress(address), address)
+	}
+
+	for _, address := range []string{
+		"",
+		"tz1a",
+		"tz5KhjVyh7yc6197M5iZqnpn7u7aDSoqWB4R",
+		"KT2KhjVyh7yc6197M5iZqnpn7u7aDSoqWB4R",
+		// 0 is not a base58 character
+		"tz1KhjVyh7yc6197M5iZqnpn7u7aDSoqWB40",
+		"tz1KhjVyh7yc6197M5iZqnpn7u7aDSoqWB4RR",
+	} {
+		assert.ErrorIs(t, ValidateAddress(address), ErrInvalidAddress, address)
+	}
+}
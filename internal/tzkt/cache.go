@@ -0,0 +1,174 @@
+package tzkt
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default settings of the CachingTransport
+const (
+	DefaultCacheTTL        = 30 * time.Second
+	DefaultCacheMaxEntries = 100
+)
+
+// CachingTransport caches the successful GET responses
+// in an LRU cache keyed by the request URL, for ttl.
+// Responses marked no-cache or no-store by the server are not cached.
+type CachingTransport struct {
+	next       http.RoundTripper
+	ttl        time.Duration
+	maxEntries int
+
+	// mockable clock
+	now func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	expires time.Time
+	status  int
+	header  http.Header
+	body    []byte
+}
+
+// NewCachingTransport caches the responses of next,
+// or of http.DefaultTransport if next is nil.
+// A non positive ttl or maxEntries uses DefaultCacheTTL or DefaultCacheMaxEntries.
+func NewCachingTransport(next http.RoundTripper, ttl time.Duration, maxEntries int) *CachingTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+	return &CachingTransport{
+		next:       next,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		lru:        list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+// WithCachingTransport caches the API responses for ttl,
+// up to maxEntries responses.
+// The http client is copied, the shared default one is left untouched,
+// it should come after WithHTTPClient.
+func WithCachingTransport(ttl time.Duration, maxEntries int) Option {
+	return func(c *Client) {
+		hc := *c.http
+		hc.Transport = NewCachingTransport(hc.Transport, ttl, maxEntries)
+		c.http = &hc
+	}
+}
+
+// RoundTrip returns a copy of the cached response of the request URL,
+// or sends the request and caches its response.
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.next.RoundTrip(req)
+	}
+	key := req.URL.String()
+	if e := t.get(key); e != nil {
+		return e.response(req), nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || noCache(resp.Header) {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := resp.Header.Clone()
+	// replaying the rate limit of a past response would stall the client
+	header.Del(rateLimitRemainingHeader)
+	header.Del(rateLimitResetHeader)
+	t.put(&cacheEntry{
+		key:     key,
+		expires: t.now().Add(t.ttl),
+		status:  resp.StatusCode,
+		header:  header,
+		body:    body,
+	})
+	return resp, nil
+}
+
+// get returns the live entry of key, or nil
+func (t *CachingTransport) get(key string) *cacheEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	el, ok := t.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	if !t.now().Before(e.expires) {
+		t.lru.Remove(el)
+		delete(t.entries, key)
+		return nil
+	}
+	t.lru.MoveToFront(el)
+	return e
+}
+
+// put stores the entry, evicting the least recently used one when full
+func (t *CachingTransport) put(e *cacheEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if el, ok := t.entries[e.key]; ok {
+		t.lru.Remove(el)
+	}
+	t.entries[e.key] = t.lru.PushFront(e)
+	for t.lru.Len() > t.maxEntries {
+		oldest := t.lru.Back()
+		t.lru.Remove(oldest)
+		delete(t.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// response returns a new response to req with the cached content
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.status, http.StatusText(e.status)),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+// noCache reports whether the server forbids caching the response
+func noCache(h http.Header) bool {
+	for _, v := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			if directive == "no-cache" || directive == "no-store" {
+				return true
+			}
+		}
+	}
+	return false
+}
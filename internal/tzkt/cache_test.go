@@ -0,0 +1,103 @@
+package tzkt
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cachedServer(requests *atomic.Int32, cacheControl string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		w.Write([]byte(response))
+	}))
+}
+
+func Test_Client_CachingTransport(t *testing.T) {
+	var requests atomic.Int32
+	serv := cachedServer(&requests, "")
+	defer serv.Close()
+
+	c := NewClient(serv.URL, WithCachingTransport(time.Minute, 10))
+	for range 2 {
+		ds, err := c.GetDelegations(context.Background(), DelegationOpts{TsGe: "2024-10-29T00:00:00Z"})
+		require.NoError(t, err)
+		assert.Equal(t, expected, ds)
+	}
+	assert.Equal(t, int32(1), requests.Load())
+
+	// another url misses the cache
+	_, err := c.GetDelegations(context.Background(), DelegationOpts{TsGe: "2024-10-30T00:00:00Z"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+
+	// the shared client is left untouched
+	assert.NotSame(t, defaultClient, c.http)
+	assert.IsType(t, &http.Transport{}, defaultClient.Transport)
+}
+
+func Test_CachingTransport_noCache(t *testing.T) {
+	var requests atomic.Int32
+	serv := cachedServer(&requests, "private, no-cache")
+	defer serv.Close()
+
+	c := NewClient(serv.URL, WithCachingTransport(time.Minute, 10))
+	for range 2 {
+		_, err := c.GetDelegations(context.Background(), DelegationOpts{})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func Test_CachingTransport_ttl(t *testing.T) {
+	var requests atomic.Int32
+	serv := cachedServer(&requests, "")
+	defer serv.Close()
+
+	now := time.Unix(1_700_000_000, 0)
+	transport := NewCachingTransport(nil, time.Minute, 10)
+	transport.now = func() time.Time { return now }
+	client := &http.Client{Transport: transport}
+
+	get := func() {
+		resp, err := client.Get(serv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, response, string(body))
+	}
+	get()
+	now = now.Add(59 * time.Second)
+	get()
+	assert.Equal(t, int32(1), requests.Load())
+
+	now = now.Add(time.Second)
+	get()
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func Test_CachingTransport_eviction(t *testing.T) {
+	var requests atomic.Int32
+	serv := cachedServer(&requests, "")
+	defer serv.Close()
+
+	client := &http.Client{Transport: NewCachingTransport(nil, time.Minute, 2)}
+	for _, path := range []string{"/a", "/b", "/a", "/c", "/a", "/b"} {
+		resp, err := client.Get(serv.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	// /b is evicted by /c, /a stays the most recently used
+	assert.Equal(t, int32(4), requests.Load())
+}
@@ -0,0 +1,71 @@
+package tzkt
+
+import (
+	"context"
+	"sync"
+
+	tds "github.com/frieeze/tezos-delegation"
+)
+
+// MockClient is a ClientInterface returning canned responses
+// and recording the options of every call.
+type MockClient struct {
+	// Delegations is returned by GetDelegations
+	Delegations []tds.Delegation
+	// DelegationsFunc replaces Delegations when set
+	DelegationsFunc func(opts DelegationOpts) ([]tds.Delegation, error)
+	// PageFunc is called by GetDelegationsPage when set,
+	// which otherwise returns the delegations without skipped rows
+	PageFunc func(opts DelegationOpts) (Page, error)
+	// Count is returned by GetDelegationCount
+	Count int64
+	// Err is returned by every call when set
+	Err error
+
+	mu    sync.Mutex
+	calls []DelegationOpts
+}
+
+// GetDelegations records the call and returns the canned delegations
+func (m *MockClient) GetDelegations(ctx context.Context, opts DelegationOpts) ([]tds.Delegation, error) {
+	m.record(opts)
+	if m.DelegationsFunc != nil {
+		return m.DelegationsFunc(opts)
+	}
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return m.Delegations, nil
+}
+
+// GetDelegationsPage records the call and returns the canned page
+func (m *MockClient) GetDelegationsPage(ctx context.Context, opts DelegationOpts) (Page, error) {
+	if m.PageFunc != nil {
+		m.record(opts)
+		return m.PageFunc(opts)
+	}
+	delegations, err := m.GetDelegations(ctx, opts)
+	return Page{Delegations: delegations, Rows: len(delegations)}, err
+}
+
+// GetDelegationCount records the call and returns the canned count
+func (m *MockClient) GetDelegationCount(ctx context.Context, opts DelegationOpts) (int64, error) {
+	m.record(opts)
+	if m.Err != nil {
+		return 0, m.Err
+	}
+	return m.Count, nil
+}
+
+// Calls returns the options of every call made so far
+func (m *MockClient) Calls() []DelegationOpts {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]DelegationOpts(nil), m.calls...)
+}
+
+func (m *MockClient) record(opts DelegationOpts) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, opts)
+}
@@ -0,0 +1,91 @@
+package tzkt
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers sent by the API describing the rate limit
+const (
+	rateLimitRemainingHeader = "X-RateLimit-Remaining"
+	rateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// RateLimitInfo is the rate limit status sent by the API
+type RateLimitInfo struct {
+	// Remaining is the number of requests left until Reset
+	Remaining int
+	// Reset is the time at which the quota is restored
+	Reset time.Time
+}
+
+// RateLimitCallback is called with the rate limit status
+// sent along every API response
+type RateLimitCallback func(RateLimitInfo)
+
+// WithRateLimitCallback calls cb after every API response
+// carrying rate limit headers
+func WithRateLimitCallback(cb RateLimitCallback) Option {
+	return func(c *Client) {
+		c.onRateLimit = cb
+	}
+}
+
+// waitRateLimit blocks until the quota is restored
+// if the last response exhausted it
+func (c *Client) waitRateLimit(ctx context.Context) error {
+	c.mu.Lock()
+	info := c.rateLimit
+	c.mu.Unlock()
+	if info == nil || info.Remaining > 0 {
+		return nil
+	}
+
+	wait := info.Reset.Sub(c.now())
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.after(wait):
+	}
+
+	c.mu.Lock()
+	if c.rateLimit == info {
+		c.rateLimit = nil
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// updateRateLimit reads the rate limit headers of a response
+// X-RateLimit-Reset is either a unix timestamp or a number of seconds from now
+func (c *Client) updateRateLimit(h http.Header) {
+	remaining, err := strconv.Atoi(h.Get(rateLimitRemainingHeader))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(h.Get(rateLimitResetHeader), 10, 64)
+	if err != nil {
+		return
+	}
+
+	info := RateLimitInfo{Remaining: remaining}
+	// no unix timestamp is that small since 2001
+	if reset < 1_000_000_000 {
+		info.Reset = c.now().Add(time.Duration(reset) * time.Second)
+	} else {
+		info.Reset = time.Unix(reset, 0)
+	}
+
+	c.mu.Lock()
+	c.rateLimit = &info
+	c.mu.Unlock()
+
+	if c.onRateLimit != nil {
+		c.onRateLimit(info)
+	}
+}
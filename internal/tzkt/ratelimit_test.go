@@ -0,0 +1,107 @@
+package tzkt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock replaces the client clock
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (f *fakeClock) install(c *Client) {
+	c.now = func() time.Time { return f.now }
+	c.after = func(d time.Duration) <-chan time.Time {
+		f.waits = append(f.waits, d)
+		ch := make(chan time.Time, 1)
+		ch <- f.now.Add(d)
+		return ch
+	}
+}
+
+func rateLimitServer(remaining int, reset string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(rateLimitRemainingHeader, strconv.Itoa(remaining))
+		w.Header().Set(rateLimitResetHeader, reset)
+		w.Write([]byte("[]"))
+	}))
+}
+
+func Test_Client_RateLimit_wait(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	serv := rateLimitServer(0, "1700000005")
+	defer serv.Close()
+
+	var infos []RateLimitInfo
+	c := NewClient(serv.URL, WithRateLimitCallback(func(i RateLimitInfo) {
+		infos = append(infos, i)
+	}))
+	clock.install(c)
+
+	_, err := c.GetDelegations(context.Background(), DelegationOpts{})
+	assert.NoError(t, err)
+	assert.Empty(t, clock.waits)
+
+	_, err = c.GetDelegations(context.Background(), DelegationOpts{})
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Duration{5 * time.Second}, clock.waits)
+
+	assert.Equal(t, []RateLimitInfo{
+		{Remaining: 0, Reset: time.Unix(1_700_000_005, 0)},
+		{Remaining: 0, Reset: time.Unix(1_700_000_005, 0)},
+	}, infos)
+}
+
+func Test_Client_RateLimit_relativeReset(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	serv := rateLimitServer(0, "30")
+	defer serv.Close()
+
+	c := NewClient(serv.URL)
+	clock.install(c)
+
+	// without a total count header, the count falls back
+	// to the count endpoint which fails to decode "[]"
+	_, err := c.GetDelegationCount(context.Background(), DelegationOpts{})
+	assert.Error(t, err)
+	_, err = c.GetDelegations(context.Background(), DelegationOpts{})
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Duration{30 * time.Second, 30 * time.Second}, clock.waits)
+}
+
+func Test_Client_RateLimit_remaining(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	serv := rateLimitServer(10, "1700000005")
+	defer serv.Close()
+
+	c := NewClient(serv.URL)
+	clock.install(c)
+
+	for range 3 {
+		_, err := c.GetDelegations(context.Background(), DelegationOpts{})
+		assert.NoError(t, err)
+	}
+	assert.Empty(t, clock.waits)
+}
+
+func Test_Client_RateLimit_canceled(t *testing.T) {
+	serv := rateLimitServer(0, "1")
+	defer serv.Close()
+
+	c := NewClient(serv.URL)
+	_, err := c.GetDelegations(context.Background(), DelegationOpts{})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.GetDelegations(ctx, DelegationOpts{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,415 @@
+package tzkt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/rs/zerolog/log"
+)
+
+// ClientInterface is the interface that wraps the TzKT API calls.
+type ClientInterface interface {
+	// GetDelegations returns the delegations matching opts.
+	GetDelegations(ctx context.Context, opts DelegationOpts) ([]tds.Delegation, error)
+	// GetDelegationsPage returns the page of delegations matching opts.
+	GetDelegationsPage(ctx context.Context, opts DelegationOpts) (Page, error)
+	// GetDelegationCount returns the number of delegations matching opts.
+	GetDelegationCount(ctx context.Context, opts DelegationOpts) (int64, error)
+}
+
+// Client calls the TzKT delegation API
+// It waits for the rate limit to reset when the API quota is exhausted
+type Client struct {
+	url         string
+	http        *http.Client
+	onRateLimit RateLimitCallback
+
+	// mockable clock
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+
+	mu        sync.Mutex
+	rateLimit *RateLimitInfo
+}
+
+// DefaultURL is the delegation endpoint of the public tzkt api
+const DefaultURL = "https://api.tzkt.io/v1/operations/delegations"
+
+// Option configures a client
+type Option func(*Client)
+
+// defaultClient is shared by every client
+// so they all reuse the same pooled connections
+var defaultClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		MaxIdleConns:    10,
+		IdleConnTimeout: 90 * time.Second,
+	},
+}
+
+// WithHTTPClient replaces the shared default http client
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// NewClient creates a new client
+// calling the given delegation endpoint
+func NewClient(url string, opts ...Option) *Client {
+	c := &Client{
+		url:   strings.TrimSuffix(url, "/"),
+		http:  defaultClient,
+		now:   time.Now,
+		after: time.After,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// GetDelegations returns the delegations matching opts
+func (c *Client) GetDelegations(ctx context.Context, opts DelegationOpts) ([]tds.Delegation, error) {
+	page, err := c.getDelegations(ctx, opts)
+	return page.Delegations, err
+}
+
+// GetDelegationsPage returns the page of delegations matching opts,
+// along with the number of rows the API returned
+func (c *Client) GetDelegationsPage(ctx context.Context, opts DelegationOpts) (Page, error) {
+	return c.getDelegations(ctx, opts)
+}
+
+// GetDelegationCount returns the number of delegations matching opts
+// Only the date range, delegator and baker options are used
+func (c *Client) GetDelegationCount(ctx context.Context, opts DelegationOpts) (int64, error) {
+	return c.getDelegationCount(ctx, opts)
+}
+
+// do sends the request once the rate limit allows it
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	err := c.waitRateLimit(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	c.updateRateLimit(resp.Header)
+	return resp, nil
+}
+
+// MaxLimit is the maximum number of delegations returned by a single call
+const MaxLimit = 10000
+
+// Page is a page of delegations returned by the API
+type Page struct {
+	// Delegations are the delegations of the page, without the skipped rows
+	Delegations []tds.Delegation
+	// Rows is the number of rows returned by the API, skipped ones included,
+	// a page of fewer rows than the limit is the last one
+	Rows int
+}
+
+// DelegationOpts filters the delegations requested to the API
+type DelegationOpts struct {
+	// TsGe only keeps delegations made at or after this date
+	TsGe string
+	// TsLt only keeps delegations made before this date
+	TsLt string
+	// Limit caps the number of delegations returned, up to MaxLimit
+	Limit int
+	// Offset skips the first delegations
+	Offset int
+	// Baker only keeps delegations to this baker address
+	Baker string
+	// Delegator only keeps delegations sent by this address
+	Delegator string
+	// SortDesc returns the newest delegations first, by descending ids
+	SortDesc bool
+}
+
+// filters returns the query parameters filtering the delegations
+func (opts DelegationOpts) filters() url.Values {
+	q := url.Values{}
+	if opts.TsGe != "" {
+		q.Add("timestamp.ge", opts.TsGe)
+	}
+	if opts.TsLt != "" {
+		q.Add("timestamp.lt", opts.TsLt)
+	}
+	if opts.Baker != "" {
+		// tzkt names the targeted baker the new delegate
+		q.Add("newDelegate.eq", opts.Baker)
+	}
+	if opts.Delegator != "" {
+		q.Add("sender.eq", opts.Delegator)
+	}
+	return q
+}
+
+var (
+	// ErrInvalidStatusCode is returned when the status code is 300 or higher
+	ErrInvalidStatusCode = errors.New("invalid status code")
+)
+
+// maxErrorBodyBytes caps the error response body read by newAPIError
+const maxErrorBodyBytes = 64 << 10
+
+// APIError is returned when the API answers with an error status,
+// it wraps ErrInvalidStatusCode
+type APIError struct {
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+	// Code and Message are read from the tzkt error body, if any
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s : %d", ErrInvalidStatusCode, e.StatusCode)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	return ErrInvalidStatusCode
+}
+
+// newAPIError builds the error of an error response,
+// the body is kept out of the error if it isn't a tzkt error
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var body struct {
+		Code  int    `json:"code"`
+		Error string `json:"error"`
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, maxErrorBodyBytes)).Decode(&body) == nil {
+		apiErr.Code, apiErr.Message = body.Code, body.Error
+	}
+	return apiErr
+}
+
+// MaxResponseBytes caps the size of an API response body,
+// bigger responses are truncated and fail to decode.
+var MaxResponseBytes int64 = 50 << 20
+
+func (c *Client) getDelegations(ctx context.Context, opts DelegationOpts) (Page, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"GET",
+		c.url,
+		nil,
+	)
+	if err != nil {
+		return Page{}, err
+	}
+
+	q := opts.filters()
+	q.Add("select", "timestamp,sender,amount,level,id,newDelegate,hash")
+	if opts.Limit > 0 {
+		q.Add("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		q.Add("offset", strconv.Itoa(opts.Offset))
+	}
+	if opts.SortDesc {
+		q.Add("sort.desc", "id")
+	}
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := c.do(req)
+	if err != nil {
+		return Page{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Page{}, newAPIError(resp)
+	}
+
+	body := &io.LimitedReader{R: resp.Body, N: MaxResponseBytes}
+	page, err := decodeDelegations(ctx, body, opts.Limit)
+	if err != nil && body.N <= 0 && errors.Is(err, io.ErrUnexpectedEOF) {
+		return Page{}, fmt.Errorf("response exceeds %d bytes: %w", MaxResponseBytes, err)
+	}
+	return page, err
+}
+
+type responseDelegation struct {
+	Timestamp string `json:"timestamp"`
+	// Sender is nil for the system operations
+	Sender *struct {
+		Address string `json:"address"`
+	} `json:"sender"`
+	Amount      int `json:"amount"`
+	Level       int `json:"level"`
+	ID          int `json:"id"`
+	NewDelegate struct {
+		Address string `json:"address"`
+	} `json:"newDelegate"`
+	OperationHash string `json:"hash"`
+}
+
+// capacity is used to preallocate the slice
+// to avoid reallocations
+// The delegations without sender are skipped, but counted in the page rows
+// A truncated input returns an error wrapping io.ErrUnexpectedEOF
+func decodeDelegations(ctx context.Context, raw io.Reader, capacity int) (Page, error) {
+	page := Page{Delegations: make([]tds.Delegation, 0, capacity)}
+	r := &eofReader{r: raw}
+	dec := json.NewDecoder(r)
+
+	// read open bracket
+	_, err := dec.Token()
+	if err != nil {
+		return Page{}, r.truncated(err)
+	}
+	for dec.More() {
+		var d responseDelegation
+		if err := dec.Decode(&d); err != nil {
+			return Page{}, r.truncated(err)
+		}
+		page.Rows++
+		if d.Sender == nil {
+			log.Ctx(ctx).Debug().Int("id", d.ID).Int("level", d.Level).Msg("skip delegation without sender")
+			continue
+		}
+		delegation := tds.Delegation{
+			Timestamp:     d.Timestamp,
+			Delegator:     d.Sender.Address,
+			Amount:        strconv.Itoa(d.Amount),
+			Level:         strconv.Itoa(d.Level),
+			ID:            strconv.Itoa(d.ID),
+			Baker:         d.NewDelegate.Address,
+			OperationHash: d.OperationHash,
+		}
+		if err := delegation.Validate(); err != nil {
+			return Page{}, fmt.Errorf("delegation %s: %w", delegation.ID, err)
+		}
+		page.Delegations = append(page.Delegations, delegation)
+	}
+
+	// read closing bracket
+	_, err = dec.Token()
+	if err != nil {
+		return Page{}, r.truncated(err)
+	}
+	return page, nil
+}
+
+// eofReader keeps track of the bytes read
+// to tell truncated inputs apart from malformed ones
+type eofReader struct {
+	r    io.Reader
+	read int64
+	eof  bool
+}
+
+func (e *eofReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	e.read += int64(n)
+	if err == io.EOF {
+		e.eof = true
+	}
+	return n, err
+}
+
+// truncated wraps decoding errors caused by the end of the input
+// with io.ErrUnexpectedEOF
+func (e *eofReader) truncated(err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.Is(err, io.ErrUnexpectedEOF) || err == io.EOF ||
+		(errors.As(err, &syntaxErr) && e.eof && syntaxErr.Offset >= e.read) {
+		return fmt.Errorf("truncated response: %w", io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+// TotalCountHeader is the header holding the number of delegations
+// matching a request, whatever its limit
+const TotalCountHeader = "X-Total-Count"
+
+// getDelegationCount returns the number of delegations matching opts
+// It requests no delegation (limit=0) and reads the TotalCountHeader,
+// falling back to the count endpoint when the header is missing
+func (c *Client) getDelegationCount(ctx context.Context, opts DelegationOpts) (int64, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"GET",
+		c.url,
+		nil,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	q := opts.filters()
+	q.Add("limit", "0")
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, newAPIError(resp)
+	}
+
+	total := resp.Header.Get(TotalCountHeader)
+	if total == "" {
+		return c.countEndpoint(ctx, opts)
+	}
+	count, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s header: %w", TotalCountHeader, err)
+	}
+	return count, nil
+}
+
+// countEndpoint returns the number of delegations matching opts
+// using the count endpoint of the delegation endpoint
+func (c *Client) countEndpoint(ctx context.Context, opts DelegationOpts) (int64, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"GET",
+		c.url+"/count",
+		nil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	req.URL.RawQuery = opts.filters().Encode()
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, newAPIError(resp)
+	}
+
+	var count int64
+	err = json.NewDecoder(resp.Body).Decode(&count)
+	if err != nil {
+		return 0, fmt.Errorf("decode count: %w", err)
+	}
+	return count, nil
+}
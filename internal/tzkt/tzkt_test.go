@@ -0,0 +1,302 @@
+package tzkt
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	response = `
+[{"timestamp":"2024-10-29T10:22:25Z","sender":{"address":"tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms"},"amount":13814013,"level":6976378,"id":1401626186219520,"newDelegate":{"address":"tz1aRoaRhSpRYvFdyvgWLL6TGyRoGF51wDjM"},"hash":"onvN7kLsYyJ2m4oVjX3rAcD8RaGzQpWuF6tHbE1Kc9dLsM5xTfP"},{"timestamp":"2024-10-29T10:10:00Z","sender":{"address":"tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP"},"amount":2548493,"level":6976305,"id":1401610442899456},{"timestamp":"2024-10-29T10:09:00Z","sender":{"address":"tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP"},"amount":2548751,"level":6976299,"id":1401609161539584}]
+	`
+	expected = []tds.Delegation{
+		{
+			Timestamp:     "2024-10-29T10:22:25Z",
+			Delegator:     "tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms",
+			Amount:        "13814013",
+			Level:         "6976378",
+			ID:            "1401626186219520",
+			Baker:         "tz1aRoaRhSpRYvFdyvgWLL6TGyRoGF51wDjM",
+			OperationHash: "onvN7kLsYyJ2m4oVjX3rAcD8RaGzQpWuF6tHbE1Kc9dLsM5xTfP",
+		},
+		{
+			Timestamp: "2024-10-29T10:10:00Z",
+			Delegator: "tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP",
+			Amount:    "2548493",
+			Level:     "6976305",
+			ID:        "1401610442899456",
+		},
+		{
+			Timestamp: "2024-10-29T10:09:00Z",
+			Delegator: "tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP",
+			Amount:    "2548751",
+			Level:     "6976299",
+			ID:        "1401609161539584",
+		},
+	}
+)
+
+func Test_decodeDelegations_ok(t *testing.T) {
+	reader := strings.NewReader(response)
+	page, err := decodeDelegations(context.Background(), reader, 3)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, expected, page.Delegations)
+	assert.Equal(t, 3, page.Rows)
+}
+
+func Test_decodeDelegations_nullSender(t *testing.T) {
+	// the null sender sits between two valid delegations
+	reader := strings.NewReader(`[
+		{"timestamp":"2024-10-29T10:22:25Z","sender":{"address":"tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms"},"amount":13814013,"level":6976378,"id":1401626186219520,"newDelegate":{"address":"tz1aRoaRhSpRYvFdyvgWLL6TGyRoGF51wDjM"},"hash":"onvN7kLsYyJ2m4oVjX3rAcD8RaGzQpWuF6tHbE1Kc9dLsM5xTfP"},
+		{"timestamp":"2024-10-29T10:15:00Z","sender":null,"amount":0,"level":6976340,"id":1401618000000000},
+		{"timestamp":"2024-10-29T10:10:00Z","sender":{"address":"tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP"},"amount":2548493,"level":6976305,"id":1401610442899456}
+	]`)
+	page, err := decodeDelegations(context.Background(), reader, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []tds.Delegation{expected[0], expected[1]}, page.Delegations)
+	// the skipped row still counts, a full page is not mistaken for the last one
+	assert.Equal(t, 3, page.Rows)
+}
+
+func Test_decodeDelegations_error_BadJSON(t *testing.T) {
+	reader := strings.NewReader(`[{"timestamp":"2024-10-29T10:22:25Z","sender":{"address":`)
+	_, err := decodeDelegations(context.Background(), reader, 1)
+	assert.Error(t, err)
+}
+
+func Test_decodeDelegations_error_Invalid(t *testing.T) {
+	reader := strings.NewReader(`[{"timestamp":"2024-10-29T10:22:25Z","sender":{"address":"tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms"},"amount":-1,"level":6976378,"id":1}]`)
+	_, err := decodeDelegations(context.Background(), reader, 1)
+	assert.ErrorIs(t, err, tds.ErrInvalidDelegation)
+}
+
+func Test_decodeDelegations_error_Truncated(t *testing.T) {
+	reader := strings.NewReader(response[:strings.LastIndex(response, "]")])
+	_, err := decodeDelegations(context.Background(), reader, 3)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func httpTestServer(response string, code int, reqTests func(r *http.Request)) *httptest.Server {
+	serv := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if reqTests != nil {
+					reqTests(r)
+				}
+				w.WriteHeader(code)
+				w.Write([]byte(response))
+			}))
+	return serv
+}
+
+func Test_getDelegations_ok(t *testing.T) {
+	serv := httpTestServer(response, 200, func(r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "timestamp,sender,amount,level,id,newDelegate,hash", r.URL.Query().Get("select"))
+		assert.Empty(t, r.URL.Query().Get("timestamp.ge"))
+		assert.Empty(t, r.URL.Query().Get("timestamp.lt"))
+		assert.Empty(t, r.URL.Query().Get("limit"))
+		assert.Empty(t, r.URL.Query().Get("offset"))
+		assert.Empty(t, r.URL.Query().Get("newDelegate.eq"))
+		assert.Empty(t, r.URL.Query().Get("sort.desc"))
+	})
+	defer serv.Close()
+	page, err := NewClient(serv.URL).getDelegations(context.Background(), DelegationOpts{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, expected, page.Delegations)
+}
+
+func Test_getDelegation_Params(t *testing.T) {
+	var (
+		date = "2024-10-29T10:22:25Z"
+	)
+
+	serv := httpTestServer("[]", 200, func(r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "timestamp,sender,amount,level,id,newDelegate,hash", r.URL.Query().Get("select"))
+		assert.Equal(t, date, r.URL.Query().Get("timestamp.ge"))
+		assert.Equal(t, date, r.URL.Query().Get("timestamp.lt"))
+		assert.Equal(t, "1000", r.URL.Query().Get("limit"))
+		assert.Equal(t, "2000", r.URL.Query().Get("offset"))
+		assert.Equal(t, "tz1aRoaRhSpRYvFdyvgWLL6TGyRoGF51wDjM", r.URL.Query().Get("newDelegate.eq"))
+		assert.Equal(t, "id", r.URL.Query().Get("sort.desc"))
+	})
+	defer serv.Close()
+
+	opts := DelegationOpts{
+		TsGe:     date,
+		TsLt:     date,
+		Limit:    1000,
+		Offset:   2000,
+		Baker:    "tz1aRoaRhSpRYvFdyvgWLL6TGyRoGF51wDjM",
+		SortDesc: true,
+	}
+	page, err := NewClient(serv.URL).getDelegations(context.Background(), opts)
+	assert.NoError(t, err)
+	assert.Empty(t, page.Delegations)
+}
+
+func Test_getDelegations_error_HttpCode(t *testing.T) {
+	serv := httpTestServer(response, 400, nil)
+	defer serv.Close()
+	_, err := NewClient(serv.URL).getDelegations(context.Background(), DelegationOpts{})
+	assert.ErrorIs(t, err, ErrInvalidStatusCode)
+}
+
+func Test_getDelegations_error_APIError(t *testing.T) {
+	serv := httpTestServer(`{"code":400,"error":"Invalid filter"}`, 400, nil)
+	defer serv.Close()
+	_, err := NewClient(serv.URL).getDelegations(context.Background(), DelegationOpts{})
+	assert.ErrorIs(t, err, ErrInvalidStatusCode)
+	var apiErr *APIError
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, &APIError{StatusCode: 400, Code: 400, Message: "Invalid filter"}, apiErr)
+	}
+	assert.EqualError(t, err, "invalid status code : 400: Invalid filter")
+
+	serv = httpTestServer("<html>Internal Server Error</html>", 500, nil)
+	defer serv.Close()
+	_, err = NewClient(serv.URL).getDelegations(context.Background(), DelegationOpts{})
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, &APIError{StatusCode: 500}, apiErr)
+	}
+	assert.EqualError(t, err, "invalid status code : 500")
+}
+
+func Test_getDelegations_error_TooLarge(t *testing.T) {
+	defer func(max int64) { MaxResponseBytes = max }(MaxResponseBytes)
+	MaxResponseBytes = int64(len(response)) / 2
+
+	serv := httpTestServer(response, 200, nil)
+	defer serv.Close()
+	_, err := NewClient(serv.URL).getDelegations(context.Background(), DelegationOpts{})
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.ErrorContains(t, err, "response exceeds")
+}
+
+func Test_getDelegations_error_BadURL(t *testing.T) {
+	_, err := NewClient("").getDelegations(context.Background(), DelegationOpts{})
+	assert.Error(t, err)
+}
+
+// countingTransport counts the requests it sends
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func Test_NewClient_httpClient(t *testing.T) {
+	assert.Same(t, defaultClient, NewClient("").http)
+	assert.Same(t, NewClient("").http, NewClient("").http)
+
+	serv := httpTestServer("[]", 200, nil)
+	defer serv.Close()
+	transport := &countingTransport{}
+	c := NewClient(serv.URL, WithHTTPClient(&http.Client{Transport: transport}))
+
+	_, err := c.GetDelegations(context.Background(), DelegationOpts{})
+	assert.NoError(t, err)
+	_, err = c.GetDelegations(context.Background(), DelegationOpts{})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), transport.requests.Load())
+}
+
+func Test_getDelegationCount(t *testing.T) {
+	date := "2024-10-29T10:22:25Z"
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/", r.URL.Path)
+		assert.Equal(t, "0", r.URL.Query().Get("limit"))
+		assert.Equal(t, date, r.URL.Query().Get("timestamp.ge"))
+		assert.Equal(t, date, r.URL.Query().Get("timestamp.lt"))
+		assert.Equal(t, "tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB", r.URL.Query().Get("newDelegate.eq"))
+		assert.Equal(t, "tz1deLegatorDDDDDDDDDDDDDDDDDDDDDDDD", r.URL.Query().Get("sender.eq"))
+		w.Header().Set(TotalCountHeader, "42")
+		w.Write([]byte("[]"))
+	}))
+	defer serv.Close()
+
+	count, err := NewClient(serv.URL).GetDelegationCount(context.Background(), DelegationOpts{
+		TsGe:      date,
+		TsLt:      date,
+		Baker:     "tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB",
+		Delegator: "tz1deLegatorDDDDDDDDDDDDDDDDDDDDDDDD",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), count)
+}
+
+func Test_getDelegationCount_countEndpoint(t *testing.T) {
+	date := "2024-10-29T10:22:25Z"
+	var paths []string
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		assert.Equal(t, date, r.URL.Query().Get("timestamp.ge"))
+		if r.URL.Path == "/count" {
+			w.Write([]byte("42"))
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer serv.Close()
+
+	count, err := NewClient(serv.URL).getDelegationCount(context.Background(), DelegationOpts{TsGe: date})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), count)
+	assert.Equal(t, []string{"/", "/count"}, paths)
+}
+
+func Test_getDelegationCount_error(t *testing.T) {
+	serv := httpTestServer("", 500, nil)
+	defer serv.Close()
+	_, err := NewClient(serv.URL).getDelegationCount(context.Background(), DelegationOpts{})
+	assert.ErrorIs(t, err, ErrInvalidStatusCode)
+
+	serv = httpTestServer("not a number", 200, nil)
+	defer serv.Close()
+	_, err = NewClient(serv.URL).getDelegationCount(context.Background(), DelegationOpts{})
+	assert.Error(t, err)
+
+	serv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(TotalCountHeader, "many")
+	}))
+	defer serv.Close()
+	_, err = NewClient(serv.URL).getDelegationCount(context.Background(), DelegationOpts{})
+	assert.ErrorContains(t, err, TotalCountHeader)
+}
+
+func FuzzDecodeDelegations(f *testing.F) {
+	f.Add([]byte(response))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(`[{"timestamp":"2024-10-29T10:22:25Z","sender":{"address":"tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms"},"amount":0,"level":6976378,"id":1}]`))
+	f.Add([]byte(`[{"timestamp":"2024-10-29T10:22:25Z","sender":{"address":"tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms"},"amount":9223372036854775807,"level":6976378,"id":1}]`))
+	f.Add([]byte("[{\"timestamp\":\"2024-10-29T10:22:25Z\",\"sender\":{\"address\":\"tz1\xff\xfe\"},\"amount\":1,\"level\":1,\"id\":1}]"))
+
+	large := make([]string, MaxLimit)
+	for i := range large {
+		large[i] = `{"timestamp":"2024-10-29T10:22:25Z","sender":{"address":"tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms"},"amount":1,"level":1,"id":` + strconv.Itoa(i) + `}`
+	}
+	f.Add([]byte("[" + strings.Join(large, ",") + "]"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		page, err := decodeDelegations(context.Background(), strings.NewReader(string(data)), 0)
+		if err != nil {
+			assert.Nil(t, page.Delegations)
+			return
+		}
+		assert.NotNil(t, page.Delegations)
+		assert.GreaterOrEqual(t, page.Rows, len(page.Delegations))
+	})
+}
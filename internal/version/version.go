@@ -0,0 +1,42 @@
+package version
+
+import "fmt"
+
+// Build information, set at link time with
+// -ldflags "-X github.com/frieeze/tezos-delegation/internal/version.Version=v1.2.3"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info holds the build information
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+}
+
+// Get returns the build information
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+	}
+}
+
+// String returns the build information in a human readable format
+func String() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", Version, Commit, BuildDate)
+}
+
+// Requested reports whether the version flag is part of the given arguments
+func Requested(args []string) bool {
+	for _, arg := range args {
+		if arg == "--version" || arg == "-version" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package xtz
+
+import (
+	"context"
+	"sync/atomic"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+// dryRunStore reads from the wrapped store
+// but only logs and counts the delegations to insert
+type dryRunStore struct {
+	store.Store
+	count atomic.Int64
+}
+
+func (s *dryRunStore) Insert(ctx context.Context, ds []tds.Delegation) error {
+	_, err := s.InsertCount(ctx, ds)
+	return err
+}
+
+// InsertCount counts every delegation as inserted
+func (s *dryRunStore) InsertCount(ctx context.Context, ds []tds.Delegation) (int64, error) {
+	s.count.Add(int64(len(ds)))
+	for _, d := range ds {
+		log.Ctx(ctx).Debug().
+			Str("id", d.ID).
+			Str("timestamp", d.Timestamp).
+			Str("delegator", d.Delegator).
+			Str("amount", d.Amount).
+			Msg("dry run insert")
+	}
+	return int64(len(ds)), nil
+}
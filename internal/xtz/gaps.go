@@ -0,0 +1,99 @@
+package xtz
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultGapThreshold is the level difference between two history batches
+// reported as a gap, about 5 hours of blocks
+const defaultGapThreshold = 10000
+
+// GapReport is a level difference larger than the gap threshold
+// between two consecutive history batches.
+// Blocks without delegations are legit, but a large gap may be missing data.
+type GapReport struct {
+	// FromLevel and From are the level and timestamp before the gap
+	FromLevel int64  `json:"from_level"`
+	From      string `json:"from"`
+	// ToLevel and To are the level and timestamp after the gap
+	ToLevel int64  `json:"to_level"`
+	To      string `json:"to"`
+}
+
+// gapDetector compares the levels at the boundaries of consecutive batches
+type gapDetector struct {
+	threshold int64
+	reverse   bool
+
+	mu   sync.Mutex
+	last *tds.Delegation
+	gaps []GapReport
+}
+
+// reset forgets the previous batch, at the start of a new range
+func (g *gapDetector) reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.last = nil
+}
+
+// clear forgets the previous batch and the reported gaps
+func (g *gapDetector) clear() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.last = nil
+	g.gaps = nil
+}
+
+// check compares the first level of the batch with the last level of the previous one,
+// empty batches are skipped and widen the gap found by the next one
+func (g *gapDetector) check(ctx context.Context, delegations []tds.Delegation) {
+	if g.threshold <= 0 || len(delegations) == 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	prev, first := g.last, delegations[0]
+	// a copy, the batch can be released
+	last := delegations[len(delegations)-1]
+	g.last = &last
+	if prev == nil {
+		return
+	}
+	before, err := strconv.ParseInt(prev.Level, 10, 64)
+	if err != nil {
+		return
+	}
+	after, err := strconv.ParseInt(first.Level, 10, 64)
+	if err != nil {
+		return
+	}
+	gap := GapReport{FromLevel: before, From: prev.Timestamp, ToLevel: after, To: first.Timestamp}
+	if g.reverse {
+		// reverse batches go down the levels
+		gap = GapReport{FromLevel: after, From: first.Timestamp, ToLevel: before, To: prev.Timestamp}
+	}
+	if gap.ToLevel-gap.FromLevel <= g.threshold {
+		return
+	}
+	g.gaps = append(g.gaps, gap)
+	log.Ctx(ctx).Warn().
+		Int64("from_level", gap.FromLevel).
+		Int64("to_level", gap.ToLevel).
+		Str("from", gap.From).
+		Str("to", gap.To).
+		Msg("level gap between history batches")
+}
+
+// report returns the gaps found since the last clear
+func (g *gapDetector) report() []GapReport {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]GapReport(nil), g.gaps...)
+}
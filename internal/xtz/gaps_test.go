@@ -0,0 +1,81 @@
+package xtz
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/tzkt"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func levels(levels ...string) []tds.Delegation {
+	ds := make([]tds.Delegation, len(levels))
+	for i, level := range levels {
+		ds[i] = tds.Delegation{Level: level, Timestamp: "ts" + level}
+	}
+	return ds
+}
+
+func Test_gapDetector_check(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := zerolog.New(&buf).WithContext(context.Background())
+
+	g := &gapDetector{threshold: 100}
+	g.check(ctx, levels("1", "50"))
+	g.check(ctx, levels("150", "200"))
+	// empty batches widen the gap
+	g.check(ctx, nil)
+	g.check(ctx, levels("301", "400"))
+	assert.Equal(t, []GapReport{{FromLevel: 200, From: "ts200", ToLevel: 301, To: "ts301"}}, g.report())
+	assert.Contains(t, buf.String(), `"level":"warn"`)
+	assert.Contains(t, buf.String(), `"from_level":200`)
+
+	// a new range doesn't compare with the previous one
+	g.reset()
+	g.check(ctx, levels("1000"))
+	assert.Len(t, g.report(), 1)
+
+	g.clear()
+	assert.Empty(t, g.report())
+}
+
+func Test_gapDetector_check_reverse(t *testing.T) {
+	g := &gapDetector{threshold: 100, reverse: true}
+	g.check(context.Background(), levels("400", "301"))
+	g.check(context.Background(), levels("200", "150"))
+	g.check(context.Background(), levels("100", "1"))
+	assert.Equal(t, []GapReport{{FromLevel: 200, From: "ts200", ToLevel: 301, To: "ts301"}}, g.report())
+}
+
+func Test_gapDetector_check_disabled(t *testing.T) {
+	g := &gapDetector{}
+	g.check(context.Background(), levels("1"))
+	g.check(context.Background(), levels("100000"))
+	assert.Empty(t, g.report())
+}
+
+func Test_History_Gaps(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{
+		DelegationsFunc: func(opts tzkt.DelegationOpts) ([]tds.Delegation, error) {
+			if opts.TsGe == "2024-10-30T00:00:00Z" {
+				return levels("30000"), nil
+			}
+			return levels("1"), nil
+		},
+	}
+	h := NewHistory(storage, WithClient(client), WithChunkDuration(24*time.Hour), WithGapThreshold(10000))
+
+	storage.On("GetFirst", mock.Anything).Return(nil, nil)
+	storage.On("InsertCount", mock.Anything, mock.Anything).Return(int64(1), nil)
+
+	err := h.Sync(context.Background(), "2024-10-29T00:00:00Z", "2024-10-31T00:00:00Z")
+	assert.NoError(t, err)
+	defer h.Stop()
+	assert.Equal(t, []GapReport{{FromLevel: 1, From: "ts1", ToLevel: 30000, To: "ts30000"}}, h.Gaps())
+}
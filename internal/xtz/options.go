@@ -0,0 +1,226 @@
+package xtz
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/frieeze/tezos-delegation/internal/metrics"
+	"github.com/frieeze/tezos-delegation/internal/tzkt"
+	"github.com/rs/zerolog"
+)
+
+// Option configures a syncer
+type Option func(*options)
+
+type options struct {
+	api           string
+	httpClient    *http.Client
+	client        tzkt.ClientInterface
+	interval      time.Duration
+	jitter        time.Duration
+	maxErrors     int
+	maxBackoff    time.Duration
+	logger        *zerolog.Logger
+	chunkDuration time.Duration
+	baker         string
+	dryRun        bool
+	overlap       float64
+	progressEvery int
+	reverse       bool
+	batchSize     int
+	until         string
+	gapThreshold  int
+	metrics       *metrics.Sync
+}
+
+// defaultOverlap is the fraction of the interval
+// fetched again by each live sync
+const defaultOverlap = 0.2
+
+// Live sync backoff defaults
+const (
+	defaultMaxErrors  = 10
+	defaultMaxBackoff = time.Hour
+)
+
+func newOptions(opts []Option) options {
+	o := options{
+		api:           tzkt.DefaultURL,
+		overlap:       defaultOverlap,
+		progressEvery: defaultProgressEvery,
+		maxErrors:     defaultMaxErrors,
+		maxBackoff:    defaultMaxBackoff,
+		gapThreshold:  defaultGapThreshold,
+		batchSize:     tzkt.MaxLimit,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.client == nil {
+		var clientOpts []tzkt.Option
+		if o.httpClient != nil {
+			clientOpts = append(clientOpts, tzkt.WithHTTPClient(o.httpClient))
+		}
+		o.client = tzkt.NewClient(o.api, clientOpts...)
+	}
+	return o
+}
+
+// WithAPI sets the tzkt delegation endpoint
+// Defaults to tzkt.DefaultURL, ignored along with WithClient
+func WithAPI(url string) Option {
+	return func(o *options) {
+		o.api = url
+	}
+}
+
+// WithHTTPClient makes the default tzkt client use the given http client
+// Ignored along with WithClient
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = c
+	}
+}
+
+// WithClient replaces the default tzkt client
+func WithClient(c tzkt.ClientInterface) Option {
+	return func(o *options) {
+		o.client = c
+	}
+}
+
+// WithInterval sets the interval between two live syncs
+// Required by the live syncer, which fails to start on a negative interval,
+// ignored by the history syncer
+func WithInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.interval = d
+	}
+}
+
+// WithJitter delays each periodic live sync by a random duration
+// up to d, so that several instances don't hit the api together
+// Ignored by the history syncer
+func WithJitter(d time.Duration) Option {
+	return func(o *options) {
+		o.jitter = d
+	}
+}
+
+// WithMaxErrors sets the number of consecutive failed live syncs after which
+// the interval doubles on each new failure, until a sync succeeds
+// Defaults to 10, 0 disables the backoff, ignored by the history syncer
+func WithMaxErrors(n int) Option {
+	return func(o *options) {
+		o.maxErrors = n
+	}
+}
+
+// WithMaxBackoff caps the interval of a backing off live sync
+// Defaults to an hour, ignored by the history syncer
+func WithMaxBackoff(d time.Duration) Option {
+	return func(o *options) {
+		o.maxBackoff = d
+	}
+}
+
+// WithLogger makes the syncer log to l instead of the context logger
+func WithLogger(l zerolog.Logger) Option {
+	return func(o *options) {
+		o.logger = &l
+	}
+}
+
+// WithChunkDuration makes the history syncer fetch
+// fixed time slices of the given duration (e.g. 24*time.Hour)
+// instead of adaptive batches of WithBatchSize delegations
+// Slices are aligned on multiples of the duration
+// Ignored by the live syncer
+func WithChunkDuration(d time.Duration) Option {
+	return func(o *options) {
+		o.chunkDuration = d
+	}
+}
+
+// WithBaker only syncs the delegations to the given baker
+func WithBaker(baker string) Option {
+	return func(o *options) {
+		o.baker = baker
+	}
+}
+
+// WithDryRun makes the history syncer fetch the delegations
+// without inserting them, they are logged at debug level instead
+// Ignored by the live syncer
+func WithDryRun() Option {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
+
+// WithOverlap sets the fraction of the interval, between 0 and 1,
+// fetched again by each live sync to catch late delegations
+// Defaults to 0.2, ignored by the history syncer
+func WithOverlap(fraction float64) Option {
+	return func(o *options) {
+		o.overlap = fraction
+	}
+}
+
+// WithProgressEvery makes the history syncer log its progress
+// every n batches, the first and last batches are always logged
+// Defaults to 100, ignored by the live syncer
+func WithProgressEvery(n int) Option {
+	return func(o *options) {
+		o.progressEvery = n
+	}
+}
+
+// WithReverseOrder makes the history syncer start from the most recent
+// delegations and work backward to the start of the range
+// Ignored by the live syncer
+func WithReverseOrder() Option {
+	return func(o *options) {
+		o.reverse = true
+	}
+}
+
+// minBatchSize keeps the syncers from paging a few delegations at a time
+const minBatchSize = 100
+
+// WithBatchSize sets the number of delegations fetched and inserted
+// by each request, between 100 and tzkt.MaxLimit
+// Smaller batches use less memory, values out of range are clamped
+// Defaults to tzkt.MaxLimit
+func WithBatchSize(n int) Option {
+	return func(o *options) {
+		o.batchSize = min(max(n, minBatchSize), tzkt.MaxLimit)
+	}
+}
+
+// WithUntil makes the live syncer stop once the current time passes to,
+// the delegations made after it are not fetched
+// Used to replay a past time range at live speed, ignored by the history syncer
+func WithUntil(to string) Option {
+	return func(o *options) {
+		o.until = to
+	}
+}
+
+// WithGapThreshold sets the level difference between two consecutive
+// history batches above which a gap is reported, see History.Gaps
+// Defaults to 10000, 0 disables the detection, ignored by the live syncer
+// The delegations of a single baker are sparser, see WithBaker
+func WithGapThreshold(levels int) Option {
+	return func(o *options) {
+		o.gapThreshold = levels
+	}
+}
+
+// WithRegistry records the sync metrics on reg
+// Without it no metrics are recorded
+func WithRegistry(reg metrics.Registry) Option {
+	return func(o *options) {
+		o.metrics = metrics.NewSync(reg)
+	}
+}
@@ -0,0 +1,83 @@
+package xtz
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultProgressEvery is the number of batches
+// between two history progress logs
+const defaultProgressEvery = 100
+
+// progress logs the advancement of a history sync
+// every n batches, and on the first and last ones
+type progress struct {
+	every int
+	from  time.Time
+	to    time.Time
+	start string
+	end   string
+	began time.Time
+	batch int
+	// reverse syncs reach from, back from to
+	reverse bool
+}
+
+func newProgress(every int, from, to string) *progress {
+	p := &progress{every: every, start: from, end: to, began: time.Now()}
+	// unparsable dates only prevent the estimation
+	p.from, _ = time.Parse(dateFormat, from)
+	p.to, _ = time.Parse(dateFormat, to)
+	return p
+}
+
+// done records a completed batch which reached the given timestamp
+func (p *progress) done(ctx context.Context, reached string, last bool) {
+	p.batch++
+	if !last && p.batch != 1 && (p.every <= 0 || p.batch%p.every != 0) {
+		return
+	}
+
+	logger := log.Ctx(ctx)
+	if logger.GetLevel() == zerolog.Disabled {
+		return
+	}
+
+	// the range left to sync
+	left, right := reached, p.end
+	if p.reverse {
+		left, right = p.start, reached
+	}
+	ev := logger.Info().
+		Int("batch", p.batch).
+		Str("from", left).
+		Str("to", right)
+	if last {
+		ev = ev.Str("estimated_remaining", "0s")
+	} else if remaining, ok := p.remaining(reached); ok {
+		ev = ev.Str("estimated_remaining", remaining.Round(time.Second).String())
+	}
+	ev.Msg("history sync progress")
+}
+
+// remaining estimates the time left to reach p.to,
+// from the fraction of the range already synced
+func (p *progress) remaining(reached string) (time.Duration, bool) {
+	at, err := time.Parse(dateFormat, reached)
+	if err != nil || p.from.IsZero() || !p.to.After(p.from) {
+		return 0, false
+	}
+	synced := at.Sub(p.from)
+	if p.reverse {
+		synced = p.to.Sub(at)
+	}
+	fraction := float64(synced) / float64(p.to.Sub(p.from))
+	if fraction <= 0 {
+		return 0, false
+	}
+	elapsed := time.Since(p.began)
+	return time.Duration(float64(elapsed)/min(fraction, 1)) - elapsed, true
+}
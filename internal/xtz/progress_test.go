@@ -0,0 +1,77 @@
+package xtz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_progress_done(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := zerolog.New(&buf).WithContext(context.Background())
+
+	p := newProgress(2, "2024-01-01T00:00:00Z", "2024-01-05T00:00:00Z")
+	p.done(ctx, "2024-01-02T00:00:00Z", false)
+	p.done(ctx, "2024-01-03T00:00:00Z", false)
+	p.done(ctx, "2024-01-04T00:00:00Z", false)
+	p.done(ctx, "2024-01-05T00:00:00Z", true)
+
+	var batches []int
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry struct {
+			Message   string `json:"message"`
+			Batch     int    `json:"batch"`
+			To        string `json:"to"`
+			Remaining string `json:"estimated_remaining"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, "history sync progress", entry.Message)
+		assert.Equal(t, "2024-01-05T00:00:00Z", entry.To)
+		assert.NotEmpty(t, entry.Remaining)
+		batches = append(batches, entry.Batch)
+	}
+	// first, every second and last batches
+	assert.Equal(t, []int{1, 2, 4}, batches)
+}
+
+func Test_progress_done_noLogger(t *testing.T) {
+	p := newProgress(1, "invalid", "")
+	assert.NotPanics(t, func() {
+		p.done(context.Background(), "invalid", false)
+		p.done(context.Background(), "", true)
+	})
+}
+
+func Test_progress_remaining(t *testing.T) {
+	p := newProgress(1, "2024-01-01T00:00:00Z", "2024-01-05T00:00:00Z")
+	p.began = p.began.Add(-time.Hour)
+
+	remaining, ok := p.remaining("2024-01-02T00:00:00Z")
+	require.True(t, ok)
+	// a quarter done in an hour leaves three hours
+	assert.InDelta(t, float64(3*time.Hour), float64(remaining), float64(time.Hour/60))
+
+	_, ok = p.remaining("2024-01-01T00:00:00Z")
+	assert.False(t, ok)
+}
+
+func Test_progress_remaining_reverse(t *testing.T) {
+	p := newProgress(1, "2024-01-01T00:00:00Z", "2024-01-05T00:00:00Z")
+	p.reverse = true
+	p.began = p.began.Add(-time.Hour)
+
+	remaining, ok := p.remaining("2024-01-04T00:00:00Z")
+	require.True(t, ok)
+	// a quarter done in an hour leaves three hours
+	assert.InDelta(t, float64(3*time.Hour), float64(remaining), float64(time.Hour/60))
+
+	_, ok = p.remaining("2024-01-05T00:00:00Z")
+	assert.False(t, ok)
+}
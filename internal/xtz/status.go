@@ -0,0 +1,81 @@
+package xtz
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Status is a snapshot of the live sync state
+type Status struct {
+	Interval string `json:"interval"`
+	// LastSync is the time of the last successful sync
+	LastSync  time.Time `json:"last_sync"`
+	Syncs     int64     `json:"syncs"`
+	Errors    int64     `json:"errors"`
+	LastError string    `json:"last_error,omitempty"`
+	// Fetched is the number of delegations fetched since the start
+	Fetched int64 `json:"fetched"`
+	// BackoffLevel is 0, or n when the interval is multiplied by 2^n
+	// after more than WithMaxErrors consecutive errors
+	BackoffLevel int `json:"backoff_level"`
+}
+
+// Status returns the current state of the live sync,
+// it is safe to call while the syncer runs
+func (l *Live) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.status
+	s.Interval = l.interval.String()
+	return s
+}
+
+// record updates the status with the outcome of a sync
+func (l *Live) record(fetched int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.status.Syncs++
+	l.status.Fetched += int64(fetched)
+	if err != nil {
+		l.status.Errors++
+		l.status.LastError = err.Error()
+		l.failures++
+	} else {
+		l.status.LastSync = time.Now()
+		l.failures = 0
+	}
+
+	level := 0
+	if l.maxErrors > 0 && l.failures >= l.maxErrors {
+		level = l.failures - l.maxErrors
+	}
+	if level == l.status.BackoffLevel {
+		return
+	}
+	l.status.BackoffLevel = level
+	d := backoffInterval(l.interval, level, l.maxBackoff)
+	if l.ticker != nil {
+		l.ticker.Reset(d)
+	}
+	log.Ctx(l.ctx).Warn().Int("failures", l.failures).Str("interval", d.String()).Msg("live sync backoff")
+}
+
+// backoffInterval returns min(interval * 2^level, max),
+// never shorter than interval
+func backoffInterval(interval time.Duration, level int, max time.Duration) time.Duration {
+	d := interval
+	for range level {
+		if d >= max {
+			break
+		}
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if d < interval {
+		d = interval
+	}
+	return d
+}
@@ -0,0 +1,69 @@
+package xtz
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/frieeze/tezos-delegation/internal/tzkt"
+	"github.com/rs/zerolog/log"
+)
+
+// Verifier compares the delegations stored
+// with the ones known by the API
+type Verifier struct {
+	client tzkt.ClientInterface
+	store  store.Store
+}
+
+// VerifyResult holds the outcome of a verification
+type VerifyResult struct {
+	APICount   int64 `json:"api_count"`
+	StoreCount int64 `json:"store_count"`
+	// Missing is the number of delegations known by the API
+	// but absent from the store
+	Missing int64 `json:"missing"`
+}
+
+// NewVerifier creates a new verifier
+// comparing the given store against the given url
+func NewVerifier(api string, s store.Store, opts ...Option) *Verifier {
+	o := newOptions(append([]Option{WithAPI(api)}, opts...))
+	return &Verifier{
+		client: o.client,
+		store:  s,
+	}
+}
+
+// Verify compares the number of delegations inside a given time range
+// from and to are optional, they default to the first delegation and now
+// dates should be in RFC3339 format
+func (v *Verifier) Verify(ctx context.Context, from, to string) (VerifyResult, error) {
+	if from == "" {
+		from = firstDelegation
+	}
+	if to == "" {
+		to = time.Now().Format(dateFormat)
+	}
+	log.Ctx(ctx).Info().Str("from", from).Str("to", to).Msg("verify store")
+
+	apiCount, err := v.client.GetDelegationCount(ctx, tzkt.DelegationOpts{
+		TsGe: from,
+		TsLt: to,
+	})
+	if err != nil {
+		return VerifyResult{}, fmt.Errorf("failed to get api count: %w", err)
+	}
+
+	storeCount, err := v.store.CountByDateRange(ctx, from, to)
+	if err != nil {
+		return VerifyResult{}, fmt.Errorf("failed to get store count: %w", err)
+	}
+
+	return VerifyResult{
+		APICount:   apiCount,
+		StoreCount: storeCount,
+		Missing:    apiCount - storeCount,
+	}, nil
+}
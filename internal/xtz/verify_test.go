@@ -0,0 +1,39 @@
+package xtz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/frieeze/tezos-delegation/internal/tzkt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_Verifier_Verify(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Count: 42}
+
+	from, to := "2024-01-01T00:00:00Z", "2025-01-01T00:00:00Z"
+	storage.On("CountByDateRange", mock.Anything, from, to).Return(int64(40), nil)
+
+	v := NewVerifier("", storage, WithClient(client))
+	res, err := v.Verify(context.Background(), from, to)
+	assert.NoError(t, err)
+	assert.Equal(t, VerifyResult{APICount: 42, StoreCount: 40, Missing: 2}, res)
+	assert.Equal(t, []tzkt.DelegationOpts{{TsGe: from, TsLt: to}}, client.Calls())
+
+	storage.AssertExpectations(t)
+}
+
+func Test_Verifier_Verify_error(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Count: 42}
+
+	storage.On("CountByDateRange", mock.Anything, firstDelegation, mock.Anything).Return(int64(0), assert.AnError)
+
+	v := NewVerifier("", storage, WithClient(client))
+	_, err := v.Verify(context.Background(), "", "")
+	assert.ErrorIs(t, err, assert.AnError)
+
+	storage.AssertExpectations(t)
+}
@@ -2,43 +2,75 @@ package xtz
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"strconv"
-	"strings"
+	"math/rand/v2"
+	"sync"
 	"time"
 
 	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/metrics"
 	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/frieeze/tezos-delegation/internal/tzkt"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 // NewLive creates a new live syncer
-// It will sync the delegations from the given url every interval
+// It will sync the delegations from the tzkt api every WithInterval
 // and store them in the given store
-func NewLive(api string, interval time.Duration, s store.Store) *Live {
+func NewLive(s store.Store, opts ...Option) *Live {
+	o := newOptions(opts)
 	return &Live{
-		api:      strings.TrimSuffix(api, "/"),
-		interval: interval,
-		store:    s,
+		client:     o.client,
+		interval:   o.interval,
+		jitter:     o.jitter,
+		logger:     o.logger,
+		maxErrors:  o.maxErrors,
+		maxBackoff: o.maxBackoff,
+		store:      s,
+		baker:      o.baker,
+		overlap:    o.overlap,
+		batchSize:  o.batchSize,
+		metrics:    o.metrics,
+		to:         o.until,
+		trigger:    make(chan struct{}),
 	}
 }
 
 // Live will sync the delegations every interval
 type Live struct {
-	api      string
+	client  tzkt.ClientInterface
+	store   store.Store
+	baker   string
+	overlap float64
+	jitter  time.Duration
+	logger  *zerolog.Logger
+	metrics *metrics.Sync
+	// batchSize is the page size of the sync requests
+	batchSize int
+
+	maxErrors  int
+	maxBackoff time.Duration
+
+	// mu guards interval and ticker, which SetInterval
+	// updates while the sync goroutine runs, status and failures
+	mu       sync.Mutex
 	interval time.Duration
-	store    store.Store
+	ticker   *time.Ticker
+	status   Status
+	// failures is the number of consecutive failed syncs
+	failures int
 
 	ctx    context.Context
 	cancel context.CancelFunc
-	ticker *time.Ticker
 	last   time.Time
-	to     string
+	// to is the end of the synced range, see WithUntil, empty if unbounded
+	to    string
+	until time.Time
 
+	// trigger is received between two syncs only
+	trigger chan struct{}
 	stopped chan bool
 }
 
@@ -47,21 +79,89 @@ const dateFormat = "2006-01-02T15:04:05Z"
 var (
 	// ErrNoInterval is returned when the interval is not set
 	ErrNoInterval = errors.New("no interval")
+	// ErrInvalidOverlap is returned when the overlap is not between 0 and 1
+	ErrInvalidOverlap = errors.New("invalid overlap")
+	// ErrInvalidInterval is returned when the interval is negative,
+	// or shorter than MinInterval when set on a running syncer
+	ErrInvalidInterval = errors.New("invalid interval")
+	// ErrSyncComplete is returned by a live sync reaching the end
+	// of its range, the syncer then stops without error
+	ErrSyncComplete = errors.New("sync complete")
 )
 
+// storedLast returns the last stored delegation to the baker,
+// or to any baker if baker is empty
+func storedLast(ctx context.Context, s store.Store, baker string) (*tds.Delegation, error) {
+	if baker == "" {
+		return s.LastDelegation(ctx)
+	}
+	return storedOne(ctx, s, store.DelegationFilter{Baker: &baker, Limit: 1, SortOrder: store.SortDesc})
+}
+
+// storedFirst returns the first stored delegation to the baker,
+// or to any baker if baker is empty
+func storedFirst(ctx context.Context, s store.Store, baker string) (*tds.Delegation, error) {
+	if baker == "" {
+		return s.GetFirst(ctx)
+	}
+	return storedOne(ctx, s, store.DelegationFilter{Baker: &baker, Limit: 1, SortOrder: store.SortAsc})
+}
+
+// storedOne returns the first delegation matching f, or nil
+func storedOne(ctx context.Context, s store.Store, f store.DelegationFilter) (*tds.Delegation, error) {
+	ds, err := s.Query(ctx, f)
+	if err != nil || len(ds) == 0 {
+		return nil, err
+	}
+	return &ds[0], nil
+}
+
+// MinInterval keeps the live sync from hammering the tzkt api
+const MinInterval = 10 * time.Second
+
 // Sync will start syncing the delegations
 // It will sync the delegations every interval
 // and store them in the store
-// from is optional and will be used to start syncing from a specific date
+// from is optional and will be used to start syncing from a specific date,
+// it defaults to the last stored delegation, or now if the store is empty
 // Returns an error if the first sync sync fails
 func (l *Live) Sync(ctx context.Context, from string) error {
 	if l.interval == 0 {
 		return ErrNoInterval
 	}
+	if l.interval < 0 {
+		return fmt.Errorf("%w: %s is negative", ErrInvalidInterval, l.interval)
+	}
+	if l.overlap < 0 || l.overlap > 1 {
+		return fmt.Errorf("%w: %v", ErrInvalidOverlap, l.overlap)
+	}
+	if l.to != "" {
+		until, err := time.Parse(dateFormat, l.to)
+		if err != nil {
+			return err
+		}
+		l.until = until
+	}
+	if l.logger != nil {
+		ctx = l.logger.WithContext(ctx)
+	}
 	l.ctx, l.cancel = context.WithCancel(ctx)
+	l.mu.Lock()
 	l.ticker = time.NewTicker(l.interval)
+	ticker := l.ticker
+	l.mu.Unlock()
 	l.last = time.Now()
 
+	if from == "" {
+		// catch up on the delegations made while the service was down
+		storeLast, err := storedLast(ctx, l.store, l.baker)
+		if err != nil {
+			return fmt.Errorf("failed to get last delegation: %w", err)
+		}
+		if storeLast != nil {
+			from = storeLast.Timestamp
+		}
+	}
 	if from != "" {
 		last, err := time.Parse(dateFormat, from)
 		if err != nil {
@@ -73,20 +173,32 @@ func (l *Live) Sync(ctx context.Context, from string) error {
 	log.Ctx(ctx).Info().Str("from", l.last.Format(dateFormat)).Msg("start live sync")
 
 	err := l.sync()
+	if errors.Is(err, ErrSyncComplete) {
+		log.Ctx(ctx).Info().Str("to", l.to).Msg("live sync complete")
+		l.halt()
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	l.stopped = make(chan bool, 1)
 	go func() {
-		l.stopped = make(chan bool, 1)
 		defer func() { l.stopped <- true }()
 		for {
 			select {
-			case <-ctx.Done():
+			case <-l.ctx.Done():
 				return
-			case <-l.ticker.C:
-				err := l.sync()
-				if err != nil {
-					log.Ctx(ctx).Error().Err(err).Msg("failed to sync")
+			case <-ticker.C:
+				if !l.wait() {
+					return
+				}
+				if l.syncDone(ctx) {
+					return
+				}
+			case <-l.trigger:
+				log.Ctx(ctx).Info().Msg("manual sync")
+				if l.syncDone(ctx) {
+					return
 				}
 			}
 		}
@@ -94,13 +206,75 @@ func (l *Live) Sync(ctx context.Context, from string) error {
 	return nil
 }
 
+// syncDone syncs and logs the failure,
+// returns true once the end of the range is reached, the syncer is then halted
+func (l *Live) syncDone(ctx context.Context) bool {
+	err := l.sync()
+	if errors.Is(err, ErrSyncComplete) {
+		log.Ctx(ctx).Info().Str("to", l.to).Msg("live sync complete")
+		l.halt()
+		return true
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to sync")
+	}
+	return false
+}
+
+// wait sleeps a random duration up to the jitter,
+// returns false if the syncer is stopped meanwhile
+func (l *Live) wait() bool {
+	if l.jitter <= 0 {
+		return true
+	}
+	select {
+	case <-l.ctx.Done():
+		return false
+	case <-time.After(rand.N(l.jitter)):
+		return true
+	}
+}
+
+// SyncNow asks for an immediate sync without waiting for the next interval
+// The sync runs asynchronously, SyncNow is a no-op
+// if a sync is already in progress or the syncer is not running
+// Returns whether a sync was triggered
+func (l *Live) SyncNow() bool {
+	select {
+	case l.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetInterval changes the sync interval of a running syncer,
+// the next sync happens one new interval from now
+// The interval must be at least MinInterval
+func (l *Live) SetInterval(d time.Duration) error {
+	if d < MinInterval {
+		return fmt.Errorf("%w: %s is shorter than %s", ErrInvalidInterval, d, MinInterval)
+	}
+	l.setInterval(d)
+	return nil
+}
+
+func (l *Live) setInterval(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.interval = d
+	// Reset keeps the ticker channel the sync goroutine is waiting on
+	if l.ticker != nil {
+		l.ticker.Reset(backoffInterval(d, l.status.BackoffLevel, l.maxBackoff))
+	}
+}
+
 // Stop will stop the syncing
-func (l Live) Stop() {
+func (l *Live) Stop() {
 	if l.ctx == nil {
 		return
 	}
-	l.cancel()
-	l.ticker.Stop()
+	l.halt()
 
 	// Wait for the sync to stop
 	if l.stopped != nil {
@@ -109,30 +283,94 @@ func (l Live) Stop() {
 	}
 }
 
-func (l *Live) sync() error {
+// halt stops the syncing without waiting for the sync goroutine,
+// which may be the caller
+func (l *Live) halt() {
+	l.cancel()
+	l.mu.Lock()
+	l.ticker.Stop()
+	l.mu.Unlock()
+}
+
+// sync fetches and stores the delegations made since the last sync,
+// paging through them so a long downtime is caught up in full
+// Returns ErrSyncComplete once they are stored up to the end of the range
+func (l *Live) sync() (err error) {
+	var fetched int
+	defer func() {
+		failure := err
+		if errors.Is(err, ErrSyncComplete) {
+			failure = nil
+		}
+		l.record(fetched, failure)
+		if failure != nil {
+			l.metrics.Error(metrics.Live)
+		} else {
+			l.metrics.LiveCycle(fetched)
+		}
+	}()
+
 	log.Ctx(l.ctx).Debug().Msg("sync live")
-	delegations, err := getDelegations(l.ctx, l.api, getOpts{
-		// Get delegations from the last interval with 20% overlap
-		TsGe: l.last.Add(-(l.interval / 5)).Format(dateFormat),
-		TsLt: l.to,
-	})
-	if err != nil {
-		return err
-	}
+	now := time.Now()
+	// Get delegations from the last interval with some overlap
+	from := l.last.Add(-l.overlapDuration()).Format(dateFormat)
+	for offset := 0; ; offset += l.batchSize {
+		start := time.Now()
+		page, err := l.client.GetDelegationsPage(l.ctx, tzkt.DelegationOpts{
+			TsGe:   from,
+			TsLt:   l.to,
+			Limit:  l.batchSize,
+			Offset: offset,
+			Baker:  l.baker,
+		})
+		l.metrics.APIRequest(apiDelegations, start)
+		if err != nil {
+			return err
+		}
+		delegations := page.Delegations
+		fetched += len(delegations)
 
-	l.last = time.Now()
+		if len(delegations) > 0 {
+			log.Ctx(l.ctx).Debug().Int("delegations", len(delegations)).Int("offset", offset).Msg("insert delegations")
+			if err = l.store.Insert(l.ctx, delegations); err != nil {
+				return err
+			}
+		}
+		// No more delegations, the skipped rows count toward a full page
+		if page.Rows < l.batchSize {
+			break
+		}
+	}
 
-	if len(delegations) == 0 {
-		return nil
+	l.last = now
+	// the last sync fetched every delegation made before to
+	if l.to != "" && l.last.After(l.until) {
+		return ErrSyncComplete
 	}
-	log.Ctx(l.ctx).Debug().Int("delegations", len(delegations)).Msg("insert delegations")
-	return l.store.Insert(l.ctx, delegations)
+	return nil
+}
+
+// overlapDuration returns the part of the interval fetched again by each sync
+func (l *Live) overlapDuration() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Duration(float64(l.interval) * l.overlap)
 }
 
 // History will sync the delegations inside a given time range
 type History struct {
-	api   string
-	store store.Store
+	client  tzkt.ClientInterface
+	store   store.Store
+	chunk   time.Duration
+	baker   string
+	dryRun  *dryRunStore
+	every   int
+	reverse bool
+	// batchSize is the limit of each delegations request
+	batchSize int
+	gaps      *gapDetector
+	logger    *zerolog.Logger
+	metrics   *metrics.Sync
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -141,13 +379,41 @@ type History struct {
 }
 
 // NewHistory creates a new history syncer
-// It will sync the delegations from the given url
+// It will sync the delegations from the tzkt api
 // and store them in the given store
-func NewHistory(api string, s store.Store) *History {
-	return &History{
-		api:   api,
-		store: s,
+func NewHistory(s store.Store, opts ...Option) *History {
+	o := newOptions(opts)
+	h := &History{
+		client:    o.client,
+		logger:    o.logger,
+		store:     s,
+		chunk:     o.chunkDuration,
+		baker:     o.baker,
+		every:     o.progressEvery,
+		reverse:   o.reverse,
+		batchSize: o.batchSize,
+		gaps:      &gapDetector{threshold: int64(o.gapThreshold), reverse: o.reverse},
+		metrics:   o.metrics,
+	}
+	if o.dryRun {
+		h.dryRun = &dryRunStore{Store: s}
+		h.store = h.dryRun
+	}
+	return h
+}
+
+// DryRunCount returns the number of delegations
+// that would have been inserted in dry run mode
+func (h *History) DryRunCount() int64 {
+	if h.dryRun == nil {
+		return 0
 	}
+	return h.dryRun.count.Load()
+}
+
+// Gaps returns the level gaps found between the batches of the last sync
+func (h *History) Gaps() []GapReport {
+	return h.gaps.report()
 }
 
 // First delegation event from tzkt's API
@@ -169,17 +435,40 @@ func (h *History) Stop() {
 
 // Sync will start syncing the delegations
 // from and to are optional and will be used to filter the delegations
+// without from, the sync resumes from the last stored delegation
+// and also fetches the history missing before the first stored one
 // returns the timestamp of the last delegation
 // dates should be in RFC3339 format
-func (h *History) Sync(ctx context.Context, from, to string) error {
+func (h *History) Sync(ctx context.Context, from, to string) (err error) {
+	defer func() {
+		if err != nil {
+			h.metrics.Error(metrics.History)
+		}
+	}()
+	if h.logger != nil {
+		ctx = h.logger.WithContext(ctx)
+	}
+	h.gaps.clear()
+	defer func() {
+		if gaps := h.gaps.report(); len(gaps) > 0 {
+			log.Ctx(ctx).Warn().Int("gaps", len(gaps)).Msg("history sync found level gaps, some delegations may be missing")
+		}
+	}()
+
+	// end of the history missing before the first stored delegation
+	var gap string
 	if from == "" {
 		log.Ctx(ctx).Debug().Msg("no start date provided")
-		storeLast, err := h.store.LastDelegation(ctx)
+		storeLast, err := storedLast(ctx, h.store, h.baker)
 		if err != nil {
 			return fmt.Errorf("failed to get last delegation: %w", err)
 		}
 		if storeLast != nil {
 			from = storeLast.Timestamp
+			gap, err = h.gap(ctx)
+			if err != nil {
+				return err
+			}
 		} else {
 			from = firstDelegation
 		}
@@ -191,11 +480,68 @@ func (h *History) Sync(ctx context.Context, from, to string) error {
 		log.Ctx(ctx).Debug().Str("to", to).Msg("new end date")
 	}
 
-	log.Ctx(ctx).Info().Str("from", from).Str("to", to).Msg("sync history")
+	covered, err := h.covers(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	if covered && gap == "" {
+		log.Ctx(ctx).Info().Str("from", from).Str("to", to).Msg("store already covers the history, skip sync")
+		return nil
+	}
 
 	h.stopped = make(chan bool, 1)
 	defer func() { h.stopped <- true }()
 
+	// the reverse order syncs the most recent range first
+	if gap != "" && !h.reverse {
+		err = h.syncGap(ctx, gap)
+		if err != nil || covered {
+			return err
+		}
+	}
+	if !covered {
+		log.Ctx(ctx).Info().Str("from", from).Str("to", to).Bool("reverse", h.reverse).Msg("sync history")
+		err = h.syncRange(ctx, from, to)
+		if err != nil || gap == "" || !h.reverse {
+			return err
+		}
+	}
+	return h.syncGap(ctx, gap)
+}
+
+// syncGap fetches and stores the history before the first stored delegation
+func (h *History) syncGap(ctx context.Context, gap string) error {
+	log.Ctx(ctx).Info().Str("from", firstDelegation).Str("to", gap).Bool("reverse", h.reverse).Msg("sync history before the first stored delegation")
+	return h.syncRange(ctx, firstDelegation, gap)
+}
+
+// gap returns the timestamp of the first stored delegation
+// if the history before it is missing, an empty string otherwise
+func (h *History) gap(ctx context.Context) (string, error) {
+	first, err := storedFirst(ctx, h.store, h.baker)
+	if err != nil {
+		return "", fmt.Errorf("failed to get first delegation: %w", err)
+	}
+	if first == nil || first.Timestamp <= firstDelegation {
+		return "", nil
+	}
+	return first.Timestamp, nil
+}
+
+// syncRange fetches and stores the delegations between from and to
+func (h *History) syncRange(ctx context.Context, from, to string) error {
+	p := newProgress(h.every, from, to)
+	p.reverse = h.reverse
+	h.gaps.reset()
+	switch {
+	case h.chunk > 0 && h.reverse:
+		return h.syncChunksReverse(ctx, from, to, p)
+	case h.chunk > 0:
+		return h.syncChunks(ctx, from, to, p)
+	case h.reverse:
+		return h.syncRangeReverse(ctx, from, to, p)
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -209,119 +555,242 @@ func (h *History) Sync(ctx context.Context, from, to string) error {
 		}
 		// No more delegations
 		if last == "" || last > to {
+			p.done(ctx, to, true)
 			return nil
 		}
+		p.done(ctx, last, false)
 		from = last
 	}
 }
 
-func (h *History) batch(ctx context.Context, from, to string) (string, error) {
-	delegations, err := getDelegations(ctx, h.api, getOpts{
-		TsGe:  from,
-		TsLt:  to,
-		Limit: 10000,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to get delegations: %w", err)
+// syncRangeReverse fetches and stores the delegations between from and to,
+// from the most recent ones back to from
+func (h *History) syncRangeReverse(ctx context.Context, from, to string, p *progress) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+		log.Ctx(ctx).Debug().Str("from", from).Str("to", to).Msg("new batch")
+		oldest, err := h.batch(ctx, from, to)
+		if err != nil {
+			return err
+		}
+		// No more delegations
+		if oldest == "" {
+			p.done(ctx, from, true)
+			return nil
+		}
+		p.done(ctx, oldest, false)
+
+		// timestamp.lt excludes the oldest timestamp, a second later
+		// fetches again its delegations that didn't fit in the batch
+		t, err := time.Parse(dateFormat, oldest)
+		if err != nil {
+			return err
+		}
+		to = t.Add(time.Second).Format(dateFormat)
 	}
+}
 
-	err = h.store.Insert(ctx, delegations)
+// covers reports whether the store already holds
+// every delegation between from and to
+func (h *History) covers(ctx context.Context, from, to string) (bool, error) {
+	first, err := storedFirst(ctx, h.store, h.baker)
 	if err != nil {
-		return "", fmt.Errorf("failed to insert delegations: %w", err)
+		return false, fmt.Errorf("failed to get first delegation: %w", err)
 	}
-
-	// No more delegations
-	if len(delegations) < 10000 {
-		return "", nil
+	if first == nil || first.Timestamp > from {
+		return false, nil
 	}
-
-	return delegations[len(delegations)-1].Timestamp, nil
+	last, err := storedLast(ctx, h.store, h.baker)
+	if err != nil {
+		return false, fmt.Errorf("failed to get last delegation: %w", err)
+	}
+	return last != nil && last.Timestamp >= to, nil
 }
 
-type getOpts struct {
-	TsGe  string
-	TsLt  string
-	Limit int
-}
+// batch fetches and stores the delegations starting at from,
+// or ending at to in reverse order
+// returns the timestamp to start the next batch from
+// (to end it at in reverse order)
+// or an empty string if there are no more delegations
+func (h *History) batch(ctx context.Context, from, to string) (string, error) {
+	for offset := 0; ; offset += h.batchSize {
+		page, err := h.page(ctx, from, to, offset)
+		if err != nil {
+			return "", err
+		}
 
-var (
-	// ErrInvalidStatusCode is returned when the status code is 300 or higher
-	ErrInvalidStatusCode = errors.New("invalid status code")
-)
+		// No more delegations, the skipped rows count toward a full page
+		if page.Rows < h.batchSize {
+			return "", nil
+		}
 
-func getDelegations(ctx context.Context, url string, opts getOpts) ([]tds.Delegation, error) {
-	req, err := http.NewRequestWithContext(
-		ctx,
-		"GET",
-		url,
-		nil,
-	)
-	if err != nil {
-		return nil, err
+		// A full batch sharing a single timestamp, or made of skipped rows only,
+		// can't move the window, page through it instead
+		delegations := page.Delegations
+		if len(delegations) == 0 {
+			continue
+		}
+		first, last := delegations[0].Timestamp, delegations[len(delegations)-1].Timestamp
+		if first != last {
+			return last, nil
+		}
+		log.Ctx(ctx).Debug().Str("timestamp", last).Int("offset", offset).Msg("full batch on a single timestamp")
 	}
+}
 
-	q := req.URL.Query()
-	q.Add("select", "timestamp,sender,amount,level,id")
-	if opts.TsGe != "" {
-		q.Add("timestamp.ge", opts.TsGe)
-	}
-	if opts.TsLt != "" {
-		q.Add("timestamp.lt", opts.TsLt)
+// syncChunks fetches and stores the delegations between from and to
+// one time slice of h.chunk at a time
+func (h *History) syncChunks(ctx context.Context, from, to string, p *progress) error {
+	start, err := time.Parse(dateFormat, from)
+	if err != nil {
+		return err
 	}
-	if opts.Limit > 0 {
-		q.Add("limit", strconv.Itoa(opts.Limit))
+	end, err := time.Parse(dateFormat, to)
+	if err != nil {
+		return err
 	}
-	req.URL.RawQuery = q.Encode()
 
-	client := http.Client{
-		Timeout: 2 * time.Second,
+	for start.Before(end) {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+		// align the slices on multiples of the chunk duration
+		next := start.Truncate(h.chunk).Add(h.chunk)
+		if next.After(end) {
+			next = end
+		}
+		count, err := h.chunkBatch(ctx, start.Format(dateFormat), next.Format(dateFormat))
+		if err != nil {
+			return err
+		}
+		log.Ctx(ctx).Debug().
+			Str("from", start.Format(dateFormat)).
+			Str("to", next.Format(dateFormat)).
+			Int("delegations", count).
+			Msg("chunk synced")
+		p.done(ctx, next.Format(dateFormat), !next.Before(end))
+		start = next
 	}
+	return nil
+}
 
-	resp, err := client.Do(req)
+// syncChunksReverse fetches and stores the delegations between from and to
+// one time slice of h.chunk at a time, from the most recent slice back to from
+func (h *History) syncChunksReverse(ctx context.Context, from, to string, p *progress) error {
+	start, err := time.Parse(dateFormat, from)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%w : %d", ErrInvalidStatusCode, resp.StatusCode)
+	end, err := time.Parse(dateFormat, to)
+	if err != nil {
+		return err
 	}
 
-	return decodeDelegations(resp.Body, opts.Limit)
+	for end.After(start) {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+		// align the slices on multiples of the chunk duration
+		prev := end.Add(-time.Nanosecond).Truncate(h.chunk)
+		if prev.Before(start) {
+			prev = start
+		}
+		count, err := h.chunkBatch(ctx, prev.Format(dateFormat), end.Format(dateFormat))
+		if err != nil {
+			return err
+		}
+		log.Ctx(ctx).Debug().
+			Str("from", prev.Format(dateFormat)).
+			Str("to", end.Format(dateFormat)).
+			Int("delegations", count).
+			Msg("chunk synced")
+		p.done(ctx, prev.Format(dateFormat), !prev.After(start))
+		end = prev
+	}
+	return nil
 }
 
-type responseDelegation struct {
-	Timestamp string `json:"timestamp"`
-	Sender    struct {
-		Address string `json:"address"`
-	} `json:"sender"`
-	Amount int `json:"amount"`
-	Level  int `json:"level"`
-	ID     int `json:"id"`
+// chunkBatch fetches and stores every delegation between from and to
+// paging with offsets, returns the number of delegations fetched
+func (h *History) chunkBatch(ctx context.Context, from, to string) (int, error) {
+	count := 0
+	for offset := 0; ; offset += h.batchSize {
+		page, err := h.page(ctx, from, to, offset)
+		if err != nil {
+			return count, err
+		}
+		count += len(page.Delegations)
+
+		// the skipped rows count toward a full page
+		if page.Rows < h.batchSize {
+			return count, nil
+		}
+	}
 }
 
-// capacity is used to preallocate the slice
-// to avoid reallocations
-func decodeDelegations(raw io.Reader, capacity int) ([]tds.Delegation, error) {
-	var delegations = make([]tds.Delegation, 0, capacity)
-	dec := json.NewDecoder(raw)
+// apiDelegations labels the duration of the tzkt delegations requests
+const apiDelegations = "delegations"
+
+// page fetches and stores the page of delegations between from and to
+// starting at offset, and warns about the fetched delegations already stored
+func (h *History) page(ctx context.Context, from, to string, offset int) (tzkt.Page, error) {
+	start := time.Now()
+	page, err := h.client.GetDelegationsPage(ctx, tzkt.DelegationOpts{
+		TsGe:     from,
+		TsLt:     to,
+		Limit:    h.batchSize,
+		Offset:   offset,
+		Baker:    h.baker,
+		SortDesc: h.reverse,
+	})
+	h.metrics.APIRequest(apiDelegations, start)
+	if err != nil {
+		return tzkt.Page{}, fmt.Errorf("failed to get delegations: %w", err)
+	}
+	delegations := page.Delegations
 
-	// read open bracket
-	_, err := dec.Token()
+	inserted, err := h.store.InsertCount(ctx, delegations)
 	if err != nil {
-		return nil, err
+		return tzkt.Page{}, fmt.Errorf("failed to insert delegations: %w", err)
 	}
-	for dec.More() {
-		var d responseDelegation
-		if err := dec.Decode(&d); err != nil {
-			return nil, err
-		}
-		delegations = append(delegations, tds.Delegation{
-			Timestamp: d.Timestamp,
-			Delegator: d.Sender.Address,
-			Amount:    strconv.Itoa(d.Amount),
-			Level:     strconv.Itoa(d.Level),
-			ID:        strconv.Itoa(d.ID),
-		})
+	h.metrics.HistoryBatch(len(delegations))
+	h.gaps.check(ctx, delegations)
+
+	// the first page starts with the delegations of from,
+	// or of the second before to in reverse order,
+	// already stored by the previous batch
+	boundary := from
+	if h.reverse {
+		boundary = ""
+		if t, err := time.Parse(dateFormat, to); err == nil {
+			boundary = t.Add(-time.Second).Format(dateFormat)
+		}
+	}
+	expected := 0
+	if offset == 0 {
+		for _, d := range delegations {
+			if d.Timestamp == boundary {
+				expected++
+			}
+		}
+	}
+	if duplicates := int64(len(delegations)) - inserted - int64(expected); duplicates > 0 {
+		log.Ctx(ctx).Warn().
+			Str("from", from).
+			Str("to", to).
+			Int("offset", offset).
+			Int("fetched", len(delegations)).
+			Int64("inserted", inserted).
+			Int64("duplicates", duplicates).
+			Msg("duplicate delegations in api response")
 	}
-	return delegations, nil
+	return page, nil
 }
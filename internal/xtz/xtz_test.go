@@ -1,22 +1,25 @@
 package xtz
 
 import (
+	"bytes"
 	"context"
 	"net/http"
-	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	tds "github.com/frieeze/tezos-delegation"
+	"github.com/frieeze/tezos-delegation/internal/store"
+	"github.com/frieeze/tezos-delegation/internal/tzkt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 var (
-	response = `
-[{"timestamp":"2024-10-29T10:22:25Z","sender":{"address":"tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms"},"amount":13814013,"level":6976378,"id":1401626186219520},{"timestamp":"2024-10-29T10:10:00Z","sender":{"address":"tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP"},"amount":2548493,"level":6976305,"id":1401610442899456},{"timestamp":"2024-10-29T10:09:00Z","sender":{"address":"tz29LqGEjCrSR1HFhzMoujZvXi5Rgdhxe7mP"},"amount":2548751,"level":6976299,"id":1401609161539584}]
-	`
 	expected = []tds.Delegation{
 		{
 			Timestamp: "2024-10-29T10:22:25Z",
@@ -42,84 +45,11 @@ var (
 	}
 )
 
-func Test_decodeDelegations_ok(t *testing.T) {
-	reader := strings.NewReader(response)
-	ds, err := decodeDelegations(reader, 3)
-	assert.NoError(t, err)
-	assert.ElementsMatch(t, expected, ds)
-}
-
-func Test_decodeDelegations_error_BadJSON(t *testing.T) {
-	reader := strings.NewReader(`[{"timestamp":"2024-10-29T10:22:25Z","sender":{"address":`)
-	_, err := decodeDelegations(reader, 1)
-	assert.Error(t, err)
-}
-
-func httpTestServer(response string, code int, reqTests func(r *http.Request)) *httptest.Server {
-	serv := httptest.NewServer(
-		http.HandlerFunc(
-			func(w http.ResponseWriter, r *http.Request) {
-				if reqTests != nil {
-					reqTests(r)
-				}
-				w.WriteHeader(code)
-				w.Write([]byte(response))
-			}))
-	return serv
-}
-
-func Test_getDelegations_ok(t *testing.T) {
-	serv := httpTestServer(response, 200, func(r *http.Request) {
-		assert.Equal(t, "GET", r.Method)
-		assert.Equal(t, "timestamp,sender,amount,level,id", r.URL.Query().Get("select"))
-		assert.Empty(t, r.URL.Query().Get("timestamp.ge"))
-		assert.Empty(t, r.URL.Query().Get("timestamp.lt"))
-		assert.Empty(t, r.URL.Query().Get("limit"))
-	})
-	defer serv.Close()
-	ds, err := getDelegations(context.Background(), serv.URL, getOpts{})
-	assert.NoError(t, err)
-	assert.ElementsMatch(t, expected, ds)
-}
-
-func Test_getDelegation_Params(t *testing.T) {
-	var (
-		date = "2024-10-29T10:22:25Z"
-	)
-
-	serv := httpTestServer("[]", 200, func(r *http.Request) {
-		assert.Equal(t, "GET", r.Method)
-		assert.Equal(t, "timestamp,sender,amount,level,id", r.URL.Query().Get("select"))
-		assert.Equal(t, date, r.URL.Query().Get("timestamp.ge"))
-		assert.Equal(t, date, r.URL.Query().Get("timestamp.lt"))
-		assert.Equal(t, "1000", r.URL.Query().Get("limit"))
-	})
-	defer serv.Close()
-
-	opts := getOpts{
-		TsGe:  date,
-		TsLt:  date,
-		Limit: 1000,
-	}
-	del, err := getDelegations(context.Background(), serv.URL, opts)
-	assert.NoError(t, err)
-	assert.Empty(t, del)
-}
-
-func Test_getDelegations_error_HttpCode(t *testing.T) {
-	serv := httpTestServer(response, 400, nil)
-	defer serv.Close()
-	_, err := getDelegations(context.Background(), serv.URL, getOpts{})
-	assert.ErrorIs(t, err, ErrInvalidStatusCode)
-}
-
-func Test_getDelegations_error_BadURL(t *testing.T) {
-	_, err := getDelegations(context.Background(), "", getOpts{})
-	assert.Error(t, err)
-}
-
+// mockStore mocks the store methods used by the syncers,
+// calling any other method panics.
 type mockStore struct {
 	mock.Mock
+	store.Store
 }
 
 func (m *mockStore) Insert(ctx context.Context, ds []tds.Delegation) error {
@@ -127,9 +57,14 @@ func (m *mockStore) Insert(ctx context.Context, ds []tds.Delegation) error {
 	return args.Error(0)
 }
 
-func (m *mockStore) GetByYear(ctx context.Context, year string) ([]tds.Delegation, error) {
+func (m *mockStore) InsertCount(ctx context.Context, ds []tds.Delegation) (int64, error) {
+	args := m.Called(ctx, ds)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockStore) GetByYear(ctx context.Context, year string) (tds.DelegationSlice, error) {
 	args := m.Called(ctx, year)
-	return args.Get(0).([]tds.Delegation), args.Error(1)
+	return args.Get(0).(tds.DelegationSlice), args.Error(1)
 }
 
 func (m *mockStore) LastDelegation(ctx context.Context) (*tds.Delegation, error) {
@@ -140,6 +75,24 @@ func (m *mockStore) LastDelegation(ctx context.Context) (*tds.Delegation, error)
 	return args.Get(0).(*tds.Delegation), args.Error(1)
 }
 
+func (m *mockStore) GetFirst(ctx context.Context) (*tds.Delegation, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*tds.Delegation), args.Error(1)
+}
+
+func (m *mockStore) Query(ctx context.Context, f store.DelegationFilter) (tds.DelegationSlice, error) {
+	args := m.Called(ctx, f)
+	return args.Get(0).(tds.DelegationSlice), args.Error(1)
+}
+
+func (m *mockStore) CountByDateRange(ctx context.Context, from, to string) (int64, error) {
+	args := m.Called(ctx, from, to)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func (m *mockStore) Empty(ctx context.Context) error {
 	args := m.Called(ctx)
 	return args.Error(0)
@@ -152,19 +105,39 @@ func (m *mockStore) Close() error {
 
 func Test_NewLive(t *testing.T) {
 	storage := &mockStore{}
-	l := NewLive("", 10*time.Second, storage)
+	l := NewLive(storage, WithInterval(10*time.Second))
 	assert.NotNil(t, l)
-	assert.Empty(t, l.api)
+	assert.IsType(t, &tzkt.Client{}, l.client)
 	assert.Equal(t, 10*time.Second, l.interval)
 	assert.Equal(t, storage, l.store)
+
+	client := &tzkt.MockClient{}
+	l = NewLive(storage, WithInterval(10*time.Second), WithClient(client))
+	assert.Equal(t, client, l.client)
+
+	logger := zerolog.Nop()
+	l = NewLive(storage, WithAPI("http://localhost"), WithHTTPClient(http.DefaultClient), WithJitter(time.Second), WithLogger(logger))
+	assert.IsType(t, &tzkt.Client{}, l.client)
+	assert.Zero(t, l.interval)
+	assert.Equal(t, time.Second, l.jitter)
+	assert.Equal(t, &logger, l.logger)
+}
+
+func Test_Live_wait(t *testing.T) {
+	s := NewLive(&mockStore{}, WithInterval(time.Minute))
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	assert.True(t, s.wait())
+
+	s.jitter = time.Hour
+	s.cancel()
+	assert.False(t, s.wait())
 }
 
 func Test_Live_sync(t *testing.T) {
 	storage := &mockStore{}
-	serv := httpTestServer(response, 200, nil)
-	defer serv.Close()
+	client := &tzkt.MockClient{Delegations: expected}
 
-	s := NewLive(serv.URL, 0, storage)
+	s := NewLive(storage, WithClient(client))
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 	defer s.cancel()
 
@@ -174,31 +147,45 @@ func Test_Live_sync(t *testing.T) {
 	assert.NoError(t, err)
 
 	// No new delegations
-	serv = httpTestServer("[]", 200, nil)
-	s.api = serv.URL
+	client.Delegations = []tds.Delegation{}
 
 	err = s.sync()
 	assert.NoError(t, err)
+	assert.Len(t, client.Calls(), 2)
 
 	storage.AssertExpectations(t)
 }
 
+func Test_Live_sync_baker(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: []tds.Delegation{}}
+
+	s := NewLive(storage, WithInterval(time.Minute), WithClient(client), WithBaker("tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB"))
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+
+	err := s.sync()
+	assert.NoError(t, err)
+	if calls := client.Calls(); assert.Len(t, calls, 1) {
+		assert.Equal(t, "tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB", calls[0].Baker)
+	}
+}
+
 func Test_Live_sync_error(t *testing.T) {
 	storage := &mockStore{}
-	serv := httpTestServer("", 400, nil)
-	defer serv.Close()
+	client := &tzkt.MockClient{Err: tzkt.ErrInvalidStatusCode}
 
-	s := NewLive(serv.URL, 0, storage)
+	s := NewLive(storage, WithClient(client))
 	s.ctx, s.cancel = context.WithCancel(context.Background())
 	defer s.cancel()
 
 	err := s.sync()
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, tzkt.ErrInvalidStatusCode)
 
 	storage.On("Insert", mock.Anything, expected).Return(assert.AnError)
 
-	serv = httpTestServer(response, 200, nil)
-	s.api = serv.URL
+	client.Err = nil
+	client.Delegations = expected
 
 	err = s.sync()
 	assert.ErrorIs(t, err, assert.AnError)
@@ -208,12 +195,12 @@ func Test_Live_sync_error(t *testing.T) {
 
 func Test_Live_Sync(t *testing.T) {
 	storage := &mockStore{}
-	serv := httpTestServer(response, 200, nil)
-	defer serv.Close()
+	client := &tzkt.MockClient{Delegations: expected}
 
-	s := NewLive(serv.URL, 0, storage)
+	s := NewLive(storage, WithClient(client))
 
 	storage.On("Insert", mock.Anything, expected).Return(nil)
+	storage.On("LastDelegation", mock.Anything).Return(nil, nil)
 
 	err := s.Sync(context.Background(), "")
 	assert.ErrorIs(t, err, ErrNoInterval)
@@ -230,12 +217,180 @@ func Test_Live_Sync(t *testing.T) {
 	storage.AssertExpectations(t)
 }
 
+func Test_Live_SyncNow(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: []tds.Delegation{}}
+
+	s := NewLive(storage, WithInterval(time.Hour), WithClient(client))
+	assert.False(t, s.SyncNow(), "not running")
+	storage.On("LastDelegation", mock.Anything).Return(nil, nil)
+
+	err := s.Sync(context.Background(), "")
+	assert.NoError(t, err)
+	defer s.Stop()
+	assert.Len(t, client.Calls(), 1)
+
+	// the sync goroutine may not be listening yet
+	assert.Eventually(t, s.SyncNow, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return len(client.Calls()) == 2 }, time.Second, time.Millisecond)
+}
+
+func Test_Live_Sync_lastDelegation(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: []tds.Delegation{}}
+
+	// without history sync, the live syncer catches up from the last stored delegation
+	s := NewLive(storage, WithInterval(time.Minute), WithClient(client), WithOverlap(0))
+	storage.On("LastDelegation", mock.Anything).Return(&tds.Delegation{Timestamp: "2024-10-29T10:22:25Z"}, nil)
+
+	err := s.Sync(context.Background(), "")
+	assert.NoError(t, err)
+	defer s.Stop()
+
+	if calls := client.Calls(); assert.Len(t, calls, 1) {
+		assert.Equal(t, "2024-10-29T10:22:25Z", calls[0].TsGe)
+	}
+	storage.AssertExpectations(t)
+}
+
+func Test_Live_Sync_lastDelegation_pages(t *testing.T) {
+	storage := &mockStore{}
+	records := make([]tds.Delegation, 7)
+	for i := range records {
+		records[i] = tds.Delegation{Timestamp: "2024-10-29T10:22:25Z", Level: strconv.Itoa(i + 1), ID: strconv.Itoa(i)}
+	}
+	client := &tzkt.MockClient{
+		DelegationsFunc: func(opts tzkt.DelegationOpts) ([]tds.Delegation, error) {
+			start := min(opts.Offset, len(records))
+			return records[start:min(start+opts.Limit, len(records))], nil
+		},
+	}
+
+	// the catch-up after a long downtime spans more than one page
+	s := NewLive(storage, WithInterval(time.Minute), WithClient(client), WithOverlap(0))
+	s.batchSize = 3
+	storage.On("LastDelegation", mock.Anything).Return(&tds.Delegation{Timestamp: "2024-10-29T10:22:25Z"}, nil)
+	storage.On("Insert", mock.Anything, records[0:3]).Return(nil).Once()
+	storage.On("Insert", mock.Anything, records[3:6]).Return(nil).Once()
+	storage.On("Insert", mock.Anything, records[6:7]).Return(nil).Once()
+
+	err := s.Sync(context.Background(), "")
+	assert.NoError(t, err)
+	defer s.Stop()
+
+	calls := client.Calls()
+	if assert.Len(t, calls, 3) {
+		for i, c := range calls {
+			assert.Equal(t, "2024-10-29T10:22:25Z", c.TsGe)
+			assert.Equal(t, 3, c.Limit)
+			assert.Equal(t, i*3, c.Offset)
+		}
+	}
+	assert.Equal(t, int64(len(records)), s.Status().Fetched)
+	storage.AssertExpectations(t)
+}
+
+func Test_Live_Sync_lastDelegation_error(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{}
+
+	s := NewLive(storage, WithInterval(time.Minute), WithClient(client))
+	storage.On("LastDelegation", mock.Anything).Return(nil, assert.AnError)
+
+	err := s.Sync(context.Background(), "")
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Empty(t, client.Calls())
+}
+
+func Test_Live_SetInterval(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: []tds.Delegation{}}
+
+	s := NewLive(storage, WithInterval(time.Hour), WithClient(client))
+	storage.On("LastDelegation", mock.Anything).Return(nil, nil)
+
+	err := s.Sync(context.Background(), "")
+	assert.NoError(t, err)
+	defer s.Stop()
+	assert.Len(t, client.Calls(), 1)
+
+	assert.ErrorIs(t, s.SetInterval(time.Second), ErrInvalidInterval)
+	assert.NoError(t, s.SetInterval(MinInterval))
+
+	// bypass MinInterval to see the ticker fire at the new pace
+	s.setInterval(10 * time.Millisecond)
+	assert.Eventually(t, func() bool { return len(client.Calls()) >= 3 }, time.Second, time.Millisecond)
+}
+
+func Test_Live_Status(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: expected}
+
+	s := NewLive(storage, WithInterval(time.Minute), WithClient(client))
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+	storage.On("Insert", mock.Anything, expected).Return(nil)
+
+	assert.NoError(t, s.sync())
+	client.Err = tzkt.ErrInvalidStatusCode
+	assert.Error(t, s.sync())
+
+	status := s.Status()
+	assert.Equal(t, "1m0s", status.Interval)
+	assert.Equal(t, int64(2), status.Syncs)
+	assert.Equal(t, int64(1), status.Errors)
+	assert.Equal(t, int64(len(expected)), status.Fetched)
+	assert.Contains(t, status.LastError, "invalid status code")
+	assert.False(t, status.LastSync.IsZero())
+}
+
+func Test_backoffInterval(t *testing.T) {
+	for _, tt := range []struct {
+		interval time.Duration
+		level    int
+		want     time.Duration
+	}{
+		{interval: time.Minute, level: 0, want: time.Minute},
+		{interval: time.Minute, level: 1, want: 2 * time.Minute},
+		{interval: time.Minute, level: 3, want: 8 * time.Minute},
+		{interval: time.Minute, level: 6, want: time.Hour},
+		{interval: time.Minute, level: 1000, want: time.Hour},
+		// the cap never shortens the interval
+		{interval: 2 * time.Hour, level: 1, want: 2 * time.Hour},
+	} {
+		assert.Equal(t, tt.want, backoffInterval(tt.interval, tt.level, time.Hour), "%s, %d", tt.interval, tt.level)
+	}
+}
+
+func Test_Live_backoff(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Err: tzkt.ErrInvalidStatusCode}
+
+	s := NewLive(storage, WithInterval(time.Minute), WithClient(client), WithMaxErrors(2))
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+	s.ticker = time.NewTicker(time.Minute)
+	defer s.ticker.Stop()
+
+	var levels []int
+	for range 4 {
+		assert.Error(t, s.sync())
+		levels = append(levels, s.Status().BackoffLevel)
+	}
+	assert.Equal(t, []int{0, 0, 1, 2}, levels)
+
+	// the configured interval is restored by a successful sync
+	client.Err = nil
+	assert.NoError(t, s.sync())
+	assert.Zero(t, s.Status().BackoffLevel)
+	assert.Equal(t, "1m0s", s.Status().Interval)
+}
+
 func Test_Live_Sync_date(t *testing.T) {
 	storage := &mockStore{}
-	serv := httpTestServer(response, 400, nil)
-	defer serv.Close()
+	client := &tzkt.MockClient{Err: tzkt.ErrInvalidStatusCode}
 
-	s := NewLive(serv.URL, time.Minute, storage)
+	s := NewLive(storage, WithInterval(time.Minute), WithClient(client))
 
 	date := "2024-10-29T10:22:25Z"
 	err := s.Sync(context.Background(), date)
@@ -249,14 +404,55 @@ func Test_Live_Sync_date(t *testing.T) {
 	storage.AssertExpectations(t)
 }
 
+func Test_Live_Sync_until(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: expected}
+	storage.On("Insert", mock.Anything, expected).Return(nil)
+
+	// the range already ended, the first sync is the last one
+	to := "2024-10-29T10:30:00Z"
+	s := NewLive(storage, WithInterval(time.Minute), WithClient(client), WithUntil(to))
+	err := s.Sync(context.Background(), "2024-10-29T10:00:00Z")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, s.ctx.Err(), context.Canceled)
+	s.Stop()
+
+	if calls := client.Calls(); assert.Len(t, calls, 1) {
+		assert.Equal(t, to, calls[0].TsLt)
+	}
+	assert.Zero(t, s.Status().Errors)
+	storage.AssertExpectations(t)
+
+	s = NewLive(storage, WithInterval(time.Minute), WithClient(client), WithUntil("tomorrow"))
+	assert.Error(t, s.Sync(context.Background(), "2024-10-29T10:00:00Z"))
+}
+
+func Test_Live_Sync_until_running(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: []tds.Delegation{}}
+	storage.On("LastDelegation", mock.Anything).Return(nil, nil)
+
+	to := time.Now().Add(time.Second).UTC().Format(dateFormat)
+	s := NewLive(storage, WithInterval(50*time.Millisecond), WithClient(client), WithUntil(to))
+	err := s.Sync(context.Background(), "")
+	assert.NoError(t, err)
+
+	// the syncer stops by itself once to is passed
+	assert.Eventually(t, func() bool { return s.ctx.Err() != nil }, 3*time.Second, 10*time.Millisecond)
+	calls := len(client.Calls())
+	assert.Greater(t, calls, 1)
+	s.Stop()
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, client.Calls(), calls)
+}
+
 func Test_History_batch(t *testing.T) {
 	storage := &mockStore{}
-	serv := httpTestServer(response, 200, nil)
-	defer serv.Close()
+	client := &tzkt.MockClient{Delegations: expected}
 
-	h := NewHistory(serv.URL, storage)
+	h := NewHistory(storage, WithClient(client))
 
-	storage.On("Insert", mock.Anything, expected).Return(nil)
+	storage.On("InsertCount", mock.Anything, expected).Return(int64(len(expected)), nil)
 
 	last, err := h.batch(context.Background(), "", "")
 	assert.NoError(t, err)
@@ -265,45 +461,197 @@ func Test_History_batch(t *testing.T) {
 	storage.AssertExpectations(t)
 }
 
+func Test_History_page_duplicates(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: expected}
+	h := NewHistory(storage, WithClient(client))
+
+	var buf bytes.Buffer
+	ctx := zerolog.New(&buf).WithContext(context.Background())
+
+	// the delegation of from was stored by the previous batch
+	storage.On("InsertCount", mock.Anything, expected).Return(int64(2), nil).Once()
+	_, err := h.page(ctx, "2024-10-29T10:09:00Z", "", 0)
+	assert.NoError(t, err)
+	assert.Empty(t, buf.String())
+
+	storage.On("InsertCount", mock.Anything, expected).Return(int64(1), nil).Once()
+	_, err = h.page(ctx, "2024-10-29T10:09:00Z", "", 0)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `"level":"warn"`)
+	assert.Contains(t, buf.String(), `"duplicates":1`)
+
+	storage.AssertExpectations(t)
+}
+
+func Test_History_batch_sameTimestamp(t *testing.T) {
+	storage := &mockStore{}
+	full := make([]tds.Delegation, tzkt.MaxLimit)
+	for i := range full {
+		full[i] = tds.Delegation{Timestamp: "2024-10-29T10:22:25Z", ID: strconv.Itoa(i)}
+	}
+	client := &tzkt.MockClient{
+		DelegationsFunc: func(opts tzkt.DelegationOpts) ([]tds.Delegation, error) {
+			if opts.Offset < 2*tzkt.MaxLimit {
+				return full, nil
+			}
+			return expected, nil
+		},
+	}
+
+	h := NewHistory(storage, WithClient(client))
+
+	storage.On("InsertCount", mock.Anything, mock.Anything).Return(int64(0), nil).Times(3)
+
+	last, err := h.batch(context.Background(), "2024-10-29T10:22:25Z", "")
+	assert.NoError(t, err)
+	assert.Empty(t, last)
+
+	calls := client.Calls()
+	if assert.Len(t, calls, 3) {
+		for i, c := range calls {
+			assert.Equal(t, "2024-10-29T10:22:25Z", c.TsGe)
+			assert.Equal(t, i*tzkt.MaxLimit, c.Offset)
+		}
+	}
+
+	storage.AssertExpectations(t)
+}
+
+func Test_WithBatchSize(t *testing.T) {
+	assert.Equal(t, tzkt.MaxLimit, NewHistory(&mockStore{}).batchSize)
+	assert.Equal(t, 500, NewHistory(&mockStore{}, WithBatchSize(500)).batchSize)
+	assert.Equal(t, 100, NewHistory(&mockStore{}, WithBatchSize(3)).batchSize)
+	assert.Equal(t, tzkt.MaxLimit, NewHistory(&mockStore{}, WithBatchSize(1_000_000)).batchSize)
+}
+
+func Test_History_chunkBatch_batchSize(t *testing.T) {
+	storage := &mockStore{}
+	records := make([]tds.Delegation, 9)
+	for i := range records {
+		records[i] = tds.Delegation{Timestamp: "2024-10-29T10:22:25Z", Level: strconv.Itoa(i + 1), ID: strconv.Itoa(i)}
+	}
+	client := &tzkt.MockClient{
+		DelegationsFunc: func(opts tzkt.DelegationOpts) ([]tds.Delegation, error) {
+			start := min(opts.Offset, len(records))
+			return records[start:min(start+opts.Limit, len(records))], nil
+		},
+	}
+
+	h := NewHistory(storage, WithClient(client))
+	// below the minimum of WithBatchSize
+	h.batchSize = 3
+
+	storage.On("InsertCount", mock.Anything, mock.Anything).Return(int64(3), nil)
+
+	count, err := h.chunkBatch(context.Background(), "2024-10-29T00:00:00Z", "2024-10-30T00:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, len(records), count)
+
+	// 3 full pages, and an empty one ending the paging
+	calls := client.Calls()
+	if assert.Len(t, calls, 4) {
+		for i, c := range calls {
+			assert.Equal(t, 3, c.Limit)
+			assert.Equal(t, i*3, c.Offset)
+		}
+	}
+}
+
+func Test_History_nullSender(t *testing.T) {
+	storage := &mockStore{}
+	records := make([]tds.Delegation, 5)
+	for i := range records {
+		records[i] = tds.Delegation{Timestamp: "2024-10-29T10:22:2" + strconv.Itoa(i) + "Z", Level: strconv.Itoa(i + 1), ID: strconv.Itoa(i)}
+	}
+	// the first page of 3 rows has a row without sender, skipped by the client
+	client := &tzkt.MockClient{
+		PageFunc: func(opts tzkt.DelegationOpts) (tzkt.Page, error) {
+			switch opts.Offset {
+			case 0:
+				return tzkt.Page{Delegations: records[0:2], Rows: 3}, nil
+			case 3:
+				return tzkt.Page{Delegations: records[2:5], Rows: 3}, nil
+			}
+			return tzkt.Page{}, nil
+		},
+	}
+
+	h := NewHistory(storage, WithClient(client))
+	h.batchSize = 3
+	storage.On("InsertCount", mock.Anything, mock.Anything).Return(int64(2), nil)
+
+	// the short page of delegations is not mistaken for the last one
+	next, err := h.batch(context.Background(), "2024-10-29T00:00:00Z", "2024-10-30T00:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, records[1].Timestamp, next)
+
+	count, err := h.chunkBatch(context.Background(), "2024-10-29T00:00:00Z", "2024-10-30T00:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, 2+3, count)
+	// chunkBatch paged past the first page, until the empty one
+	assert.Len(t, client.Calls(), 1+3)
+}
+
+func Test_History_batch_fullWindow(t *testing.T) {
+	storage := &mockStore{}
+	full := make([]tds.Delegation, tzkt.MaxLimit)
+	for i := range full {
+		full[i] = tds.Delegation{Timestamp: "2024-10-29T10:22:25Z", ID: strconv.Itoa(i)}
+	}
+	full[len(full)-1].Timestamp = "2024-10-29T10:22:26Z"
+	client := &tzkt.MockClient{Delegations: full}
+
+	h := NewHistory(storage, WithClient(client))
+
+	storage.On("InsertCount", mock.Anything, full).Return(int64(len(full)), nil).Once()
+
+	last, err := h.batch(context.Background(), "2024-10-29T10:22:25Z", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-10-29T10:22:26Z", last)
+
+	storage.AssertExpectations(t)
+}
+
 func Test_History_batch_error(t *testing.T) {
 	storage := &mockStore{}
-	serv := httpTestServer("", 400, nil)
-	defer serv.Close()
+	client := &tzkt.MockClient{Err: tzkt.ErrInvalidStatusCode}
 
-	h := NewHistory(serv.URL, storage)
+	h := NewHistory(storage, WithClient(client))
 
 	_, err := h.batch(context.Background(), "", "")
-	assert.ErrorIs(t, err, ErrInvalidStatusCode)
+	assert.ErrorIs(t, err, tzkt.ErrInvalidStatusCode)
 
 	storage.AssertExpectations(t)
 }
 
 func Test_History_Sync(t *testing.T) {
 	storage := &mockStore{}
-	serv := httpTestServer("[]", 200, func(r *http.Request) {
-		assert.Equal(t, "GET", r.Method)
-		assert.Equal(t, "timestamp,sender,amount,level,id", r.URL.Query().Get("select"))
-		assert.Equal(t, firstDelegation, r.URL.Query().Get("timestamp.ge"))
-		assert.NotEmpty(t, r.URL.Query().Get("timestamp.lt"))
-		assert.Equal(t, "10000", r.URL.Query().Get("limit"))
-	})
-	defer serv.Close()
+	client := &tzkt.MockClient{Delegations: []tds.Delegation{}}
 
-	h := NewHistory(serv.URL, storage)
+	h := NewHistory(storage, WithClient(client))
 
 	storage.On("LastDelegation", mock.Anything).Return(nil, nil)
-	storage.On("Insert", mock.Anything, []tds.Delegation{}).Return(nil)
+	storage.On("GetFirst", mock.Anything).Return(nil, nil)
+	storage.On("InsertCount", mock.Anything, []tds.Delegation{}).Return(int64(0), nil)
 
 	err := h.Sync(context.Background(), "", "")
 	assert.NoError(t, err)
 	defer h.Stop()
 
+	calls := client.Calls()
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, firstDelegation, calls[0].TsGe)
+		assert.NotEmpty(t, calls[0].TsLt)
+		assert.Equal(t, 10000, calls[0].Limit)
+	}
+
 	storage.AssertExpectations(t)
 }
 
 func Test_History_Sync_error(t *testing.T) {
 	storage := &mockStore{}
-	h := NewHistory("", storage)
+	h := NewHistory(storage)
 
 	storage.On("LastDelegation", mock.Anything).Return(nil, assert.AnError)
 
@@ -312,3 +660,376 @@ func Test_History_Sync_error(t *testing.T) {
 
 	storage.AssertExpectations(t)
 }
+
+func Test_History_Sync_baker(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: []tds.Delegation{}}
+
+	h := NewHistory(storage, WithClient(client), WithBaker("tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB"))
+
+	// the store is scoped by baker instead of LastDelegation and GetFirst
+	baker := "tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB"
+	last := &tds.Delegation{ID: "2", Timestamp: "2024-10-29T10:09:00Z", Baker: baker}
+	first := &tds.Delegation{ID: "1", Timestamp: "2018-06-30T19:30:27Z", Baker: baker}
+	storage.On("Query", mock.Anything, store.DelegationFilter{Baker: &baker, Limit: 1, SortOrder: store.SortDesc}).
+		Return(tds.DelegationSlice{*last}, nil)
+	storage.On("Query", mock.Anything, store.DelegationFilter{Baker: &baker, Limit: 1, SortOrder: store.SortAsc}).
+		Return(tds.DelegationSlice{*first}, nil)
+	storage.On("InsertCount", mock.Anything, []tds.Delegation{}).Return(int64(0), nil)
+
+	err := h.Sync(context.Background(), "", "")
+	assert.NoError(t, err)
+	defer h.Stop()
+
+	calls := client.Calls()
+	if assert.NotEmpty(t, calls) {
+		assert.Equal(t, last.Timestamp, calls[0].TsGe)
+		assert.Equal(t, baker, calls[0].Baker)
+	}
+	storage.AssertExpectations(t)
+}
+
+func Test_History_Sync_logger(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: []tds.Delegation{}}
+
+	var buf bytes.Buffer
+	h := NewHistory(storage, WithClient(client), WithLogger(zerolog.New(&buf)))
+
+	storage.On("LastDelegation", mock.Anything).Return(nil, nil)
+	storage.On("GetFirst", mock.Anything).Return(nil, nil)
+	storage.On("InsertCount", mock.Anything, []tds.Delegation{}).Return(int64(0), nil)
+
+	err := h.Sync(context.Background(), "", "")
+	assert.NoError(t, err)
+	defer h.Stop()
+	assert.Contains(t, buf.String(), "no start date provided")
+}
+
+func Test_History_Sync_covered(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: expected}
+
+	h := NewHistory(storage, WithClient(client))
+
+	storage.On("GetFirst", mock.Anything).Return(&tds.Delegation{Timestamp: "2024-10-28T00:00:00Z"}, nil)
+	storage.On("LastDelegation", mock.Anything).Return(&tds.Delegation{Timestamp: "2024-10-30T00:00:00Z"}, nil)
+
+	err := h.Sync(context.Background(), "2024-10-29T00:00:00Z", "2024-10-30T00:00:00Z")
+	assert.NoError(t, err)
+	defer h.Stop()
+
+	// the store holds the whole range, nothing is fetched
+	assert.Empty(t, client.Calls())
+	storage.AssertExpectations(t)
+}
+
+func Test_History_Sync_gap(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: []tds.Delegation{}}
+
+	h := NewHistory(storage, WithClient(client))
+
+	storage.On("GetFirst", mock.Anything).Return(&tds.Delegation{Timestamp: "2020-01-01T00:00:00Z"}, nil)
+	storage.On("LastDelegation", mock.Anything).Return(&tds.Delegation{Timestamp: "2024-10-29T12:00:00Z"}, nil)
+	storage.On("InsertCount", mock.Anything, []tds.Delegation{}).Return(int64(0), nil)
+
+	err := h.Sync(context.Background(), "", "")
+	assert.NoError(t, err)
+	defer h.Stop()
+
+	// the history before the first stored delegation, then the new delegations
+	calls := client.Calls()
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, firstDelegation, calls[0].TsGe)
+		assert.Equal(t, "2020-01-01T00:00:00Z", calls[0].TsLt)
+		assert.Equal(t, "2024-10-29T12:00:00Z", calls[1].TsGe)
+		assert.NotEmpty(t, calls[1].TsLt)
+	}
+	storage.AssertExpectations(t)
+}
+
+func Test_History_Sync_gapReverse(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: []tds.Delegation{}}
+
+	h := NewHistory(storage, WithClient(client), WithReverseOrder())
+
+	storage.On("GetFirst", mock.Anything).Return(&tds.Delegation{Timestamp: "2020-01-01T00:00:00Z"}, nil)
+	storage.On("LastDelegation", mock.Anything).Return(&tds.Delegation{Timestamp: "2024-10-29T12:00:00Z"}, nil)
+	storage.On("InsertCount", mock.Anything, []tds.Delegation{}).Return(int64(0), nil)
+
+	err := h.Sync(context.Background(), "", "")
+	assert.NoError(t, err)
+	defer h.Stop()
+
+	// the new delegations, then the history before the first stored delegation
+	calls := client.Calls()
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, "2024-10-29T12:00:00Z", calls[0].TsGe)
+		assert.Equal(t, firstDelegation, calls[1].TsGe)
+		assert.Equal(t, "2020-01-01T00:00:00Z", calls[1].TsLt)
+	}
+	storage.AssertExpectations(t)
+}
+
+func Test_History_Sync_noGap(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: []tds.Delegation{}}
+
+	h := NewHistory(storage, WithClient(client))
+
+	storage.On("GetFirst", mock.Anything).Return(&tds.Delegation{Timestamp: firstDelegation}, nil)
+	storage.On("LastDelegation", mock.Anything).Return(&tds.Delegation{Timestamp: "2024-10-29T12:00:00Z"}, nil)
+	storage.On("InsertCount", mock.Anything, []tds.Delegation{}).Return(int64(0), nil)
+
+	err := h.Sync(context.Background(), "", "")
+	assert.NoError(t, err)
+	defer h.Stop()
+
+	calls := client.Calls()
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, "2024-10-29T12:00:00Z", calls[0].TsGe)
+	}
+	storage.AssertExpectations(t)
+}
+
+func Test_History_Sync_partiallyCovered(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: []tds.Delegation{}}
+
+	h := NewHistory(storage, WithClient(client))
+
+	storage.On("GetFirst", mock.Anything).Return(&tds.Delegation{Timestamp: "2024-10-28T00:00:00Z"}, nil)
+	storage.On("LastDelegation", mock.Anything).Return(&tds.Delegation{Timestamp: "2024-10-29T12:00:00Z"}, nil)
+	storage.On("InsertCount", mock.Anything, []tds.Delegation{}).Return(int64(0), nil)
+
+	err := h.Sync(context.Background(), "2024-10-29T00:00:00Z", "2024-10-30T00:00:00Z")
+	assert.NoError(t, err)
+	defer h.Stop()
+
+	assert.Len(t, client.Calls(), 1)
+	storage.AssertExpectations(t)
+}
+
+func Test_History_Sync_chunks(t *testing.T) {
+	storage := &mockStore{}
+	full := make([]tds.Delegation, tzkt.MaxLimit)
+	client := &tzkt.MockClient{
+		DelegationsFunc: func(opts tzkt.DelegationOpts) ([]tds.Delegation, error) {
+			// the second day needs an extra page
+			if opts.TsGe == "2024-10-30T00:00:00Z" && opts.Offset == 0 {
+				return full, nil
+			}
+			return expected, nil
+		},
+	}
+
+	h := NewHistory(storage, WithClient(client), WithChunkDuration(24*time.Hour))
+
+	storage.On("GetFirst", mock.Anything).Return(nil, nil)
+	storage.On("InsertCount", mock.Anything, mock.Anything).Return(int64(0), nil).Times(4)
+
+	err := h.Sync(context.Background(), "2024-10-29T10:22:25Z", "2024-10-31T12:00:00Z")
+	assert.NoError(t, err)
+	defer h.Stop()
+
+	calls := client.Calls()
+	want := []tzkt.DelegationOpts{
+		{TsGe: "2024-10-29T10:22:25Z", TsLt: "2024-10-30T00:00:00Z", Limit: tzkt.MaxLimit},
+		{TsGe: "2024-10-30T00:00:00Z", TsLt: "2024-10-31T00:00:00Z", Limit: tzkt.MaxLimit},
+		{TsGe: "2024-10-30T00:00:00Z", TsLt: "2024-10-31T00:00:00Z", Limit: tzkt.MaxLimit, Offset: tzkt.MaxLimit},
+		{TsGe: "2024-10-31T00:00:00Z", TsLt: "2024-10-31T12:00:00Z", Limit: tzkt.MaxLimit},
+	}
+	assert.Equal(t, want, calls)
+
+	storage.AssertExpectations(t)
+}
+
+func Test_History_Sync_reverse(t *testing.T) {
+	storage := &mockStore{}
+	full := make([]tds.Delegation, tzkt.MaxLimit)
+	for i := range full {
+		full[i] = tds.Delegation{Timestamp: "2024-10-31T10:00:00Z", ID: strconv.Itoa(i)}
+	}
+	full[len(full)-1].Timestamp = "2024-10-30T10:00:00Z"
+	client := &tzkt.MockClient{
+		DelegationsFunc: func(opts tzkt.DelegationOpts) ([]tds.Delegation, error) {
+			if opts.TsLt == "2024-10-31T12:00:00Z" {
+				return full, nil
+			}
+			return expected, nil
+		},
+	}
+
+	h := NewHistory(storage, WithClient(client), WithReverseOrder())
+
+	storage.On("GetFirst", mock.Anything).Return(nil, nil)
+	storage.On("InsertCount", mock.Anything, mock.Anything).Return(int64(0), nil).Times(2)
+
+	err := h.Sync(context.Background(), "2024-10-29T00:00:00Z", "2024-10-31T12:00:00Z")
+	assert.NoError(t, err)
+	defer h.Stop()
+
+	// the second batch ends a second after the oldest delegation of the first
+	want := []tzkt.DelegationOpts{
+		{TsGe: "2024-10-29T00:00:00Z", TsLt: "2024-10-31T12:00:00Z", Limit: tzkt.MaxLimit, SortDesc: true},
+		{TsGe: "2024-10-29T00:00:00Z", TsLt: "2024-10-30T10:00:01Z", Limit: tzkt.MaxLimit, SortDesc: true},
+	}
+	assert.Equal(t, want, client.Calls())
+
+	storage.AssertExpectations(t)
+}
+
+func Test_History_Sync_reverseChunks(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: expected}
+
+	h := NewHistory(storage, WithClient(client), WithChunkDuration(24*time.Hour), WithReverseOrder())
+
+	storage.On("GetFirst", mock.Anything).Return(nil, nil)
+	storage.On("InsertCount", mock.Anything, mock.Anything).Return(int64(0), nil).Times(3)
+
+	err := h.Sync(context.Background(), "2024-10-29T10:22:25Z", "2024-10-31T12:00:00Z")
+	assert.NoError(t, err)
+	defer h.Stop()
+
+	want := []tzkt.DelegationOpts{
+		{TsGe: "2024-10-31T00:00:00Z", TsLt: "2024-10-31T12:00:00Z", Limit: tzkt.MaxLimit, SortDesc: true},
+		{TsGe: "2024-10-30T00:00:00Z", TsLt: "2024-10-31T00:00:00Z", Limit: tzkt.MaxLimit, SortDesc: true},
+		{TsGe: "2024-10-29T10:22:25Z", TsLt: "2024-10-30T00:00:00Z", Limit: tzkt.MaxLimit, SortDesc: true},
+	}
+	assert.Equal(t, want, client.Calls())
+
+	storage.AssertExpectations(t)
+}
+
+func Test_History_Sync_dryRun(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: expected}
+
+	h := NewHistory(storage, WithClient(client), WithDryRun())
+
+	// Insert is never called on the store
+	storage.On("LastDelegation", mock.Anything).Return(nil, nil)
+	storage.On("GetFirst", mock.Anything).Return(nil, nil)
+
+	err := h.Sync(context.Background(), "", "")
+	assert.NoError(t, err)
+	defer h.Stop()
+
+	assert.Equal(t, int64(len(expected)), h.DryRunCount())
+	storage.AssertExpectations(t)
+}
+
+func Test_Live_sync_overlap(t *testing.T) {
+	last := time.Date(2024, time.October, 29, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{name: "default", want: "2024-10-29T09:58:00Z"},
+		{name: "none", opts: []Option{WithOverlap(0)}, want: "2024-10-29T10:00:00Z"},
+		{name: "half", opts: []Option{WithOverlap(0.5)}, want: "2024-10-29T09:55:00Z"},
+		{name: "full", opts: []Option{WithOverlap(1)}, want: "2024-10-29T09:50:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &tzkt.MockClient{Delegations: []tds.Delegation{}}
+			s := NewLive(&mockStore{}, append(tt.opts, WithInterval(10*time.Minute), WithClient(client))...)
+			s.ctx, s.cancel = context.WithCancel(context.Background())
+			defer s.cancel()
+			s.last = last
+
+			assert.NoError(t, s.sync())
+			if calls := client.Calls(); assert.Len(t, calls, 1) {
+				assert.Equal(t, tt.want, calls[0].TsGe)
+			}
+		})
+	}
+}
+
+func Test_Live_Sync_invalidOverlap(t *testing.T) {
+	for _, overlap := range []float64{-0.1, 1.5} {
+		client := &tzkt.MockClient{}
+		s := NewLive(&mockStore{}, WithInterval(time.Minute), WithClient(client), WithOverlap(overlap))
+		err := s.Sync(context.Background(), "")
+		assert.ErrorIs(t, err, ErrInvalidOverlap)
+		assert.Empty(t, client.Calls())
+	}
+}
+
+func Test_Live_Sync_negativeInterval(t *testing.T) {
+	client := &tzkt.MockClient{}
+	s := NewLive(&mockStore{}, WithInterval(-time.Minute), WithClient(client))
+	err := s.Sync(context.Background(), "")
+	assert.ErrorIs(t, err, ErrInvalidInterval)
+	assert.Nil(t, s.ticker)
+	assert.Empty(t, client.Calls())
+}
+
+func Test_Live_sync_metrics(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: expected}
+	reg := prometheus.NewPedanticRegistry()
+
+	s := NewLive(storage, WithInterval(time.Minute), WithClient(client), WithRegistry(reg))
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	defer s.cancel()
+
+	storage.On("Insert", mock.Anything, expected).Return(nil)
+
+	assert.NoError(t, s.sync())
+	client.Err = tzkt.ErrInvalidStatusCode
+	assert.Error(t, s.sync())
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP tds_live_sync_cycles_total Number of live syncs.
+# TYPE tds_live_sync_cycles_total counter
+tds_live_sync_cycles_total 1
+# HELP tds_live_sync_delegations_total Number of delegations fetched by the live sync.
+# TYPE tds_live_sync_delegations_total counter
+tds_live_sync_delegations_total 3
+# HELP tds_sync_errors_total Number of failed syncs, by sync type.
+# TYPE tds_sync_errors_total counter
+tds_sync_errors_total{type="live"} 1
+`), "tds_live_sync_cycles_total", "tds_live_sync_delegations_total", "tds_sync_errors_total")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, testutil.CollectAndCount(reg, "tds_sync_api_request_duration_seconds"))
+
+	storage.AssertExpectations(t)
+}
+
+func Test_History_Sync_metrics(t *testing.T) {
+	storage := &mockStore{}
+	client := &tzkt.MockClient{Delegations: expected}
+	reg := prometheus.NewPedanticRegistry()
+
+	// both syncers share the metrics of the registry
+	h := NewHistory(storage, WithClient(client), WithRegistry(reg))
+	failing := NewHistory(storage, WithClient(&tzkt.MockClient{Err: tzkt.ErrInvalidStatusCode}), WithRegistry(reg))
+
+	storage.On("GetFirst", mock.Anything).Return(nil, nil)
+	storage.On("InsertCount", mock.Anything, expected).Return(int64(len(expected)), nil)
+
+	err := h.Sync(context.Background(), "2024-01-01T00:00:00Z", "2025-01-01T00:00:00Z")
+	assert.NoError(t, err)
+	err = failing.Sync(context.Background(), "2024-01-01T00:00:00Z", "2025-01-01T00:00:00Z")
+	assert.Error(t, err)
+
+	err = testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP tds_history_sync_batches_total Number of batches fetched by the history sync.
+# TYPE tds_history_sync_batches_total counter
+tds_history_sync_batches_total 1
+# HELP tds_history_sync_delegations_total Number of delegations fetched by the history sync.
+# TYPE tds_history_sync_delegations_total counter
+tds_history_sync_delegations_total 3
+# HELP tds_sync_errors_total Number of failed syncs, by sync type.
+# TYPE tds_sync_errors_total counter
+tds_sync_errors_total{type="history"} 1
+`), "tds_history_sync_batches_total", "tds_history_sync_delegations_total", "tds_sync_errors_total")
+	assert.NoError(t, err)
+
+	storage.AssertExpectations(t)
+}
@@ -1,10 +1,165 @@
 package tds
 
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frieeze/tezos-delegation/internal/tezos"
+)
+
 // Delegation is a struct that represents a delegation
 type Delegation struct {
 	Timestamp string `json:"timestamp"`
 	Delegator string `json:"delegator"`
 	Amount    string `json:"amount"`
 	Level     string `json:"level"`
-	ID        string `json:"-"`
+	Baker     string `json:"baker,omitempty"`
+	// OperationHash is the hash of the operation, empty for the delegations
+	// stored before it was fetched
+	OperationHash string `json:"operation_hash,omitempty"`
+	ID            string `json:"-"`
+}
+
+// ErrInvalidDelegation is returned when a delegation breaks a field invariant
+var ErrInvalidDelegation = errors.New("invalid delegation")
+
+// Validate checks the delegation fields
+// Timestamp must be RFC3339, Delegator a Tezos address,
+// Amount a non negative integer, Level a positive integer and ID set
+func (d Delegation) Validate() error {
+	if _, err := time.Parse(time.RFC3339, d.Timestamp); err != nil {
+		return fmt.Errorf("%w: timestamp %q", ErrInvalidDelegation, d.Timestamp)
+	}
+	if err := tezos.ValidateAddress(d.Delegator); err != nil {
+		return fmt.Errorf("%w: delegator %w", ErrInvalidDelegation, err)
+	}
+	if amount, err := strconv.ParseInt(d.Amount, 10, 64); err != nil || amount < 0 {
+		return fmt.Errorf("%w: amount %q", ErrInvalidDelegation, d.Amount)
+	}
+	if level, err := strconv.ParseInt(d.Level, 10, 64); err != nil || level < 1 {
+		return fmt.Errorf("%w: level %q", ErrInvalidDelegation, d.Level)
+	}
+	if d.ID == "" {
+		return fmt.Errorf("%w: empty id", ErrInvalidDelegation)
+	}
+	return nil
+}
+
+// mutezPerXTZ is the number of mutez in one tez
+const mutezPerXTZ = 1_000_000
+
+// AmountXTZ returns the amount in tez with the 6 decimals of the mutez,
+// e.g. "13.814013" for "13814013", or an empty string if Amount isn't an integer
+func (d Delegation) AmountXTZ() string {
+	mutez, err := strconv.ParseInt(d.Amount, 10, 64)
+	if err != nil {
+		return ""
+	}
+	sign := ""
+	if mutez < 0 {
+		sign, mutez = "-", -mutez
+	}
+	return fmt.Sprintf("%s%d.%06d", sign, mutez/mutezPerXTZ, mutez%mutezPerXTZ)
+}
+
+// CSVHeader is the header row matching Delegation.CSV
+var CSVHeader = []string{"id", "timestamp", "delegator", "amount", "level", "baker"}
+
+// CSV returns the delegation as a csv record
+// with the columns of CSVHeader
+func (d Delegation) CSV() []string {
+	return []string{d.ID, d.Timestamp, d.Delegator, d.Amount, d.Level, d.Baker}
+}
+
+// DelegationSlice is a list of delegations
+// Helpers return new slices and leave the receiver untouched
+type DelegationSlice []Delegation
+
+// SortByTimestamp returns the delegations ordered by ascending timestamps
+func (ds DelegationSlice) SortByTimestamp() DelegationSlice {
+	sorted := slices.Clone(ds)
+	slices.SortStableFunc(sorted, func(a, b Delegation) int {
+		return strings.Compare(a.Timestamp, b.Timestamp)
+	})
+	return sorted
+}
+
+// SortByAmount returns the delegations ordered by ascending amounts
+// Non numeric amounts count as 0
+func (ds DelegationSlice) SortByAmount() DelegationSlice {
+	sorted := slices.Clone(ds)
+	slices.SortStableFunc(sorted, func(a, b Delegation) int {
+		x, _ := strconv.ParseInt(a.Amount, 10, 64)
+		y, _ := strconv.ParseInt(b.Amount, 10, 64)
+		return cmp.Compare(x, y)
+	})
+	return sorted
+}
+
+// FilterByDelegator returns the delegations of the given address
+func (ds DelegationSlice) FilterByDelegator(address string) DelegationSlice {
+	return ds.filter(func(d Delegation) bool { return d.Delegator == address })
+}
+
+// FilterByYears returns the delegations made during one of the given years
+// years should be in the format "2006"
+func (ds DelegationSlice) FilterByYears(years ...string) DelegationSlice {
+	return ds.filter(func(d Delegation) bool { return slices.Contains(years, d.year()) })
+}
+
+func (ds DelegationSlice) filter(keep func(Delegation) bool) DelegationSlice {
+	filtered := DelegationSlice{}
+	for _, d := range ds {
+		if keep(d) {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered
+}
+
+// TotalAmountMutez returns the sum of the delegated amounts, in mutez
+// Fails on the first non numeric amount
+func (ds DelegationSlice) TotalAmountMutez() (int64, error) {
+	var total int64
+	for _, d := range ds {
+		amount, err := strconv.ParseInt(d.Amount, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("delegation %s amount: %w", d.ID, err)
+		}
+		total += amount
+	}
+	return total, nil
+}
+
+// Unique returns the delegations without duplicated ids,
+// keeping the first occurrence
+func (ds DelegationSlice) Unique() DelegationSlice {
+	seen := make(map[string]bool, len(ds))
+	return ds.filter(func(d Delegation) bool {
+		if seen[d.ID] {
+			return false
+		}
+		seen[d.ID] = true
+		return true
+	})
+}
+
+// GroupByYear returns the delegations indexed by year, in the format "2006"
+func (ds DelegationSlice) GroupByYear() map[string]DelegationSlice {
+	groups := map[string]DelegationSlice{}
+	for _, d := range ds {
+		groups[d.year()] = append(groups[d.year()], d)
+	}
+	return groups
+}
+
+// year returns the year of the delegation timestamp
+func (d Delegation) year() string {
+	year, _, _ := strings.Cut(d.Timestamp, "-")
+	return year
 }
@@ -0,0 +1,101 @@
+package tds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var delegations = DelegationSlice{
+	{ID: "3", Timestamp: "2022-10-29T10:09:00Z", Delegator: "tz1b", Amount: "300"},
+	{ID: "1", Timestamp: "2020-10-29T10:22:25Z", Delegator: "tz1a", Amount: "1000"},
+	{ID: "2", Timestamp: "2021-10-29T10:10:00Z", Delegator: "tz1b", Amount: "20"},
+}
+
+func Test_DelegationSlice_Sort(t *testing.T) {
+	byTime := delegations.SortByTimestamp()
+	assert.Equal(t, DelegationSlice{delegations[1], delegations[2], delegations[0]}, byTime)
+
+	byAmount := delegations.SortByAmount()
+	assert.Equal(t, DelegationSlice{delegations[2], delegations[0], delegations[1]}, byAmount)
+
+	// the receiver is left untouched
+	assert.Equal(t, "3", delegations[0].ID)
+}
+
+func Test_DelegationSlice_Filter(t *testing.T) {
+	assert.Equal(t, DelegationSlice{delegations[0], delegations[2]}, delegations.FilterByDelegator("tz1b"))
+	assert.Empty(t, delegations.FilterByDelegator("tz1c"))
+
+	assert.Equal(t, DelegationSlice{delegations[0], delegations[1]}, delegations.FilterByYears("2020", "2022"))
+	assert.Empty(t, delegations.FilterByYears())
+}
+
+func Test_DelegationSlice_TotalAmountMutez(t *testing.T) {
+	total, err := delegations.TotalAmountMutez()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1320), total)
+
+	_, err = append(delegations, Delegation{ID: "4", Amount: "1.5"}).TotalAmountMutez()
+	assert.ErrorContains(t, err, "delegation 4 amount")
+}
+
+func Test_DelegationSlice_Unique(t *testing.T) {
+	dup := append(DelegationSlice{}, delegations...)
+	dup = append(dup, Delegation{ID: "1", Delegator: "tz1z"})
+	assert.Equal(t, delegations, dup.Unique())
+}
+
+func Test_DelegationSlice_GroupByYear(t *testing.T) {
+	assert.Equal(t, map[string]DelegationSlice{
+		"2020": {delegations[1]},
+		"2021": {delegations[2]},
+		"2022": {delegations[0]},
+	}, delegations.GroupByYear())
+}
+
+func Test_Delegation_Validate(t *testing.T) {
+	valid := Delegation{
+		Timestamp: "2024-10-29T10:22:25Z",
+		Delegator: "tz1L6FGN8F2o3j8CsGCoktiFDdDLkbECEDms",
+		Amount:    "0",
+		Level:     "6976378",
+		ID:        "1401626186219520",
+	}
+	assert.NoError(t, valid.Validate())
+
+	kt := valid
+	kt.Delegator = "KT1PWx2mnDueood7fEmfbBDKx1D9BAnnXitn"
+	assert.NoError(t, kt.Validate())
+
+	tests := map[string]func(d *Delegation){
+		"timestamp":        func(d *Delegation) { d.Timestamp = "2024-10-29 10:22:25" },
+		"empty delegator":  func(d *Delegation) { d.Delegator = "" },
+		"delegator prefix": func(d *Delegation) { d.Delegator = "sr1RYurGZtN8KNSpkMcCt9CgWeUaNkzsAfXf" },
+		"short delegator":  func(d *Delegation) { d.Delegator = "tz1a" },
+		"amount":           func(d *Delegation) { d.Amount = "1.5" },
+		"negative amount":  func(d *Delegation) { d.Amount = "-1" },
+		"level":            func(d *Delegation) { d.Level = "abc" },
+		"zero level":       func(d *Delegation) { d.Level = "0" },
+		"id":               func(d *Delegation) { d.ID = "" },
+	}
+	for name, breakIt := range tests {
+		d := valid
+		breakIt(&d)
+		assert.ErrorIs(t, d.Validate(), ErrInvalidDelegation, name)
+	}
+}
+
+func Test_Delegation_AmountXTZ(t *testing.T) {
+	for amount, want := range map[string]string{
+		"13814013": "13.814013",
+		"1000000":  "1.000000",
+		"20":       "0.000020",
+		"0":        "0.000000",
+		"-1500000": "-1.500000",
+		"":         "",
+		"1.5":      "",
+	} {
+		assert.Equal(t, want, Delegation{Amount: amount}.AmountXTZ(), amount)
+	}
+}
@@ -0,0 +1,147 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/frieeze/tezos-delegation/internal/app"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tzktAddress struct {
+	Address string `json:"address"`
+}
+
+// tzktDelegation is a delegation in the tzkt api format
+type tzktDelegation struct {
+	Timestamp   string      `json:"timestamp"`
+	Sender      tzktAddress `json:"sender"`
+	Amount      int         `json:"amount"`
+	Level       int         `json:"level"`
+	ID          int         `json:"id"`
+	NewDelegate tzktAddress `json:"newDelegate"`
+}
+
+var delegations = []tzktDelegation{
+	{Timestamp: "2023-12-31T23:59:59Z", Sender: tzktAddress{"tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}, Amount: 100, Level: 1, ID: 1, NewDelegate: tzktAddress{"tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB"}},
+	{Timestamp: "2024-03-01T10:00:00Z", Sender: tzktAddress{"tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}, Amount: 200, Level: 2, ID: 2, NewDelegate: tzktAddress{"tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB"}},
+	{Timestamp: "2024-06-01T10:00:00Z", Sender: tzktAddress{"tz1ccccccccccccccccccccccccccccccccc"}, Amount: 300, Level: 3, ID: 3, NewDelegate: tzktAddress{"tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB"}},
+}
+
+// tzktServer serves the delegations sorted by timestamp,
+// filtered by the timestamp, limit and offset parameters like tzkt
+func tzktServer(t *testing.T, ds []tzktDelegation) *httptest.Server {
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var page []tzktDelegation
+		for _, d := range ds {
+			if ge := q.Get("timestamp.ge"); ge != "" && d.Timestamp < ge {
+				continue
+			}
+			if lt := q.Get("timestamp.lt"); lt != "" && d.Timestamp >= lt {
+				continue
+			}
+			page = append(page, d)
+		}
+		if offset, _ := strconv.Atoi(q.Get("offset")); offset < len(page) {
+			page = page[offset:]
+		} else {
+			page = nil
+		}
+		if limit, _ := strconv.Atoi(q.Get("limit")); limit > 0 && limit < len(page) {
+			page = page[:limit]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(append([]tzktDelegation{}, page...))
+	}))
+	t.Cleanup(serv.Close)
+	return serv
+}
+
+// newApp starts an app syncing from the given tzkt server
+// and serving its routes on a test server
+func newApp(t *testing.T, api string) (*app.App, *httptest.Server) {
+	a, err := app.NewApp(context.Background(), app.Config{
+		DatabaseURL:  filepath.Join(t.TempDir(), "delegations.db"),
+		API:          api,
+		SyncInterval: time.Minute,
+		History:      true,
+		Registry:     prometheus.NewRegistry(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { a.Close() })
+
+	serv := httptest.NewServer(a.Handler)
+	t.Cleanup(serv.Close)
+	return a, serv
+}
+
+type delegation struct {
+	Timestamp string `json:"timestamp"`
+	Delegator string `json:"delegator"`
+	Amount    string `json:"amount"`
+	Level     string `json:"level"`
+	Baker     string `json:"baker"`
+}
+
+// getDelegations calls GET /xtz/delegations?year=year
+func getDelegations(t *testing.T, serv *httptest.Server, year string) []delegation {
+	resp, err := http.Get(serv.URL + "/xtz/delegations?year=" + year)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Data []delegation `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return body.Data
+}
+
+func Test_HistorySync(t *testing.T) {
+	tzkt := tzktServer(t, delegations)
+	a, _ := newApp(t, tzkt.URL)
+
+	require.NoError(t, a.History.Sync(context.Background(), "", ""))
+
+	count, err := a.Store.CountByDateRange(context.Background(), "2018-01-01T00:00:00Z", "2100-01-01T00:00:00Z")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(delegations)), count)
+}
+
+func Test_Delegations_year(t *testing.T) {
+	tzkt := tzktServer(t, delegations)
+	a, serv := newApp(t, tzkt.URL)
+	require.NoError(t, a.History.Sync(context.Background(), "", ""))
+
+	assert.Equal(t, []delegation{
+		{Timestamp: "2024-06-01T10:00:00Z", Delegator: "tz1ccccccccccccccccccccccccccccccccc", Amount: "300", Level: "3", Baker: "tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB"},
+		{Timestamp: "2024-03-01T10:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "200", Level: "2", Baker: "tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB"},
+	}, getDelegations(t, serv, "2024"))
+	assert.Equal(t, []delegation{
+		{Timestamp: "2023-12-31T23:59:59Z", Delegator: "tz1aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Amount: "100", Level: "1", Baker: "tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB"},
+	}, getDelegations(t, serv, "2023"))
+}
+
+func Test_Delegations_noDuplicates(t *testing.T) {
+	tzkt := tzktServer(t, delegations)
+	a, serv := newApp(t, tzkt.URL)
+	require.NoError(t, a.History.Sync(context.Background(), "", ""))
+
+	// both syncs fetch the stored delegations again
+	require.NoError(t, a.History.Sync(context.Background(), "2018-06-30T19:30:27Z", ""))
+	require.NoError(t, a.Live.Sync(context.Background(), "2023-01-01T00:00:00Z"))
+
+	assert.Equal(t, []delegation{
+		{Timestamp: "2024-06-01T10:00:00Z", Delegator: "tz1ccccccccccccccccccccccccccccccccc", Amount: "300", Level: "3", Baker: "tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB"},
+		{Timestamp: "2024-03-01T10:00:00Z", Delegator: "tz1bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Amount: "200", Level: "2", Baker: "tz1bakerBBBBBBBBBBBBBBBBBBBBBBBBBBBB"},
+	}, getDelegations(t, serv, "2024"))
+}